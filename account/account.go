@@ -0,0 +1,266 @@
+package account
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	// accountsKey is the Redis hash storing all accounts. The field is the
+	// name of the account, the value the JSON encoded Account.
+	accountsKey = "pinbackup:accounts"
+	// cookiesKeyPrefix + name contains the encrypted cookies of the last
+	// session of an account.
+	cookiesKeyPrefix = "pinbackup:accountcookies:"
+
+	// KeySize is the size of the key encrypting the credentials in bytes.
+	// The credentials are encrypted with AES-256-GCM.
+	KeySize = 32
+)
+
+// ErrNotFound is returned if an account doesn't exist.
+var ErrNotFound = errors.New("Account not found")
+
+// validName matches the names of accounts. They are used in Redis keys and
+// API requests.
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Account is a Pinterest account the scraper can log in with. Password is
+// encrypted with the account key and only decrypted by the scraper.
+type Account struct {
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Password string    `json:"password"`
+	Created  time.Time `json:"created"`
+}
+
+// ValidName returns an error if name can't be used as name of an account.
+func ValidName(name string) error {
+	if !validName.MatchString(name) {
+		return errors.Errorf("Invalid account name %q. Use up to 64 lower case letters, digits, - and _", name)
+	}
+
+	return nil
+}
+
+// GenerateKey returns a new random key hex encoded.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+// ParseKey decodes a hex or base64 encoded key.
+func ParseKey(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, errors.New("Account key is missing")
+	}
+
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(encoded)
+	}
+	if err != nil || len(key) != KeySize {
+		return nil, errors.Errorf("Account key must be %d bytes hex or base64 encoded", KeySize)
+	}
+
+	return key, nil
+}
+
+// newGCM returns the cipher for key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypt encrypts plain with key. The name of the account is
+// authenticated as well so the secrets of one account can't be copied to
+// another. The result is the base64 encoded nonce followed by the cipher
+// text.
+func encrypt(key []byte, name string, plain []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, []byte(name))), nil
+}
+
+// decrypt reverses encrypt.
+func decrypt(key []byte, name string, encrypted string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("Encrypted data too short")
+	}
+
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, errors.Errorf("Can not decrypt secrets of account %s. The account key may be wrong", name)
+	}
+
+	return plain, nil
+}
+
+// Decrypt returns the password of the account.
+func (a *Account) Decrypt(key []byte) (string, error) {
+	plain, err := decrypt(key, a.Name, a.Password)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plain), nil
+}
+
+// Save stores an account with its password encrypted. An existing account
+// with the same name is replaced and its session is dropped.
+func Save(conn redis.Conn, key []byte, name string, email string, password string) (*Account, error) {
+	if err := ValidName(name); err != nil {
+		return nil, err
+	}
+	if email == "" || password == "" {
+		return nil, errors.New("Email and password are required")
+	}
+
+	encrypted, err := encrypt(key, name, []byte(password))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Account{
+		Name:     name,
+		Email:    email,
+		Password: encrypted,
+		Created:  time.Now().UTC(),
+	}
+
+	value, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.Send("MULTI")
+	conn.Send("HSET", accountsKey, name, value)
+	conn.Send("DEL", cookiesKeyPrefix+name)
+	if _, err := conn.Do("EXEC"); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Get returns an account or ErrNotFound.
+func Get(conn redis.Conn, name string) (*Account, error) {
+	value, err := redis.Bytes(conn.Do("HGET", accountsKey, name))
+	if err == redis.ErrNil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Account{}
+	if err := json.Unmarshal(value, a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Exists returns true if an account exists.
+func Exists(conn redis.Conn, name string) (bool, error) {
+	return redis.Bool(conn.Do("HEXISTS", accountsKey, name))
+}
+
+// List returns all accounts sorted by name.
+func List(conn redis.Conn) ([]Account, error) {
+	values, err := redis.StringMap(conn.Do("HGETALL", accountsKey))
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []Account{}
+	for _, value := range values {
+		a := Account{}
+		if err := json.Unmarshal([]byte(value), &a); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Name < accounts[j].Name
+	})
+
+	return accounts, nil
+}
+
+// Delete deletes an account and its session.
+func Delete(conn redis.Conn, name string) error {
+	deleted, err := redis.Int(conn.Do("HDEL", accountsKey, name))
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	_, err = conn.Do("DEL", cookiesKeyPrefix+name)
+
+	return err
+}
+
+// SaveCookies stores the cookies of the session of an account encrypted
+// for ttl. The scraper restores them instead of logging in again.
+func SaveCookies(conn redis.Conn, key []byte, name string, cookies []byte, ttl time.Duration) error {
+	encrypted, err := encrypt(key, name, cookies)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("SET", cookiesKeyPrefix+name, encrypted, "EX", int64(ttl.Seconds()))
+
+	return err
+}
+
+// Cookies returns the stored cookies of the session of an account or nil
+// if there are none.
+func Cookies(conn redis.Conn, key []byte, name string) ([]byte, error) {
+	encrypted, err := redis.String(conn.Do("GET", cookiesKeyPrefix+name))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decrypt(key, name, encrypted)
+}
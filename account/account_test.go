@@ -0,0 +1,89 @@
+package account
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestValidName(t *testing.T) {
+	var testNames = []struct {
+		name  string
+		valid bool
+	}{
+		{"alice", true},
+		{"team-1_backup", true},
+		{"", false},
+		{"Alice", false},
+		{"-alice", false},
+		{"alice:bob", false},
+		{strings.Repeat("a", 65), false},
+	}
+
+	for _, tn := range testNames {
+		if err := ValidName(tn.name); (err == nil) != tn.valid {
+			t.Errorf("%q: Got error: %v / Expected valid: %t", tn.name, err, tn.valid)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	generated, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := bytes.Repeat([]byte{7}, KeySize)
+
+	var testKeys = []struct {
+		encoded string
+		valid   bool
+	}{
+		{generated, true},
+		{hex.EncodeToString(raw), true},
+		{base64.StdEncoding.EncodeToString(raw), true},
+		{"", false},
+		{"secret", false},
+		{hex.EncodeToString(raw[:16]), false},
+	}
+
+	for _, tk := range testKeys {
+		if _, err := ParseKey(tk.encoded); (err == nil) != tk.valid {
+			t.Errorf("%q: Got error: %v / Expected valid: %t", tk.encoded, err, tk.valid)
+		}
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	otherKey := bytes.Repeat([]byte{2}, KeySize)
+
+	encrypted, err := encrypt(key, "alice", []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(encrypted, "password") {
+		t.Error("Password must not be stored in plain text")
+	}
+
+	again, _ := encrypt(key, "alice", []byte("password"))
+	if again == encrypted {
+		t.Error("Encrypting twice must use different nonces")
+	}
+
+	a := Account{Name: "alice", Password: encrypted}
+	if plain, err := a.Decrypt(key); err != nil || plain != "password" {
+		t.Errorf("Got: %q, error: %v / Expected: password", plain, err)
+	}
+
+	if _, err := a.Decrypt(otherKey); err == nil {
+		t.Error("Got: no error / Expected: decrypting with another key fails")
+	}
+
+	// The password of alice must not work for bob.
+	b := Account{Name: "bob", Password: encrypted}
+	if _, err := b.Decrypt(key); err == nil {
+		t.Error("Got: no error / Expected: decrypting for another account fails")
+	}
+}
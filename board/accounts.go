@@ -0,0 +1,37 @@
+package board
+
+import (
+	"net/http"
+
+	"github.com/githubixx/pinbackup/account"
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// accountSummary is an account without its credentials.
+type accountSummary struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// listAccounts returns the Pinterest accounts boards can be queued with.
+func listAccounts(w http.ResponseWriter, r *http.Request) {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	accounts, err := account.List(conn)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	summaries := []accountSummary{}
+	for _, a := range accounts {
+		summaries = append(summaries, accountSummary{Name: a.Name, Email: a.Email})
+	}
+
+	respondJSON(w, http.StatusOK, summaries)
+}
@@ -0,0 +1,90 @@
+package board
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/githubixx/pinbackup/job"
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// listArtifacts returns the artifacts captured for troubleshooting a job
+// e.g. a screenshot of the page the scraper failed on.
+func listArtifacts(w http.ResponseWriter, r *http.Request) {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	uuid := mux.Vars(r)["uuid"]
+	if _, err := job.Get(conn, uuid); err != nil {
+		respondJobError(w, err)
+		return
+	}
+
+	artifacts, err := job.ListArtifacts(conn, uuid)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, artifacts)
+}
+
+// getArtifact returns the content of an artifact. It's always served as
+// download as the captured DOM of Pinterest must not run in the origin of
+// the API.
+func getArtifact(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !job.ValidArtifactName(name) {
+		respondError(w, http.StatusBadRequest, errors.New("getArtifact failed: Invalid artifact name"))
+		return
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	uuid := mux.Vars(r)["uuid"]
+	if _, err := job.Get(conn, uuid); err != nil {
+		respondJobError(w, err)
+		return
+	}
+
+	data, err := job.GetArtifact(conn, uuid, name)
+	if err == job.ErrArtifactNotFound {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", job.ArtifactContentType(name))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", uuid+"-"+name))
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// respondJobError responds with 404 if the job doesn't exist.
+func respondJobError(w http.ResponseWriter, err error) {
+	if err == job.ErrNotFound {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+
+	respondError(w, http.StatusBadRequest, err)
+}
@@ -0,0 +1,127 @@
+package board
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/token"
+)
+
+type contextKey string
+
+const (
+	// tokenContextKey is used to store the authenticated token in the
+	// request context.
+	tokenContextKey contextKey = "token"
+	// lookupContextKey is used to store the result of looking up the token
+	// of a request in the request context.
+	lookupContextKey contextKey = "lookup"
+)
+
+// tokenLookup is the result of looking up the API token of a request.
+type tokenLookup struct {
+	token *token.Token
+	err   error
+}
+
+// bearerToken extracts the token from a "Authorization: Bearer <token>"
+// header.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", errors.New("Authorization header missing")
+	}
+
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return "", errors.New("Authorization header must be: Bearer <token>")
+	}
+
+	return strings.TrimSpace(parts[1]), nil
+}
+
+// lookupToken returns the API token plain of request r. The token is only
+// looked up in Redis if tokenMiddleware didn't do it already.
+func lookupToken(r *http.Request, plain string) (*token.Token, error) {
+	if lookup, ok := r.Context().Value(lookupContextKey).(*tokenLookup); ok {
+		return lookup.token, lookup.err
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return token.Lookup(conn, plain)
+}
+
+// tokenMiddleware looks up the API token of a request once for the rate
+// limit and requireScope.
+func tokenMiddleware(config *Config) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			plain, err := bearerToken(r)
+			if err != nil || (config.AuthDisabled && config.RateLimit <= 0) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			t, err := lookupToken(r, plain)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), lookupContextKey, &tokenLookup{t, err})))
+		})
+	}
+}
+
+// requestToken returns the API token of an authenticated request or nil if
+// authentication is disabled.
+func requestToken(ctx context.Context) *token.Token {
+	t, _ := ctx.Value(tokenContextKey).(*token.Token)
+	return t
+}
+
+// requireScope wraps handler so that it's only called if the request
+// contains a valid API token that was granted scope. If authentication is
+// disabled the handler is always called.
+func requireScope(config *Config, scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.AuthDisabled {
+			handler(w, r)
+			return
+		}
+
+		plain, err := bearerToken(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pinbackup"`)
+			respondError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		t, err := lookupToken(r, plain)
+		if err == token.ErrInvalidToken {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pinbackup", error="invalid_token"`)
+			respondError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !t.HasScope(scope) {
+			log.Info().
+				Str("method", "requireScope").
+				Msgf("Token %s lacks scope %s", t.ID, scope)
+			respondError(w, http.StatusForbidden, errors.Errorf("Token lacks scope %s", scope))
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey, t)))
+	}
+}
@@ -1,21 +1,32 @@
 package board
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
 	"strings"
 
+	"github.com/githubixx/pinbackup/account"
+	"github.com/githubixx/pinbackup/job"
+	"github.com/githubixx/pinbackup/metrics"
 	redisClient "github.com/githubixx/pinbackup/redis"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
 )
 
 // Board contains the raw Pinterest URL, hostname, user, board path,
-// path segments and a UUID.
+// path segments and a UUID. Existing is set if the board already had an
+// active job whose UUID is returned instead of queuing the board again.
+// Source is set if the URL points to a page of a profile instead of a
+// board e.g. SourceSaved. Parent is the UUID of the job of the page the
+// board was found on. Account is the name of the Pinterest account the
+// board is scraped with. The default login of the scraper is used if it's
+// empty.
 type Board struct {
 	RawURL       string   `json:"url"`
 	Host         string   `json:"host"`
@@ -23,6 +34,10 @@ type Board struct {
 	Path         string   `json:"path"`
 	PathSegments []string `json:"pathsegments"`
 	UUID         string   `json:"uuid"`
+	Existing     bool     `json:"existing,omitempty"`
+	Source       string   `json:"source,omitempty"`
+	Parent       string   `json:"parent,omitempty"`
+	Account      string   `json:"account,omitempty"`
 }
 
 // respondJSON takes a http.ResponseWriter, a HTTP status code and the
@@ -100,6 +115,9 @@ func parseUser(path string) (string, error) {
 	if user == "" {
 		return "", errors.New("Parse user failed: Username missing")
 	}
+	if user == redisClient.ReservedUser {
+		return "", errors.Errorf("Parse user failed: User %s is reserved", user)
+	}
 
 	return user, nil
 }
@@ -158,95 +176,251 @@ func parsePathSegments(path string) ([]string, error) {
 	return splittedPath, nil
 }
 
-// EnqueueBoard publishes a new board to Redis Pub/Sub. It's the entrypoint
-// for every scrape request.
-func enqueueBoard(w http.ResponseWriter, r *http.Request) {
+// parseBoard splits a raw Pinterest board URL into all parts needed by the
+// scraper.
+func parseBoard(rawURL string) (*Board, error) {
 	var err error
 
-	log.Trace().
-		Str("method", "EnqueueBoard").
-		Msg("Getting Redis connection")
-
-	conn, err := redisClient.GetConnection()
-	if err != nil {
-		respondError(w, http.StatusBadRequest, err)
-		return
-	}
-	defer conn.Close()
-
-	// Create new empty board struct
-	board := Board{}
-
-	// Decode request
-	log.Trace().
-		Str("method", "EnqueueBoard").
-		Msg("Decoding JSON request")
-
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&board); err != nil {
-		respondError(w, http.StatusBadRequest, errors.New("EnqueueBoard failed: Can't decode JSON request"))
-		return
-	}
-	defer r.Body.Close()
-	log.Info().
-		Str("method", "EnqueueBoard").
-		Msgf("Incoming request: %v", board)
+	board := &Board{RawURL: rawURL}
 
 	// Split submitted raw URL in all parts needed later
 	parsedURL, err := url.Parse(board.RawURL)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, errors.New("EnqueueBoard failed: Invalid URL"))
-		return
+		return nil, errors.New("Invalid URL")
 	}
 
 	if parsedURL.Host == "" {
-		respondError(w, http.StatusBadRequest, errors.New("EnqueueBoard failed: Invalid hostname"))
-		return
+		return nil, errors.New("Invalid hostname")
 	}
 	board.Host = parsedURL.Host
 
 	if parsedURL.Path == "" {
-		respondError(w, http.StatusBadRequest, errors.New("EnqueueBoard failed: Invalid path"))
-		return
+		return nil, errors.New("Invalid path")
 	}
 	board.Path = parsedURL.Path
 
 	// Extract the username part of the URL
 	board.User, err = parseUser(parsedURL.Path)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err)
-		return
+		return nil, err
 	}
 
 	// Extract the path
 	board.Path, err = parsePath(parsedURL.Path)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err)
-		return
+		return nil, err
 	}
 
 	// The board path either consists only of one part or more parts in case
 	// of sections.
 	board.PathSegments, err = parsePathSegments(board.Path)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err)
-		return
+		return nil, err
 	}
 
+	if IsSourcePage(append([]string{board.User}, board.PathSegments...)) {
+		board.Source = sourcePages[board.PathSegments[0]]
+	}
+
+	return board, nil
+}
+
+// publishBoard assigns a UUID to the board, creates the job and publishes
+// the board to the boards queue to be further processed by the scraper. If
+// the board already has an active job it isn't published again. Instead
+// board gets the UUID of the active job and Existing is set. tokenID is the
+// ID of the API token the job is created with. The token may have at most
+// maxActiveJobs active jobs. 0 disables the limit.
+func publishBoard(conn redis.Conn, board *Board, tokenID string, maxActiveJobs int) error {
 	// Generate UUID
 	board.UUID = strings.ToLower(uuid.NewV4().String())
 
+	log.Debug().
+		Str("method", "publishBoard").
+		Msgf("EnqueueBoard: %v", board)
+
+	active, err := job.CreateOrGetActive(conn, &job.Job{
+		UUID:    board.UUID,
+		URL:     board.RawURL,
+		Host:    board.Host,
+		User:    board.User,
+		Path:    board.Path,
+		Token:   tokenID,
+		Source:  board.Source,
+		Parent:  board.Parent,
+		Account: board.Account,
+	}, maxActiveJobs)
+	if err == job.ErrJobLimit {
+		return errJobLimit{errors.Errorf("Token has reached the limit of %d active jobs. Wait until some of them are done", maxActiveJobs)}
+	}
+	if err != nil {
+		return err
+	}
+
+	if active != board.UUID {
+		// The active job doesn't see what the account of the board
+		// sees e.g. its secret boards.
+		activeJob, err := job.Get(conn, active)
+		if err != nil {
+			return err
+		}
+		if activeJob.Account != board.Account {
+			return errAccountConflict{errors.Errorf("Board %s:%s already has active job %s with %s", board.User, board.Path, active, accountDescription(activeJob.Account))}
+		}
+
+		log.Info().
+			Str("method", "publishBoard").
+			Msgf("Board %s:%s already has active job %s", board.User, board.Path, active)
+		board.UUID = active
+		board.Existing = true
+		return nil
+	}
+
 	// Convert board to scrape into JSON and publish the request
 	// to Redis Pub/Sub to be further processed by the scraper.
-	log.Debug().
+	message, _ := json.Marshal(board)
+	if err := redisClient.Publish(conn, "boards", []byte(message)); err != nil {
+		return err
+	}
+	metrics.BoardsEnqueued.Inc()
+
+	return nil
+}
+
+// publishStatus returns the HTTP status code of a published board. Boards
+// that already had an active job weren't created.
+func publishStatus(board *Board) int {
+	if board.Existing {
+		return http.StatusOK
+	}
+
+	return http.StatusCreated
+}
+
+// requestTokenID returns the ID of the API token of the request or "" if
+// authentication is disabled.
+func requestTokenID(ctx context.Context) string {
+	if t := requestToken(ctx); t != nil {
+		return t.ID
+	}
+
+	return ""
+}
+
+// errInvalidBoard marks errors caused by the URL of a board.
+type errInvalidBoard struct {
+	err error
+}
+
+func (e errInvalidBoard) Error() string {
+	return e.err.Error()
+}
+
+// errAccountConflict is returned if a board already has an active job
+// with another account.
+type errAccountConflict struct {
+	err error
+}
+
+func (e errAccountConflict) Error() string {
+	return e.err.Error()
+}
+
+// IsAccountConflict returns true if err was returned because the board
+// already has an active job with another account.
+func IsAccountConflict(err error) bool {
+	_, ok := err.(errAccountConflict)
+	return ok
+}
+
+// accountDescription names the account a job is scraped with.
+func accountDescription(name string) string {
+	if name == "" {
+		return "the default account"
+	}
+
+	return "account " + name
+}
+
+// enqueueURL normalizes rawURL and publishes the board to be scraped with
+// the account accountName. Errors caused by an invalid URL or an unknown
+// account are of type errInvalidBoard.
+func enqueueURL(ctx context.Context, conn redis.Conn, rawURL string, accountName string) (*Board, error) {
+	normalizedURL, err := normalizeURL(ctx, rawURL)
+	if err != nil {
+		return nil, errInvalidBoard{err}
+	}
+
+	board, err := parseBoard(normalizedURL)
+	if err != nil {
+		return nil, errInvalidBoard{err}
+	}
+
+	if accountName != "" {
+		exists, err := account.Exists(conn, accountName)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, errInvalidBoard{errors.Errorf("Account %s doesn't exist", accountName)}
+		}
+		board.Account = accountName
+	}
+
+	if err := publishBoard(conn, board, requestTokenID(ctx), maxActiveJobs(ctx)); err != nil {
+		return nil, err
+	}
+
+	return board, nil
+}
+
+// EnqueueBoard publishes a new board to Redis Pub/Sub. It's the entrypoint
+// for every scrape request.
+func enqueueBoard(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	log.Trace().
 		Str("method", "EnqueueBoard").
-		Msgf("EnqueueBoard: %v", board)
+		Msg("Getting Redis connection")
 
-	response, _ := json.Marshal(board)
-	if err := redisClient.Publish(conn, "boards", []byte(response)); err != nil {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
 		respondError(w, http.StatusBadRequest, err)
 		return
 	}
+	defer conn.Close()
+
+	// Create new empty board struct
+	request := Board{}
+
+	// Decode request
+	log.Trace().
+		Str("method", "EnqueueBoard").
+		Msg("Decoding JSON request")
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&request); err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("EnqueueBoard failed: Can't decode JSON request"))
+		return
+	}
+	defer r.Body.Close()
+	log.Info().
+		Str("method", "EnqueueBoard").
+		Msgf("Incoming request: %v", request)
+
+	board, err := enqueueURL(r.Context(), conn, request.RawURL, request.Account)
+	if IsJobLimit(err) {
+		respondTooManyRequests(w, jobLimitRetryAfter, err)
+		return
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if IsAccountConflict(err) {
+			status = http.StatusConflict
+		}
+		respondError(w, status, errors.Wrap(err, "EnqueueBoard failed"))
+		return
+	}
 
-	respondJSON(w, http.StatusCreated, board)
+	respondJSON(w, publishStatus(board), board)
 }
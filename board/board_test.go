@@ -1,7 +1,20 @@
 package board
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/githubixx/pinbackup/openapi"
+	"github.com/githubixx/pinbackup/storage"
+	"github.com/githubixx/pinbackup/token"
 )
 
 type testBoards struct {
@@ -37,6 +50,7 @@ func TestTrimPath(t *testing.T) {
 func TestParseUserError(t *testing.T) {
 	var testUserError = []testBoards{
 		{"", "Parse user failed: Received empty path"},
+		{"/pinbackup/users/", "Parse user failed: User pinbackup is reserved"},
 	}
 
 	for _, user := range testUserError {
@@ -90,3 +104,428 @@ func TestPathSegments(t *testing.T) {
 		}
 	}
 }
+
+func TestParseBoardSource(t *testing.T) {
+	var testURLs = []struct {
+		rawURL   string
+		source   string
+		resolves bool
+	}{
+		{"https://www.pinterest.com/user1/board/", "", false},
+		{"https://www.pinterest.com/user1/pins/", SourcePins, false},
+		{"https://www.pinterest.com/user1/_saved/", SourceSaved, true},
+		{"https://www.pinterest.com/user1/following/", SourceFollowing, true},
+		{"https://www.pinterest.com/user1/board/pins/", "", false},
+	}
+
+	for _, tu := range testURLs {
+		b, err := parseBoard(tu.rawURL)
+		if err != nil || b.Source != tu.source || b.ResolvesBoards() != tu.resolves {
+			t.Errorf("%s: Got: %v, error: %v / Expected: source %q, resolves boards %t", tu.rawURL, b, err, tu.source, tu.resolves)
+		}
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	var testHeaders = []struct {
+		header string
+		token  string
+		valid  bool
+	}{
+		{"Bearer pb_123", "pb_123", true},
+		{"bearer pb_123", "pb_123", true},
+		{"Bearer  pb_123 ", "pb_123", true},
+		{"", "", false},
+		{"Bearer", "", false},
+		{"Bearer ", "", false},
+		{"Basic dXNlcjpwYXNz", "", false},
+	}
+
+	for _, th := range testHeaders {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/board", nil)
+		if th.header != "" {
+			r.Header.Set("Authorization", th.header)
+		}
+
+		token, err := bearerToken(r)
+		if (err == nil) != th.valid {
+			t.Errorf("Header '%s': Got error: %v / Expected valid: %t", th.header, err, th.valid)
+		}
+		if token != th.token {
+			t.Errorf("Header '%s': Got token: %s / Expected: %s", th.header, token, th.token)
+		}
+	}
+}
+
+func TestRateClientUsesLookup(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/board", nil)
+	r.Header.Set("Authorization", "Bearer pb_123")
+
+	// Without Redis only the result of tokenMiddleware can be used.
+	lookup := &tokenLookup{token: &token.Token{ID: "token1"}}
+	r = r.WithContext(context.WithValue(r.Context(), lookupContextKey, lookup))
+	if client := rateClient(&Config{}, r); client != "token:token1" {
+		t.Errorf("Got: %s / Expected: %s", client, "token:token1")
+	}
+
+	lookup.token, lookup.err = nil, token.ErrInvalidToken
+	if client := rateClient(&Config{}, r); client != "ip:192.0.2.1" {
+		t.Errorf("Got: %s / Expected: %s", client, "ip:192.0.2.1")
+	}
+}
+
+func TestPathFromURL(t *testing.T) {
+	var testURLs = []testBoards{
+		{"https://www.pinterest.com/user1/board/", "/user1/board/"},
+		{"https://www.pinterest.de/user1/board", "/user1/board/"},
+		{"https://www.pinterest.com/user2/board/section1/", "/user2/board/section1/"},
+	}
+
+	for _, tu := range testURLs {
+		path, err := pathFromURL(tu.input)
+		if err != nil {
+			t.Errorf("URL %s: Unexpected error: %s", tu.input, err.Error())
+		}
+		if path != tu.result {
+			t.Errorf("Got path: %s / Expected: %s", path, tu.result)
+		}
+	}
+
+	for _, invalid := range []string{"", "/user1/board/", "https://www.pinterest.com/user1"} {
+		if _, err := pathFromURL(invalid); err == nil {
+			t.Errorf("URL '%s' should be invalid", invalid)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := Routes(&Config{CORSOrigins: []string{"https://www.pinterest.com"}})
+
+	var testOrigins = []struct {
+		origin      string
+		allowOrigin string
+	}{
+		{"https://www.pinterest.com", "https://www.pinterest.com"},
+		{"https://evil.example.com", ""},
+	}
+
+	for _, to := range testOrigins {
+		r := httptest.NewRequest(http.MethodOptions, "/api/v1/board", nil)
+		r.Header.Set("Origin", to.origin)
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, r)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("Origin %s: Got status code: %d / Expected: %d", to.origin, rec.Code, http.StatusNoContent)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != to.allowOrigin {
+			t.Errorf("Origin %s: Got Access-Control-Allow-Origin: %s / Expected: %s", to.origin, got, to.allowOrigin)
+		}
+	}
+}
+
+func TestUUIDFilter(t *testing.T) {
+	var testFilters = []struct {
+		query string
+		uuids []string
+	}{
+		{"", []string{}},
+		{"uuid=a", []string{"a"}},
+		{"uuid=a&uuid=b", []string{"a", "b"}},
+		{"uuid=a,B,%20c", []string{"a", "b", "c"}},
+	}
+
+	for _, tf := range testFilters {
+		filter := uuidFilter(httptest.NewRequest(http.MethodGet, "/api/v1/events?"+tf.query, nil))
+		if len(filter) != len(tf.uuids) {
+			t.Errorf("Query '%s': Got %d UUIDs / Expected: %d", tf.query, len(filter), len(tf.uuids))
+		}
+		for _, uuid := range tf.uuids {
+			if _, ok := filter[uuid]; !ok {
+				t.Errorf("Query '%s': UUID %s missing in filter", tf.query, uuid)
+			}
+		}
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	var testPages = []struct {
+		query  string
+		cursor string
+		count  int
+		valid  bool
+	}{
+		{"", "0", defaultPageSize, true},
+		{"cursor=42", "42", defaultPageSize, true},
+		{"cursor=42&count=10", "42", 10, true},
+		{"count=1000", "0", 1000, true},
+		{"count=1001", "", 0, false},
+		{"count=0", "", 0, false},
+		{"count=x", "", 0, false},
+		{"cursor=-1", "", 0, false},
+		{"cursor=abc", "", 0, false},
+	}
+
+	for _, tp := range testPages {
+		cursor, count, err := pageParams(httptest.NewRequest(http.MethodGet, "/api/v1/users?"+tp.query, nil))
+		if (err == nil) != tp.valid {
+			t.Errorf("Query '%s': Got error: %v / Expected valid: %t", tp.query, err, tp.valid)
+			continue
+		}
+		if cursor != tp.cursor || count != tp.count {
+			t.Errorf("Query '%s': Got cursor: %s, count: %d / Expected: %s, %d", tp.query, cursor, count, tp.cursor, tp.count)
+		}
+	}
+}
+
+func TestBoolParam(t *testing.T) {
+	var testParams = []struct {
+		query string
+		value bool
+		valid bool
+	}{
+		{"", false, true},
+		{"purge=true", true, true},
+		{"purge=1", true, true},
+		{"purge=false", false, true},
+		{"purge=yes", false, false},
+	}
+
+	for _, tp := range testParams {
+		value, err := boolParam(httptest.NewRequest(http.MethodDelete, "/api/v1/board/user1/board?"+tp.query, nil), "purge")
+		if (err == nil) != tp.valid || value != tp.value {
+			t.Errorf("Query '%s': Got value: %t, error: %v / Expected: %t, valid: %t", tp.query, value, err, tp.value, tp.valid)
+		}
+	}
+}
+
+func TestBoardVars(t *testing.T) {
+	var testVars = []struct {
+		user  string
+		board string
+		valid bool
+	}{
+		{"user1", "board", true},
+		{"user1", "board%2Fsection", true},
+		{"", "board", false},
+		{"pinbackup", "users", false},
+		{"user1%3Aboard", "board", false},
+		{"user1", "board:section", false},
+		{"user1", "board%3Asection", false},
+		{"user1", "%zz", false},
+	}
+
+	for _, tv := range testVars {
+		r := httptest.NewRequest(http.MethodDelete, "/api/v1/board", nil)
+		r = mux.SetURLVars(r, map[string]string{"user": tv.user, "board": tv.board})
+		_, _, err := boardVars(r)
+		if (err == nil) != tv.valid {
+			t.Errorf("%s/%s: Got error: %v / Expected: valid %t", tv.user, tv.board, err, tv.valid)
+		}
+	}
+}
+
+func TestExportBoard(t *testing.T) {
+	fs, err := storage.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range [][]string{
+		{"board", "a.jpg"},
+		{"board", storage.BoardMetaFile},
+		{"board/section", "b.jpg"},
+		{"board/section", storage.BoardMetaFile},
+		{"boardx", "c.jpg"},
+	} {
+		w, err := fs.Create("user1", file[0], file[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(file[1]))
+		w.Close()
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/board/user1/board/export", nil)
+	r = mux.SetURLVars(r, map[string]string{"user": "user1", "board": "board"})
+	rec := httptest.NewRecorder()
+	exportBoard(&Config{Storage: fs})(rec, r)
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Got: %s / Expected: ZIP archive", err)
+	}
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	expected := []string{"a.jpg", storage.BoardMetaFile, "section/b.jpg", "section/" + storage.BoardMetaFile}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Got: %v / Expected: %v", names, expected)
+	}
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	router := Routes(&Config{AuthDisabled: true})
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			if method != http.MethodOptions && !openapi.HasOperation(method, template) {
+				t.Errorf("%s %s: Operation missing in OpenAPI specification", method, template)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateMiddleware(t *testing.T) {
+	var testRequests = []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodPost, "/api/v1/board", ""},
+		{http.MethodPost, "/api/v1/board", `{"url": 42}`},
+		{http.MethodPost, "/api/v1/board", `{"host": "www.pinterest.com"}`},
+		{http.MethodPost, "/api/v1/existsboard", `{"path": ""}`},
+		{http.MethodGet, "/api/v1/boardstatus", ""},
+		{http.MethodGet, "/api/v1/jobs?limit=0", ""},
+		{http.MethodGet, "/api/v1/users?count=5000", ""},
+		{http.MethodGet, "/api/v1/users?cursor=abc", ""},
+		{http.MethodDelete, "/api/v1/board/user1/board?purge=maybe", ""},
+	}
+
+	router := Routes(&Config{AuthDisabled: true})
+
+	for _, tr := range testRequests {
+		r := httptest.NewRequest(tr.method, tr.target, strings.NewReader(tr.body))
+		rec := httptest.NewRecorder()
+
+		router.ServeHTTP(rec, r)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: Got status code: %d / Expected: %d", tr.method, tr.target, tr.body, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	defer func(resolve func(context.Context, string) (string, error)) {
+		resolveShortLink = resolve
+	}(resolveShortLink)
+
+	resolveShortLink = func(ctx context.Context, rawURL string) (string, error) {
+		if rawURL == "https://pin.it/abc" {
+			return "https://www.pinterest.de/user1/board/?invite_code=123", nil
+		}
+		return rawURL, nil
+	}
+
+	var testURLs = []struct {
+		rawURL string
+		result string
+		valid  bool
+	}{
+		{"https://www.pinterest.com/user1/board/", "https://www.pinterest.com/user1/board/", true},
+		{"https://www.pinterest.com/user1/board", "https://www.pinterest.com/user1/board/", true},
+		{" pinterest.de/user1/board/?utm_source=x#top ", "https://www.pinterest.com/user1/board/", true},
+		{"http://de.pinterest.com/user1/board/section1/", "https://www.pinterest.com/user1/board/section1/", true},
+		{"https://www.pinterest.co.uk/user1/board/", "https://www.pinterest.com/user1/board/", true},
+		{"https://pinterest.com.au/user1/b%C3%A4r/", "https://www.pinterest.com/user1/b%C3%A4r/", true},
+		{"https://pin.it/abc", "https://www.pinterest.com/user1/board/", true},
+		{"https://pin.it/unresolved", "", false},
+		{"", "", false},
+		{"ftp://www.pinterest.com/user1/board/", "", false},
+		{"https://www.example.com/user1/board/", "", false},
+		{"https://www.pinterest.com.evil.com/user1/board/", "", false},
+		{"https://www.pinterest.com/pin/123456/", "", false},
+		{"https://www.pinterest.com/search/pins/?q=cats", "", false},
+		{"https://www.pinterest.com/user1/", "", false},
+		{"https://www.pinterest.com/user1/_saved/", "https://www.pinterest.com/user1/_saved/", true},
+		{"https://www.pinterest.de/user1/pins", "https://www.pinterest.com/user1/pins/", true},
+		{"https://www.pinterest.com/user1/following/", "https://www.pinterest.com/user1/following/", true},
+		{"https://www.pinterest.com/pinbackup/users/", "", false},
+		{"https://www.pinterest.com/user1/_created/", "", false},
+		{"https://www.pinterest.com/user1/_saved/board/", "", false},
+		{"https://www.pinterest.com/user1/board/section1/more/", "", false},
+	}
+
+	for _, tu := range testURLs {
+		result, err := normalizeURL(context.Background(), tu.rawURL)
+		if (err == nil) != tu.valid || result != tu.result {
+			t.Errorf("%s: Got: %s, error: %v / Expected: %s, valid: %t", tu.rawURL, result, err, tu.result, tu.valid)
+		}
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	var testAddrs = []struct {
+		remoteAddr        string
+		forwardedFor      string
+		trustForwardedFor bool
+		result            string
+	}{
+		{"192.0.2.1:51234", "", false, "192.0.2.1"},
+		{"[2001:db8::1]:51234", "", false, "2001:db8::1"},
+		{"192.0.2.1:51234", "198.51.100.7", false, "192.0.2.1"},
+		{"192.0.2.1:51234", "198.51.100.7, 192.0.2.1", true, "198.51.100.7"},
+		{"192.0.2.1:51234", "", true, "192.0.2.1"},
+		{"unix", "", false, "unix"},
+	}
+
+	for _, test := range testAddrs {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+
+		result := clientAddr(r, test.trustForwardedFor)
+		if result != test.result {
+			t.Errorf("Got: %s / Expected: %s", result, test.result)
+		}
+	}
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	var testBodies = []struct {
+		body          string
+		contentLength int64
+		status        int
+	}{
+		{`{"url": "x"}`, 12, http.StatusOK},
+		{`{"url": "https://www.pinterest.com/user/board/"}`, 48, http.StatusRequestEntityTooLarge},
+		// Chunked requests have no Content-Length
+		{`{"url": "https://www.pinterest.com/user/board/"}`, -1, http.StatusRequestEntityTooLarge},
+		{`{"url": "x"}`, -1, http.StatusOK},
+	}
+
+	handler := bodyLimitMiddleware(&Config{MaxBodySize: 20})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, test := range testBodies {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/board", strings.NewReader(test.body))
+		r.ContentLength = test.contentLength
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("Got: %d / Expected: %d for body %s (Content-Length %d)", w.Code, test.status, test.body, test.contentLength)
+		}
+	}
+}
@@ -0,0 +1,607 @@
+package board
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/job"
+	redisClient "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/storage"
+)
+
+// defaultJobsLimit is the number of jobs returned by listJobs if no limit
+// is requested.
+const defaultJobsLimit = 50
+
+// defaultPageSize is the number of items requested from Redis per page if
+// no count is requested. Redis only treats it as a hint so pages may
+// contain more or less items. maxPageSize limits the count a client can
+// request.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// pictureMaxAge is how long clients may cache picture bytes. Pinterest
+// picture filenames are derived from the content so a picture never
+// changes without getting a new name.
+const pictureMaxAge = 7 * 24 * time.Hour
+
+// defaultHost is used to build the URL of a board that is synced again.
+const defaultHost = "www.pinterest.com"
+
+// page is a single page of a list. Next is the cursor of the next page and
+// empty on the last page.
+type page struct {
+	Items interface{} `json:"items"`
+	Next  string      `json:"next,omitempty"`
+}
+
+type boardSummary struct {
+	Path     string `json:"path"`
+	Count    int    `json:"count"`
+	LastSync int64  `json:"lastsync"`
+}
+
+type pinDetails struct {
+	Name       string    `json:"name"`
+	User       string    `json:"user"`
+	Path       string    `json:"path"`
+	InRedis    bool      `json:"inredis"`
+	InStorage  bool      `json:"instorage"`
+	URL        string    `json:"url,omitempty"`
+	UUID       string    `json:"uuid,omitempty"`
+	Downloaded int64     `json:"downloaded,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	ModTime    time.Time `json:"modtime,omitempty"`
+}
+
+type boardVerification struct {
+	User             string   `json:"user"`
+	Path             string   `json:"path"`
+	OK               bool     `json:"ok"`
+	MissingInStorage []string `json:"missinginstorage"`
+	MissingInRedis   []string `json:"missinginredis"`
+}
+
+// boardKey returns the Redis key of a board. It's the same key prepareKey
+// generates for "/user/board/".
+func boardKey(user string, board string) string {
+	return user + ":" + board
+}
+
+// boardVars returns the user and the board path of a request. The board
+// path is URL encoded in the request as it contains "/" for sections. ":"
+// separates user and board in Redis keys so it's neither allowed in the
+// user nor in the board. The reserved user would address internal keys.
+func boardVars(r *http.Request) (string, string, error) {
+	vars := mux.Vars(r)
+
+	user, err := url.PathUnescape(vars["user"])
+	if err != nil || user == "" || user == redisClient.ReservedUser || strings.Contains(user, ":") {
+		return "", "", errors.New("Invalid user")
+	}
+
+	board, err := url.PathUnescape(vars["board"])
+	if err != nil || strings.Contains(board, ":") {
+		return "", "", errors.New("Invalid board")
+	}
+
+	return user, board, nil
+}
+
+// pageParams returns the cursor and the page size requested by the
+// "cursor" and "count" query parameters.
+func pageParams(r *http.Request) (string, int, error) {
+	cursor := r.URL.Query().Get("cursor")
+	if cursor == "" {
+		cursor = "0"
+	} else if _, err := strconv.ParseUint(cursor, 10, 64); err != nil {
+		return "", 0, errors.New("Invalid cursor")
+	}
+
+	count := defaultPageSize
+	if c := r.URL.Query().Get("count"); c != "" {
+		n, err := strconv.Atoi(c)
+		if err != nil || n < 1 || n > maxPageSize {
+			return "", 0, errors.Errorf("Invalid count: Must be between 1 and %d", maxPageSize)
+		}
+		count = n
+	}
+
+	return cursor, count, nil
+}
+
+// newPage returns a page with items. next is the cursor returned by Redis
+// which is "0" after the last page.
+func newPage(items interface{}, next string) page {
+	if next == "0" {
+		next = ""
+	}
+
+	return page{Items: items, Next: next}
+}
+
+// pictureETag returns the entity tag of a stored picture.
+func pictureETag(picture *storage.Picture) string {
+	return fmt.Sprintf(`"%x-%x"`, picture.Size, picture.ModTime.UnixNano())
+}
+
+// respondStorageError maps storage errors to HTTP status codes.
+func respondStorageError(w http.ResponseWriter, err error) {
+	if err == storage.ErrNotExist {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+
+	respondError(w, http.StatusBadRequest, err)
+}
+
+// listJobs returns the latest jobs. The number of jobs can be limited by
+// the "limit" query parameter.
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	limit := defaultJobsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			respondError(w, http.StatusBadRequest, errors.New("listJobs failed: Invalid limit"))
+			return
+		}
+		limit = n
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	jobs, err := job.List(conn, limit)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, jobs)
+}
+
+// getJob returns a single job.
+func getJob(w http.ResponseWriter, r *http.Request) {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	j, err := job.Get(conn, mux.Vars(r)["uuid"])
+	if err == job.ErrNotFound {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, j)
+}
+
+// listUsers returns a page of users with backed up boards.
+func listUsers(w http.ResponseWriter, r *http.Request) {
+	cursor, count, err := pageParams(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	users, next, err := redisClient.ScanUsers(conn, cursor, count)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	if users == nil {
+		users = []string{}
+	}
+
+	respondJSON(w, http.StatusOK, newPage(users, next))
+}
+
+// listBoards returns a page of boards of a user together with the number
+// of pictures stored in Redis and the time of the last finished sync.
+func listBoards(w http.ResponseWriter, r *http.Request) {
+	user, err := url.PathUnescape(mux.Vars(r)["user"])
+	if err != nil || user == "" {
+		respondError(w, http.StatusBadRequest, errors.New("Invalid user"))
+		return
+	}
+
+	cursor, count, err := pageParams(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	boards, next, err := redisClient.ScanBoards(conn, user, cursor, count)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	summaries := []boardSummary{}
+	for _, board := range boards {
+		count, err := redisClient.CountPictures(conn, boardKey(user, board.Path))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		summaries = append(summaries, boardSummary{Path: board.Path, Count: count, LastSync: board.LastSync})
+	}
+
+	respondJSON(w, http.StatusOK, newPage(summaries, next))
+}
+
+// listPins returns a page of the picture names of a board stored in Redis.
+func listPins(w http.ResponseWriter, r *http.Request) {
+	user, board, err := boardVars(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cursor, count, err := pageParams(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	pictures, next, err := redisClient.ScanPictures(conn, boardKey(user, board), cursor, count)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	if pictures == nil {
+		pictures = []string{}
+	}
+
+	respondJSON(w, http.StatusOK, newPage(pictures, next))
+}
+
+// getPin returns the metadata of a single picture collected from Redis and
+// the storage backend.
+func getPin(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, board, err := boardVars(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		name := mux.Vars(r)["pin"]
+
+		conn, err := redisClient.GetConnection()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer conn.Close()
+
+		details := pinDetails{Name: name, User: user, Path: board}
+
+		details.InRedis, err = redisClient.IsPicture(conn, boardKey(user, board), name)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		info, err := redisClient.GetPictureInfo(conn, user, board, name)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		if info != nil {
+			details.URL = info.URL
+			details.UUID = info.UUID
+			details.Downloaded = info.Downloaded
+		}
+
+		picture, err := config.Storage.Stat(user, board, name)
+		if err != nil && err != storage.ErrNotExist {
+			respondStorageError(w, err)
+			return
+		}
+		if picture != nil {
+			details.InStorage = true
+			details.Size = picture.Size
+			details.ModTime = picture.ModTime
+		}
+
+		if !details.InRedis && !details.InStorage {
+			respondError(w, http.StatusNotFound, errors.New("Pin not found"))
+			return
+		}
+
+		respondJSON(w, http.StatusOK, details)
+	}
+}
+
+// servePicture sends the bytes of a picture from the storage backend. The
+// response can be cached by the client and conditional requests are
+// answered with 304 Not Modified.
+func servePicture(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, board, err := boardVars(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		file, picture, err := config.Storage.Open(user, board, mux.Vars(r)["pin"])
+		if err != nil {
+			respondStorageError(w, err)
+			return
+		}
+		defer file.Close()
+
+		// The API requires a token so shared caches must not store pictures.
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(pictureMaxAge.Seconds())))
+		w.Header().Set("ETag", pictureETag(picture))
+		http.ServeContent(w, r, picture.Name, picture.ModTime, file)
+	}
+}
+
+// verifyBoard compares the pictures stored in Redis with the pictures in
+// the storage backend.
+func verifyBoard(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, board, err := boardVars(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		pictures, err := config.Storage.Pictures(user, board)
+		if err != nil && err != storage.ErrNotExist {
+			respondStorageError(w, err)
+			return
+		}
+
+		conn, err := redisClient.GetConnection()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer conn.Close()
+
+		stored, err := redisClient.Pictures(conn, boardKey(user, board))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		inStorage := make(map[string]struct{}, len(pictures))
+		for _, picture := range pictures {
+			inStorage[picture.Name] = struct{}{}
+		}
+		inRedis := make(map[string]struct{}, len(stored))
+		for _, name := range stored {
+			inRedis[name] = struct{}{}
+		}
+
+		result := boardVerification{
+			User:             user,
+			Path:             board,
+			MissingInStorage: []string{},
+			MissingInRedis:   []string{},
+		}
+		for name := range inRedis {
+			if _, ok := inStorage[name]; !ok {
+				result.MissingInStorage = append(result.MissingInStorage, name)
+			}
+		}
+		for name := range inStorage {
+			if _, ok := inRedis[name]; !ok {
+				result.MissingInRedis = append(result.MissingInRedis, name)
+			}
+		}
+		result.OK = len(result.MissingInStorage) == 0 && len(result.MissingInRedis) == 0
+
+		respondJSON(w, http.StatusOK, result)
+	}
+}
+
+// exportBoard streams all pictures of a board including its sections as
+// ZIP archive. The pictures of a section are stored in a directory named
+// like the section.
+func exportBoard(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, board, err := boardVars(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		pictures, err := config.Storage.Pictures(user, board)
+		if err != nil {
+			respondStorageError(w, err)
+			return
+		}
+
+		sections, err := boardSections(config.Storage, user, board)
+		if err != nil {
+			respondStorageError(w, err)
+			return
+		}
+
+		filename := fmt.Sprintf("%s-%s.zip", user, url.PathEscape(board))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		archive := zip.NewWriter(w)
+		if err := addBoardToArchive(config.Storage, archive, user, board, "", pictures); err != nil {
+			// Headers are already sent. All we can do is to stop and
+			// leave the client with a broken archive.
+			log.Error().
+				Str("method", "exportBoard").
+				Msgf("Export of %s failed: %s", boardKey(user, board), err.Error())
+			return
+		}
+
+		for _, section := range sections {
+			pictures, err := config.Storage.Pictures(user, section)
+			if err == nil {
+				err = addBoardToArchive(config.Storage, archive, user, section, strings.TrimPrefix(section, board+"/")+"/", pictures)
+			}
+			if err != nil {
+				log.Error().
+					Str("method", "exportBoard").
+					Msgf("Export of %s failed: %s", boardKey(user, section), err.Error())
+				return
+			}
+		}
+
+		if err := archive.Close(); err != nil {
+			log.Error().
+				Str("method", "exportBoard").
+				Msgf("Closing archive of %s failed: %s", boardKey(user, board), err.Error())
+		}
+	}
+}
+
+// boardSections returns the paths of all stored sections of board.
+func boardSections(s storage.Storage, user string, board string) ([]string, error) {
+	boards, err := s.Boards(user)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := []string{}
+	for _, b := range boards {
+		if strings.HasPrefix(b, board+"/") {
+			sections = append(sections, b)
+		}
+	}
+
+	return sections, nil
+}
+
+// addBoardToArchive copies the pictures and the metadata of a board into
+// the directory dir of a ZIP archive.
+func addBoardToArchive(s storage.Storage, archive *zip.Writer, user string, board string, dir string, pictures []storage.Picture) error {
+	for _, picture := range pictures {
+		if err := addToArchive(s, archive, user, board, dir, picture); err != nil {
+			return err
+		}
+	}
+
+	// The metadata of the board is part of the backup as well.
+	if meta, err := s.Stat(user, board, storage.BoardMetaFile); err == nil {
+		return addToArchive(s, archive, user, board, dir, *meta)
+	}
+
+	return nil
+}
+
+// addToArchive copies a picture from the storage backend into the directory
+// dir of a ZIP archive. Pictures are already compressed so they are only
+// stored.
+func addToArchive(s storage.Storage, archive *zip.Writer, user string, board string, dir string, picture storage.Picture) error {
+	file, _, err := s.Open(user, board, picture.Name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     dir + picture.Name,
+		Method:   zip.Store,
+		Modified: picture.ModTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, file)
+
+	return err
+}
+
+// resyncBoard enqueues an already backed up board again. It's scraped
+// with the account of its latest job like before.
+func resyncBoard(w http.ResponseWriter, r *http.Request) {
+	user, board, err := boardVars(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	b, err := parseBoard(fmt.Sprintf("https://%s/%s/%s/", defaultHost, user, board))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.Wrap(err, "resyncBoard failed"))
+		return
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	latest, err := job.Latest(conn, user, board)
+	if err != nil && err != job.ErrNotFound {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err == nil {
+		b.Account = latest.Account
+		b.Source = latest.Source
+	}
+
+	err = publishBoard(conn, b, requestTokenID(r.Context()), maxActiveJobs(r.Context()))
+	if IsJobLimit(err) {
+		respondTooManyRequests(w, jobLimitRetryAfter, err)
+		return
+	}
+	if IsAccountConflict(err) {
+		respondError(w, http.StatusConflict, errors.Wrap(err, "resyncBoard failed"))
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, publishStatus(b), b)
+}
@@ -0,0 +1,91 @@
+package board
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// maxBulkBoards is the maximum number of boards of a bulk request.
+const maxBulkBoards = 100
+
+// bulkResult is the result of a single board of a bulk request. Status is
+// the HTTP status code the board would have gotten as single request.
+type bulkResult struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Board  *Board `json:"board,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Queued  int          `json:"queued"`
+	Failed  int          `json:"failed"`
+	Results []bulkResult `json:"results"`
+}
+
+// enqueueBoards publishes several boards at once. Every board is handled on
+// its own so invalid URLs don't prevent the other boards from being queued.
+func enqueueBoards(w http.ResponseWriter, r *http.Request) {
+	requests := []Board{}
+	if err := json.NewDecoder(r.Body).Decode(&requests); err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("enqueueBoards failed: Can't decode JSON request"))
+		return
+	}
+	defer r.Body.Close()
+
+	if len(requests) == 0 || len(requests) > maxBulkBoards {
+		respondError(w, http.StatusBadRequest, errors.Errorf("enqueueBoards failed: Between 1 and %d boards allowed", maxBulkBoards))
+		return
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	response := bulkResponse{Results: []bulkResult{}}
+	for _, request := range requests {
+		result := bulkResult{URL: request.RawURL}
+
+		// Boards beyond the number of jobs the token may still create are
+		// rejected like single requests would be.
+		board, err := enqueueURL(r.Context(), conn, request.RawURL, request.Account)
+		switch err.(type) {
+		case nil:
+			result.Status = publishStatus(board)
+			result.Board = board
+			response.Queued++
+		case errInvalidBoard:
+			result.Status = http.StatusBadRequest
+			result.Error = err.Error()
+			response.Failed++
+		case errAccountConflict:
+			result.Status = http.StatusConflict
+			result.Error = err.Error()
+			response.Failed++
+		case errJobLimit:
+			result.Status = http.StatusTooManyRequests
+			result.Error = err.Error()
+			response.Failed++
+		default:
+			result.Status = http.StatusInternalServerError
+			result.Error = err.Error()
+			response.Failed++
+		}
+
+		response.Results = append(response.Results, result)
+	}
+
+	log.Info().
+		Str("method", "enqueueBoards").
+		Msgf("Queued %d boards, %d failed", response.Queued, response.Failed)
+
+	respondJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,63 @@
+package board
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	corsAllowedHeaders = "Authorization, Content-Type"
+	corsMaxAge         = 600
+)
+
+// originAllowed returns true if origin is in allowedOrigins or if
+// allowedOrigins contains "*".
+func originAllowed(allowedOrigins []string, origin string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// corsMiddleware adds CORS headers for all origins configured in
+// Config.CORSOrigins and answers preflight requests. Routes must also
+// accept the OPTIONS method for preflight requests to reach the middleware.
+// OPTIONS requests never reach the route handler.
+func corsMiddleware(config *Config) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowed := origin != "" && originAllowed(config.CORSOrigins, origin)
+
+			w.Header().Add("Vary", "Origin")
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			methods, err := mux.CurrentRoute(r).GetMethods()
+			if err != nil {
+				methods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+			}
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
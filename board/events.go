@@ -0,0 +1,139 @@
+package board
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/events"
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// eventsHeartbeat is the interval a comment is sent to the client to keep
+// the connection open through proxies.
+const eventsHeartbeat = 15 * time.Second
+
+// uuidFilter returns the set of job UUIDs passed as "uuid" query parameters.
+// Multiple UUIDs can be passed by repeating the parameter or as comma
+// separated list. An empty set means all jobs.
+func uuidFilter(r *http.Request) map[string]struct{} {
+	filter := map[string]struct{}{}
+
+	for _, value := range r.URL.Query()["uuid"] {
+		for _, uuid := range strings.Split(value, ",") {
+			if uuid = strings.TrimSpace(uuid); uuid != "" {
+				filter[strings.ToLower(uuid)] = struct{}{}
+			}
+		}
+	}
+
+	return filter
+}
+
+// streamEvents sends all job lifecycle events published by the scraper and
+// the downloader as Server-Sent Events. Events can be limited to certain
+// jobs with the "uuid" query parameter. Streams end when the server shuts
+// down.
+func streamEvents(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			respondError(w, http.StatusInternalServerError, errors.New("streamEvents failed: Streaming not supported"))
+			return
+		}
+
+		filter := uuidFilter(r)
+
+		log.Trace().
+			Str("method", "streamEvents").
+			Msg("Getting Redis connection")
+
+		conn, err := redisClient.GetConnection()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		psc := redis.PubSubConn{Conn: conn}
+		if err := psc.Subscribe(events.Channel); err != nil {
+			conn.Close()
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		// Receive blocks. So messages are read in a separate goroutine which
+		// owns the connection. It stops after the unsubscribe sent when the
+		// client goes away was confirmed by Redis.
+		messages := make(chan []byte)
+		receiveErr := make(chan error, 1)
+		done := make(chan struct{})
+		go func() {
+			defer conn.Close()
+			for {
+				switch v := psc.Receive().(type) {
+				case redis.Message:
+					select {
+					case messages <- v.Data:
+					case <-done:
+					}
+				case redis.Subscription:
+					if v.Count == 0 {
+						return
+					}
+				case error:
+					receiveErr <- v
+					return
+				}
+			}
+		}()
+		defer func() {
+			close(done)
+			psc.Unsubscribe()
+		}()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(eventsHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-config.Done:
+				return
+			case err := <-receiveErr:
+				log.Error().
+					Str("method", "streamEvents").
+					Msgf("Receiving events failed: %s", err.Error())
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				flusher.Flush()
+			case message := <-messages:
+				event := events.Event{}
+				if err := json.Unmarshal(message, &event); err != nil {
+					continue
+				}
+
+				if _, ok := filter[event.UUID]; len(filter) > 0 && !ok {
+					continue
+				}
+
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, message)
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package board
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+const (
+	// rateWindow is the window the rate limit applies to. The counter of a
+	// client is reset at the start of every window.
+	rateWindow = time.Minute
+	// rateKeyPrefix + client + ":" + window start is the counter of the
+	// requests of a client in a window.
+	rateKeyPrefix = "pinbackup:ratelimit:"
+	// jobLimitRetryAfter is the Retry-After sent if a token reached the
+	// maximum number of active jobs. Jobs usually take a few minutes.
+	jobLimitRetryAfter = time.Minute
+)
+
+// maxActiveJobsContextKey is used to store the maximum number of active
+// jobs of the token in the request context.
+const maxActiveJobsContextKey contextKey = "maxActiveJobs"
+
+// respondTooManyRequests sends 429 with a Retry-After header rounded up to
+// full seconds.
+func respondTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	respondError(w, http.StatusTooManyRequests, err)
+}
+
+// clientAddr returns the IP address of the client. The first address of
+// X-Forwarded-For is only used if the server runs behind a trusted proxy as
+// clients can set the header to anything.
+func clientAddr(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// rateClient returns the identity the rate limit of a request is counted
+// for. Requests with a valid API token are counted per token, all others
+// per IP address. Invalid tokens are counted per IP address so clients
+// can't escape the limit with random tokens.
+func rateClient(config *Config, r *http.Request) string {
+	if plain, err := bearerToken(r); err == nil {
+		if t, err := lookupToken(r, plain); err == nil {
+			return "token:" + t.ID
+		}
+	}
+
+	return "ip:" + clientAddr(r, config.TrustForwardedFor)
+}
+
+// windowStart returns the start of the rate limit window t is in.
+func windowStart(t time.Time) time.Time {
+	return t.Truncate(rateWindow)
+}
+
+// rateLimitMiddleware allows every client Config.RateLimit requests per
+// minute. The counters are stored in Redis so the limit applies to all
+// server replicas. Requests are let through if Redis isn't available as
+// the handlers will fail anyway.
+func rateLimitMiddleware(config *Config) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.RateLimit <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			conn, err := redisClient.GetConnection()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := time.Now()
+			start := windowStart(now)
+			client := rateClient(config, r)
+			key := fmt.Sprintf("%s%s:%d", rateKeyPrefix, client, start.Unix())
+
+			conn.Send("MULTI")
+			conn.Send("INCR", key)
+			conn.Send("EXPIRE", key, int(2*rateWindow.Seconds()))
+			values, err := redis.Values(conn.Do("EXEC"))
+			conn.Close()
+			if err != nil {
+				log.Error().
+					Str("method", "rateLimitMiddleware").
+					Msgf("Can not count request of %s: %s", client, err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			count, _ := redis.Int(values[0], nil)
+			remaining := config.RateLimit - count
+			if remaining < 0 {
+				remaining = 0
+			}
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(config.RateLimit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+			if count > config.RateLimit {
+				log.Info().
+					Str("method", "rateLimitMiddleware").
+					Msgf("Rate limit of %s exceeded", client)
+				respondTooManyRequests(w, start.Add(rateWindow).Sub(now), errors.Errorf("Rate limit of %d requests per minute exceeded", config.RateLimit))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyLimitMiddleware rejects requests with a body larger than
+// Config.MaxBodySize with 413. The body is read completely so the handlers
+// never decode more than that.
+func bodyLimitMiddleware(config *Config) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.MaxBodySize <= 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			tooLarge := errors.Errorf("Request body larger than %d bytes", config.MaxBodySize)
+			if r.ContentLength > config.MaxBodySize {
+				respondError(w, http.StatusRequestEntityTooLarge, tooLarge)
+				return
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, config.MaxBodySize+1))
+			r.Body.Close()
+			if err != nil {
+				respondError(w, http.StatusBadRequest, errors.Wrap(err, "Can't read request body"))
+				return
+			}
+			if int64(len(body)) > config.MaxBodySize {
+				respondError(w, http.StatusRequestEntityTooLarge, tooLarge)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitJobs wraps handler so that the jobs it creates count towards the
+// Config.MaxActiveJobs active jobs the API token of the request may have.
+// The limit is passed to the handler in the request context and checked
+// when a job is created. Must be wrapped by requireScope.
+func limitJobs(config *Config, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.MaxActiveJobs <= 0 || requestToken(r.Context()) == nil {
+			handler(w, r)
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), maxActiveJobsContextKey, config.MaxActiveJobs)))
+	}
+}
+
+// maxActiveJobs returns the maximum number of active jobs of the token of
+// the request. 0 if the number isn't limited.
+func maxActiveJobs(ctx context.Context) int {
+	max, _ := ctx.Value(maxActiveJobsContextKey).(int)
+	return max
+}
@@ -0,0 +1,52 @@
+package board
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// boardMetadata is the metadata of a board with its changes, newest first.
+type boardMetadata struct {
+	User string `json:"user"`
+	Path string `json:"path"`
+	*redisClient.BoardMeta
+	History []redisClient.BoardChange `json:"history"`
+}
+
+// getBoardMeta returns the metadata the scraper captured of a board e.g.
+// title, description and sections together with its changes.
+func getBoardMeta(w http.ResponseWriter, r *http.Request) {
+	user, board, err := boardVars(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	meta, err := redisClient.GetBoardMeta(conn, user, board)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	if meta == nil {
+		respondError(w, http.StatusNotFound, errors.New("getBoardMeta failed: No metadata of board"))
+		return
+	}
+
+	history, err := redisClient.BoardHistory(conn, user, board)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, boardMetadata{User: user, Path: board, BoardMeta: meta, History: history})
+}
@@ -0,0 +1,166 @@
+package board
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// canonicalHost is the host all Pinterest country domains are mapped to.
+const canonicalHost = "www.pinterest.com"
+
+// shortLinkTimeout limits resolving a pin.it short link including all
+// redirects.
+const shortLinkTimeout = 10 * time.Second
+
+// shortLinkHosts contains the hosts of Pinterest short links.
+var shortLinkHosts = map[string]bool{
+	"pin.it":     true,
+	"www.pin.it": true,
+}
+
+// pinterestHost matches Pinterest hosts without "www." e.g. pinterest.com,
+// pinterest.de, pinterest.co.uk, pinterest.com.au or de.pinterest.com.
+var pinterestHost = regexp.MustCompile(`^(?:[a-z]{2}\.)?pinterest\.(?:com|[a-z]{2}|co\.[a-z]{2}|com\.[a-z]{2})$`)
+
+// reservedPages are first path segments of Pinterest pages that are not
+// users.
+var reservedPages = map[string]bool{
+	"pin":        true,
+	"search":     true,
+	"ideas":      true,
+	"today":      true,
+	"explore":    true,
+	"topics":     true,
+	"categories": true,
+	"settings":   true,
+	"business":   true,
+	"login":      true,
+	"signup":     true,
+	"news_hub":   true,
+	"videos":     true,
+	"shopping":   true,
+	"_":          true,
+}
+
+// reservedProfilePages are second path segments of profile pages that are
+// not boards.
+var reservedProfilePages = map[string]bool{
+	"_saved":     true,
+	"_created":   true,
+	"_shop":      true,
+	"_community": true,
+	"_tools":     true,
+	"pins":       true,
+	"boards":     true,
+	"followers":  true,
+	"following":  true,
+}
+
+// resolveShortLink returns the URL a short link redirects to. It's a
+// variable so tests can replace it.
+var resolveShortLink = func(ctx context.Context, rawURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, shortLinkTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "Resolving short link failed")
+	}
+	resp.Body.Close()
+
+	// The client followed all redirects. The URL of the last request is
+	// the target of the short link.
+	return resp.Request.URL.String(), nil
+}
+
+// normalizeURL turns everything a user may copy from the browser or the
+// Pinterest app into the canonical URL of a board e.g.
+//
+//	pinterest.de/user/board/?utm_source=x -> https://www.pinterest.com/user/board/
+//	https://pin.it/abc                    -> https://www.pinterest.com/user/board/
+//
+// Short links are resolved, country domains are replaced by
+// www.pinterest.com and query parameters and fragments are removed. URLs
+// that don't point to a board, section or one of the source pages of a
+// profile e.g. /user/_saved/ return an error.
+func normalizeURL(ctx context.Context, rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", errors.New("URL is empty")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.New("Invalid URL")
+	}
+
+	host := strings.ToLower(parsedURL.Hostname())
+	if shortLinkHosts[host] {
+		resolved, err := resolveShortLink(ctx, parsedURL.String())
+		if err != nil {
+			return "", err
+		}
+
+		parsedURL, err = url.Parse(resolved)
+		if err != nil {
+			return "", errors.New("Short link points to an invalid URL")
+		}
+		host = strings.ToLower(parsedURL.Hostname())
+		if shortLinkHosts[host] {
+			return "", errors.New("Short link couldn't be resolved")
+		}
+	}
+
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return "", errors.Errorf("Unsupported scheme %s", parsedURL.Scheme)
+	}
+	if !pinterestHost.MatchString(strings.TrimPrefix(host, "www.")) {
+		return "", errors.Errorf("%s is not a Pinterest host", host)
+	}
+
+	segments := []string{}
+	for _, segment := range strings.Split(parsedURL.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	switch {
+	case len(segments) > 0 && segments[0] == "pin":
+		return "", errors.New("Pin URLs can't be backed up. Use the URL of the board instead")
+	case len(segments) > 0 && reservedPages[segments[0]]:
+		return "", errors.Errorf("/%s/ is a Pinterest page and not a board", segments[0])
+	case len(segments) > 0 && segments[0] == redisClient.ReservedUser:
+		return "", errors.Errorf("User %s can't be backed up. The name is reserved", segments[0])
+	case len(segments) < 2:
+		return "", errors.New("URL doesn't point to a board. Expected /user/board/")
+	case IsSourcePage(segments):
+		// Backed up like a board. See sourcePages.
+	case reservedProfilePages[segments[1]]:
+		return "", errors.Errorf("/%s/%s/ is a profile page and not a board", segments[0], segments[1])
+	case len(segments) > 3:
+		return "", errors.New("URL doesn't point to a board or section. Expected /user/board/ or /user/board/section/")
+	}
+
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return "https://" + canonicalHost + "/" + strings.Join(segments, "/") + "/", nil
+}
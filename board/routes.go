@@ -1,17 +1,86 @@
 package board
 
 import (
+	"time"
+
 	"github.com/gorilla/mux"
+
+	"github.com/githubixx/pinbackup/openapi"
+	"github.com/githubixx/pinbackup/storage"
+	"github.com/githubixx/pinbackup/token"
 )
 
+// Config contains the settings of the board API.
+type Config struct {
+	// AuthDisabled allows requests without API token. Only meant for
+	// development or if the API is protected otherwise.
+	AuthDisabled bool
+	// CORSOrigins contains all origins allowed to call the API from a
+	// browser e.g. https://www.pinterest.com. "*" allows all origins.
+	CORSOrigins []string
+	// Storage is the backend the downloader stores the pictures in.
+	Storage storage.Storage
+	// TrashPeriod is how long deleted boards are kept in the trash before
+	// they are purged. Boards are purged immediately if it's 0.
+	TrashPeriod time.Duration
+	// RateLimit is the number of requests a client may send per minute.
+	// Clients are API tokens or IP addresses for requests without valid
+	// token. 0 disables the limit.
+	RateLimit int
+	// TrustForwardedFor uses the X-Forwarded-For header to get the IP
+	// address of clients. Only enable it behind a proxy that sets it.
+	TrustForwardedFor bool
+	// MaxBodySize is the maximum size of request bodies in bytes. 0
+	// disables the limit.
+	MaxBodySize int64
+	// MaxActiveJobs is the maximum number of jobs of an API token that may
+	// be queued, scraping or downloading at the same time. 0 disables the
+	// limit.
+	MaxActiveJobs int
+	// Done is closed when the server shuts down. Event streams end then as
+	// they would otherwise keep the shutdown waiting.
+	Done <-chan struct{}
+}
+
 // Routes /api entry point
-func Routes() *mux.Router {
-	router := mux.NewRouter()
+func Routes(config *Config) *mux.Router {
+	// Board paths of sections contain "/" which is URL encoded by the
+	// clients so that a board is always a single path segment.
+	router := mux.NewRouter().UseEncodedPath()
 
 	subRouter := router.PathPrefix("/api").Subrouter()
-	subRouter.HandleFunc("/v1/board", enqueueBoard).Methods("POST")
-	subRouter.HandleFunc("/v1/existsboard", existsBoard).Methods("POST")
-	subRouter.HandleFunc("/v1/countboard", countBoard).Methods("POST")
+	subRouter.Use(corsMiddleware(config))
+	subRouter.Use(tokenMiddleware(config))
+	subRouter.Use(rateLimitMiddleware(config))
+	subRouter.Use(bodyLimitMiddleware(config))
+	subRouter.Use(validateMiddleware)
+	subRouter.Handle("/v1/openapi.json", openapi.Handler()).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/board", requireScope(config, token.ScopeEnqueue, limitJobs(config, enqueueBoard))).Methods("POST", "OPTIONS")
+	subRouter.HandleFunc("/v1/boards", requireScope(config, token.ScopeEnqueue, limitJobs(config, enqueueBoards))).Methods("POST", "OPTIONS")
+	subRouter.HandleFunc("/v1/existsboard", requireScope(config, token.ScopeRead, existsBoard)).Methods("POST", "OPTIONS")
+	subRouter.HandleFunc("/v1/countboard", requireScope(config, token.ScopeRead, countBoard)).Methods("POST", "OPTIONS")
+	subRouter.HandleFunc("/v1/boardstatus", requireScope(config, token.ScopeRead, statusBoard)).Methods("GET", "OPTIONS")
+
+	subRouter.HandleFunc("/v1/jobs", requireScope(config, token.ScopeRead, listJobs)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/events", requireScope(config, token.ScopeRead, streamEvents(config))).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/jobs/{uuid}", requireScope(config, token.ScopeRead, getJob)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/jobs/{uuid}/artifacts", requireScope(config, token.ScopeRead, listArtifacts)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/jobs/{uuid}/artifacts/{name}", requireScope(config, token.ScopeRead, getArtifact)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/accounts", requireScope(config, token.ScopeRead, listAccounts)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/users", requireScope(config, token.ScopeRead, listUsers)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/users/{user}/boards", requireScope(config, token.ScopeRead, listBoards)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/board/{user}/{board}", requireScope(config, token.ScopeDelete, deleteBoard(config))).Methods("DELETE", "OPTIONS")
+	subRouter.HandleFunc("/v1/board/{user}/{board}/meta", requireScope(config, token.ScopeRead, getBoardMeta)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/board/{user}/{board}/pins", requireScope(config, token.ScopeRead, listPins)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/board/{user}/{board}/pins/{pin}", requireScope(config, token.ScopeRead, getPin(config))).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/board/{user}/{board}/pins/{pin}/image", requireScope(config, token.ScopeRead, servePicture(config))).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/board/{user}/{board}/verify", requireScope(config, token.ScopeRead, verifyBoard(config))).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/board/{user}/{board}/export", requireScope(config, token.ScopeRead, exportBoard(config))).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/board/{user}/{board}/resync", requireScope(config, token.ScopeEnqueue, limitJobs(config, resyncBoard))).Methods("POST", "OPTIONS")
+	subRouter.HandleFunc("/v1/trash", requireScope(config, token.ScopeRead, listTrash)).Methods("GET", "OPTIONS")
+	subRouter.HandleFunc("/v1/trash/purge", requireScope(config, token.ScopeDelete, purgeExpiredTrash(config))).Methods("POST", "OPTIONS")
+	subRouter.HandleFunc("/v1/trash/{id}", requireScope(config, token.ScopeDelete, purgeTrash(config))).Methods("DELETE", "OPTIONS")
+	subRouter.HandleFunc("/v1/trash/{id}/restore", requireScope(config, token.ScopeDelete, restoreTrash)).Methods("POST", "OPTIONS")
 
 	return router
 }
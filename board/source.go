@@ -0,0 +1,84 @@
+package board
+
+import (
+	"net/url"
+
+	"github.com/gomodule/redigo/redis"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// Besides boards the pages of a profile below can be backed up. Pins are
+// all pins of a user and scraped like a board. Saved and following are
+// the boards of a user and the boards the user follows. They are resolved
+// into a job per board by the scraper.
+const (
+	SourcePins      = "pins"
+	SourceSaved     = "saved"
+	SourceFollowing = "following"
+)
+
+// sourcePages maps the second path segment of profile pages to the source
+// they are backed up as.
+var sourcePages = map[string]string{
+	"pins":      SourcePins,
+	"_saved":    SourceSaved,
+	"following": SourceFollowing,
+}
+
+// ResolvesBoards returns true if the page of b isn't scraped itself but
+// lists boards that are backed up instead.
+func (b *Board) ResolvesBoards() bool {
+	return b.Source == SourceSaved || b.Source == SourceFollowing
+}
+
+// IsSourcePage returns true if segments are the path of a profile page
+// that can be backed up besides boards e.g. /user/_saved/.
+func IsSourcePage(segments []string) bool {
+	return len(segments) == 2 && sourcePages[segments[1]] != ""
+}
+
+// IsBoardPath returns true if segments are the path of a board e.g. of a
+// link found on a source page. Sections and boards of the reserved user
+// aren't boards.
+func IsBoardPath(segments []string) bool {
+	return len(segments) == 2 && !reservedPages[segments[0]] && !reservedProfilePages[segments[1]] && segments[0] != redisClient.ReservedUser
+}
+
+// errJobLimit is returned if the API token of a new job already has the
+// maximum number of active jobs.
+type errJobLimit struct {
+	err error
+}
+
+func (e errJobLimit) Error() string {
+	return e.err.Error()
+}
+
+// IsJobLimit returns true if err was returned because the API token has
+// too many active jobs.
+func IsJobLimit(err error) bool {
+	_, ok := err.(errJobLimit)
+	return ok
+}
+
+// PublishFound publishes board path of user found on the page of source
+// e.g. a board the user follows. The job of the board references the job
+// of source and is created with the API token tokenID. The board is
+// scraped with the account of source. Like requests to the API the token
+// may have at most maxActiveJobs active jobs. 0 disables the limit.
+func PublishFound(conn redis.Conn, source *Board, tokenID string, maxActiveJobs int, user string, path string) (*Board, error) {
+	found, err := parseBoard("https://" + source.Host + "/" + url.PathEscape(user) + "/" + url.PathEscape(path) + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	found.Parent = source.UUID
+	found.Account = source.Account
+
+	if err := publishBoard(conn, found, tokenID, maxActiveJobs); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
@@ -0,0 +1,92 @@
+package board
+
+import (
+	"net/http"
+	"net/url"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+type boardStatus struct {
+	URL    string `json:"url"`
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	Count  int    `json:"count"`
+}
+
+// pathFromURL returns the "/user/board/" part of a Pinterest board URL.
+func pathFromURL(rawURL string) (string, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Host == "" {
+		return "", errors.New("Invalid URL")
+	}
+
+	user, err := parseUser(parsedURL.Path)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := parsePath(parsedURL.Path)
+	if err != nil {
+		return "", err
+	}
+
+	return "/" + user + "/" + path + "/", nil
+}
+
+// statusBoard returns if the board of the URL passed in the "url" query
+// parameter is already backed up and how many pictures it contains. It's
+// a GET request so browser extensions and bookmarklets can call it
+// easily e.g. to show a badge.
+func statusBoard(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	rawURL := r.URL.Query().Get("url")
+	if rawURL == "" {
+		respondError(w, http.StatusBadRequest, errors.New("statusBoard failed: Query parameter url missing"))
+		return
+	}
+
+	log.Info().
+		Str("method", "statusBoard").
+		Msgf("Incoming request: %s", rawURL)
+
+	path, err := pathFromURL(rawURL)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.Wrap(err, "statusBoard failed"))
+		return
+	}
+
+	key, err := prepareKey(path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	log.Trace().
+		Str("method", "statusBoard").
+		Msg("Getting Redis connection")
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	exists, err := redisClient.ExistsBoard(conn, key)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	count, err := redisClient.CountPictures(conn, key)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, boardStatus{URL: rawURL, Path: path, Exists: exists, Count: count})
+}
@@ -0,0 +1,194 @@
+package board
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/trash"
+)
+
+// boolParam returns the value of a boolean query parameter. A missing
+// parameter is false.
+func boolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Errorf("Invalid value for %s", name)
+	}
+
+	return b, nil
+}
+
+// respondTrashError maps trash errors to HTTP status codes.
+func respondTrashError(w http.ResponseWriter, err error) {
+	switch err {
+	case trash.ErrNotFound, trash.ErrBoardNotFound:
+		respondError(w, http.StatusNotFound, err)
+	case trash.ErrBoardExists, trash.ErrBoardActive:
+		respondError(w, http.StatusConflict, err)
+	default:
+		respondError(w, http.StatusBadRequest, err)
+	}
+}
+
+// deleteBoard moves a board into the trash. The stored pictures are
+// deleted when the trash period is over. With "keepfiles=true" only Redis
+// forgets the board and the pictures stay in storage. With "purge=true" or
+// if there is no trash period the board is deleted immediately.
+func deleteBoard(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, board, err := boardVars(r)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		if board == "" {
+			respondError(w, http.StatusBadRequest, errors.New("Invalid board"))
+			return
+		}
+
+		keepFiles, err := boolParam(r, "keepfiles")
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		purge, err := boolParam(r, "purge")
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		log.Info().
+			Str("method", "deleteBoard").
+			Msgf("Deleting board %s (keep files: %t, purge: %t)", boardKey(user, board), keepFiles, purge)
+
+		conn, err := redisClient.GetConnection()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer conn.Close()
+
+		entry, err := trash.Delete(conn, user, board, keepFiles)
+		if err != nil {
+			respondTrashError(w, err)
+			return
+		}
+
+		if purge || config.TrashPeriod <= 0 {
+			if err := trash.Purge(conn, config.Storage, entry.ID); err != nil {
+				respondTrashError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		respondJSON(w, http.StatusOK, entry)
+	}
+}
+
+// listTrash returns all deleted boards that weren't purged yet.
+func listTrash(w http.ResponseWriter, r *http.Request) {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	entries, err := trash.List(conn)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, entries)
+}
+
+// restoreTrash moves a deleted board out of the trash.
+func restoreTrash(w http.ResponseWriter, r *http.Request) {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	entry, err := trash.Restore(conn, mux.Vars(r)["id"])
+	if err != nil {
+		respondTrashError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, entry)
+}
+
+// purgeTrash deletes a board in the trash immediately.
+func purgeTrash(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := redisClient.GetConnection()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer conn.Close()
+
+		if err := trash.Purge(conn, config.Storage, mux.Vars(r)["id"]); err != nil {
+			respondTrashError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// purgeResult is the number of boards purged from the trash.
+type purgeResult struct {
+	Purged int `json:"purged"`
+}
+
+// purgeExpiredTrash deletes all boards that are in the trash longer than
+// the trash period of the server. The query parameter "period" e.g. "24h"
+// overrides the trash period.
+func purgeExpiredTrash(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		period := config.TrashPeriod
+		if value := r.URL.Query().Get("period"); value != "" {
+			var err error
+			if period, err = time.ParseDuration(value); err != nil || period < 0 {
+				respondError(w, http.StatusBadRequest, errors.New("Invalid value for period"))
+				return
+			}
+		}
+
+		conn, err := redisClient.GetConnection()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer conn.Close()
+
+		purged, err := trash.Expire(conn, config.Storage, period)
+		if err != nil {
+			respondTrashError(w, err)
+			return
+		}
+
+		log.Info().
+			Str("method", "purgeExpiredTrash").
+			Msgf("Purged %d boards deleted longer than %s ago", purged, period)
+
+		respondJSON(w, http.StatusOK, purgeResult{Purged: purged})
+	}
+}
@@ -0,0 +1,45 @@
+package board
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"github.com/githubixx/pinbackup/openapi"
+)
+
+// validateMiddleware rejects requests that don't match the OpenAPI
+// specification of the API before they reach the handlers.
+func validateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if r.Method == http.MethodOptions || route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Path variables are still URL encoded as the router uses the
+		// encoded path.
+		vars := map[string]string{}
+		for name, value := range mux.Vars(r) {
+			if decoded, err := url.PathUnescape(value); err == nil {
+				value = decoded
+			}
+			vars[name] = value
+		}
+
+		if err := openapi.Validate(r, template, vars); err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
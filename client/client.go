@@ -0,0 +1,456 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimeout is the timeout of the HTTP client created by New. The
+// timeout includes reading the body so large exports need a HTTPClient
+// without timeout.
+const defaultTimeout = 60 * time.Second
+
+// Client calls the REST API of a pinbackup server.
+type Client struct {
+	// BaseURL is the URL of the server e.g. http://localhost:8080
+	BaseURL string
+	// Token is the API token sent as Bearer token.
+	Token string
+	// HTTPClient is used for all requests.
+	HTTPClient *http.Client
+}
+
+// Error is returned if the server answers with an error status code.
+// RetryAfter is set if the server asks to wait before sending the request
+// again e.g. because the rate limit was exceeded.
+type Error struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// New returns a client for the server at baseURL.
+func New(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// boardPath returns the API path of a board. The board path is a single
+// path segment as it contains "/" in case of sections.
+func boardPath(user string, board string) string {
+	return "/api/v1/board/" + url.PathEscape(user) + "/" + url.PathEscape(strings.Trim(board, "/"))
+}
+
+// pageQuery returns the query parameters selecting page.
+func pageQuery(page Page) url.Values {
+	query := url.Values{}
+	if page.Cursor != "" {
+		query.Set("cursor", page.Cursor)
+	}
+	if page.Count > 0 {
+		query.Set("count", strconv.Itoa(page.Count))
+	}
+
+	return query
+}
+
+// request sends a request and returns the response if the status code
+// signals success. Otherwise the error message sent by the server is
+// returned as *Error.
+func (c *Client) request(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err == nil && payload.Error != "" {
+		apiErr.Message = payload.Error
+	}
+
+	return nil, apiErr
+}
+
+// do sends a request and decodes the JSON response into result. result may
+// be nil if the response has no body.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, result interface{}) error {
+	resp, err := c.request(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// enqueueRequest returns the request body queuing the board at rawURL.
+func enqueueRequest(rawURL string, options EnqueueOptions) map[string]string {
+	request := map[string]string{"url": rawURL}
+	if options.Account != "" {
+		request["account"] = options.Account
+	}
+
+	return request
+}
+
+// EnqueueBoard queues the board at rawURL for backup.
+func (c *Client) EnqueueBoard(ctx context.Context, rawURL string, options EnqueueOptions) (*Board, error) {
+	board := &Board{}
+	err := c.do(ctx, http.MethodPost, "/api/v1/board", nil, enqueueRequest(rawURL, options), board)
+
+	return board, err
+}
+
+// MaxBulkBoards is the maximum number of URLs EnqueueBoards accepts.
+const MaxBulkBoards = 100
+
+// EnqueueBoards queues up to MaxBulkBoards boards at once. URLs that can't
+// be queued don't prevent the others from being queued. Their error is
+// part of the result.
+func (c *Client) EnqueueBoards(ctx context.Context, rawURLs []string, options EnqueueOptions) (*BulkResponse, error) {
+	request := make([]map[string]string, 0, len(rawURLs))
+	for _, rawURL := range rawURLs {
+		request = append(request, enqueueRequest(rawURL, options))
+	}
+
+	response := &BulkResponse{}
+	err := c.do(ctx, http.MethodPost, "/api/v1/boards", nil, request, response)
+
+	return response, err
+}
+
+// ExistsBoard returns true if the board with path "/user/board/" is backed
+// up.
+func (c *Client) ExistsBoard(ctx context.Context, path string) (bool, error) {
+	var result struct {
+		Exists bool `json:"exists"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/existsboard", nil, map[string]string{"path": path}, &result)
+
+	return result.Exists, err
+}
+
+// CountBoard returns the number of pictures of the board with path
+// "/user/board/".
+func (c *Client) CountBoard(ctx context.Context, path string) (int, error) {
+	var result struct {
+		Count int `json:"count"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/countboard", nil, map[string]string{"path": path}, &result)
+
+	return result.Count, err
+}
+
+// BoardStatus returns if the board at rawURL is backed up.
+func (c *Client) BoardStatus(ctx context.Context, rawURL string) (*BoardStatus, error) {
+	status := &BoardStatus{}
+	err := c.do(ctx, http.MethodGet, "/api/v1/boardstatus", url.Values{"url": {rawURL}}, nil, status)
+
+	return status, err
+}
+
+// ListJobs returns the latest jobs, newest first. limit 0 uses the default
+// of the server.
+func (c *Client) ListJobs(ctx context.Context, limit int) ([]Job, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	jobs := []Job{}
+	err := c.do(ctx, http.MethodGet, "/api/v1/jobs", query, nil, &jobs)
+
+	return jobs, err
+}
+
+// GetJob returns a job.
+func (c *Client) GetJob(ctx context.Context, uuid string) (*Job, error) {
+	job := &Job{}
+	err := c.do(ctx, http.MethodGet, "/api/v1/jobs/"+url.PathEscape(uuid), nil, nil, job)
+
+	return job, err
+}
+
+// ListArtifacts returns the artifacts captured for troubleshooting a job.
+func (c *Client) ListArtifacts(ctx context.Context, uuid string) ([]Artifact, error) {
+	artifacts := []Artifact{}
+	err := c.do(ctx, http.MethodGet, "/api/v1/jobs/"+url.PathEscape(uuid)+"/artifacts", nil, nil, &artifacts)
+
+	return artifacts, err
+}
+
+// GetArtifact returns the content of an artifact of a job. The caller must
+// close it.
+func (c *Client) GetArtifact(ctx context.Context, uuid string, name string) (io.ReadCloser, error) {
+	resp, err := c.request(ctx, http.MethodGet, "/api/v1/jobs/"+url.PathEscape(uuid)+"/artifacts/"+url.PathEscape(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// ListAccounts returns the Pinterest accounts boards can be queued with.
+func (c *Client) ListAccounts(ctx context.Context) ([]Account, error) {
+	accounts := []Account{}
+	err := c.do(ctx, http.MethodGet, "/api/v1/accounts", nil, nil, &accounts)
+
+	return accounts, err
+}
+
+// ListUsers returns a page of users with backed up boards.
+func (c *Client) ListUsers(ctx context.Context, page Page) (*UsersPage, error) {
+	users := &UsersPage{}
+	err := c.do(ctx, http.MethodGet, "/api/v1/users", pageQuery(page), nil, users)
+
+	return users, err
+}
+
+// ListBoards returns a page of boards of a user.
+func (c *Client) ListBoards(ctx context.Context, user string, page Page) (*BoardsPage, error) {
+	boards := &BoardsPage{}
+	err := c.do(ctx, http.MethodGet, "/api/v1/users/"+url.PathEscape(user)+"/boards", pageQuery(page), nil, boards)
+
+	return boards, err
+}
+
+// ListPins returns a page of pins of a board.
+func (c *Client) ListPins(ctx context.Context, user string, board string, page Page) (*PinsPage, error) {
+	pins := &PinsPage{}
+	err := c.do(ctx, http.MethodGet, boardPath(user, board)+"/pins", pageQuery(page), nil, pins)
+
+	return pins, err
+}
+
+// GetPin returns the metadata of a pin.
+func (c *Client) GetPin(ctx context.Context, user string, board string, name string) (*Pin, error) {
+	pin := &Pin{}
+	err := c.do(ctx, http.MethodGet, boardPath(user, board)+"/pins/"+url.PathEscape(name), nil, nil, pin)
+
+	return pin, err
+}
+
+// PinImage returns the picture of a pin. The caller must close it.
+func (c *Client) PinImage(ctx context.Context, user string, board string, name string) (io.ReadCloser, error) {
+	resp, err := c.request(ctx, http.MethodGet, boardPath(user, board)+"/pins/"+url.PathEscape(name)+"/image", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// GetBoardMeta returns the metadata of a board and its changes.
+func (c *Client) GetBoardMeta(ctx context.Context, user string, board string) (*BoardMeta, error) {
+	meta := &BoardMeta{}
+	err := c.do(ctx, http.MethodGet, boardPath(user, board)+"/meta", nil, nil, meta)
+
+	return meta, err
+}
+
+// VerifyBoard compares the pictures of a board in Redis and in the storage.
+func (c *Client) VerifyBoard(ctx context.Context, user string, board string) (*BoardVerification, error) {
+	result := &BoardVerification{}
+	err := c.do(ctx, http.MethodGet, boardPath(user, board)+"/verify", nil, nil, result)
+
+	return result, err
+}
+
+// ExportBoard returns the pictures of a board as ZIP archive. The caller
+// must close it.
+func (c *Client) ExportBoard(ctx context.Context, user string, board string) (io.ReadCloser, error) {
+	resp, err := c.request(ctx, http.MethodGet, boardPath(user, board)+"/export", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// ResyncBoard queues a backed up board again.
+func (c *Client) ResyncBoard(ctx context.Context, user string, board string) (*Board, error) {
+	result := &Board{}
+	err := c.do(ctx, http.MethodPost, boardPath(user, board)+"/resync", nil, nil, result)
+
+	return result, err
+}
+
+// DeleteBoard deletes a board including its sections. The returned trash
+// entry is nil if the board was deleted immediately.
+func (c *Client) DeleteBoard(ctx context.Context, user string, board string, options DeleteOptions) (*TrashEntry, error) {
+	query := url.Values{}
+	if options.KeepFiles {
+		query.Set("keepfiles", "true")
+	}
+	if options.Purge {
+		query.Set("purge", "true")
+	}
+
+	resp, err := c.request(ctx, http.MethodDelete, boardPath(user, board), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	entry := &TrashEntry{}
+	if err := json.NewDecoder(resp.Body).Decode(entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// ListTrash returns all deleted boards that weren't purged yet.
+func (c *Client) ListTrash(ctx context.Context) ([]TrashEntry, error) {
+	entries := []TrashEntry{}
+	err := c.do(ctx, http.MethodGet, "/api/v1/trash", nil, nil, &entries)
+
+	return entries, err
+}
+
+// RestoreTrash restores a deleted board.
+func (c *Client) RestoreTrash(ctx context.Context, id string) (*TrashEntry, error) {
+	entry := &TrashEntry{}
+	err := c.do(ctx, http.MethodPost, "/api/v1/trash/"+url.PathEscape(id)+"/restore", nil, nil, entry)
+
+	return entry, err
+}
+
+// PurgeTrash deletes a board in the trash immediately.
+func (c *Client) PurgeTrash(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/trash/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// PurgeExpiredTrash deletes all boards that are in the trash longer than
+// period. The trash period of the server is used if period is 0. Returns
+// the number of boards purged.
+func (c *Client) PurgeExpiredTrash(ctx context.Context, period time.Duration) (int, error) {
+	query := url.Values{}
+	if period > 0 {
+		query.Set("period", period.String())
+	}
+
+	var result struct {
+		Purged int `json:"purged"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/trash/purge", query, nil, &result)
+
+	return result.Purged, err
+}
+
+// Events streams the events of the jobs with the given UUIDs or of all jobs
+// if no UUID is given. The channel is closed if ctx is done or the server
+// closes the stream.
+func (c *Client) Events(ctx context.Context, uuids ...string) (<-chan Event, error) {
+	query := url.Values{}
+	if len(uuids) > 0 {
+		query.Set("uuid", strings.Join(uuids, ","))
+	}
+
+	// The stream is open as long as ctx so the timeout of the HTTP client
+	// must not apply.
+	stream := *c.HTTPClient
+	stream.Timeout = 0
+	streamClient := &Client{BaseURL: c.BaseURL, Token: c.Token, HTTPClient: &stream}
+
+	resp, err := streamClient.request(ctx, http.MethodGet, "/api/v1/events", query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		var data []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			if strings.HasPrefix(line, "data:") {
+				data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+				continue
+			}
+			if line != "" || len(data) == 0 {
+				// Event names, comments and heartbeats
+				continue
+			}
+
+			var event Event
+			err := json.Unmarshal([]byte(strings.Join(data, "\n")), &event)
+			data = nil
+			if err != nil {
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBoardPath(t *testing.T) {
+	var testPaths = []struct {
+		user   string
+		board  string
+		result string
+	}{
+		{"user1", "board", "/api/v1/board/user1/board"},
+		{"user1", "/board/", "/api/v1/board/user1/board"},
+		{"user1", "board/section1", "/api/v1/board/user1/board%2Fsection1"},
+	}
+
+	for _, tp := range testPaths {
+		if result := boardPath(tp.user, tp.board); result != tp.result {
+			t.Errorf("Got: %s / Expected: %s", result, tp.result)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer pb_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Missing API token"})
+			return
+		}
+
+		switch r.URL.EscapedPath() {
+		case "/api/v1/board":
+			var request map[string]string
+			json.NewDecoder(r.Body).Decode(&request)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(Board{URL: request["url"], UUID: "1234", Account: request["account"]})
+		case "/api/v1/board/user1/board%2Fsection1":
+			if r.Method != http.MethodDelete || r.URL.Query().Get("purge") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/v1/trash/purge":
+			if r.Method != http.MethodPost || r.URL.Query().Get("period") != "24h0m0s" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]int{"purged": 3})
+		case "/api/v1/jobs":
+			w.Header().Set("Retry-After", "42")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Rate limit exceeded"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Job not found"})
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/", "pb_test")
+	ctx := context.Background()
+
+	board, err := c.EnqueueBoard(ctx, "https://www.pinterest.com/user1/board/", EnqueueOptions{Account: "alice"})
+	if err != nil || board.UUID != "1234" || board.URL != "https://www.pinterest.com/user1/board/" || board.Account != "alice" {
+		t.Errorf("Got board: %v, error: %v / Expected: UUID 1234 and account alice", board, err)
+	}
+
+	entry, err := c.DeleteBoard(ctx, "user1", "board/section1", DeleteOptions{Purge: true})
+	if err != nil || entry != nil {
+		t.Errorf("Got entry: %v, error: %v / Expected: no entry and no error", entry, err)
+	}
+
+	purged, err := c.PurgeExpiredTrash(ctx, 24*time.Hour)
+	if err != nil || purged != 3 {
+		t.Errorf("Got: %d purged, error: %v / Expected: 3 purged", purged, err)
+	}
+
+	_, err = c.GetJob(ctx, "unknown")
+	if apiErr, ok := err.(*Error); !ok || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Job not found" {
+		t.Errorf("Got error: %v / Expected: Job not found (HTTP 404)", err)
+	}
+
+	_, err = c.ListJobs(ctx, 0)
+	if apiErr, ok := err.(*Error); !ok || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 42*time.Second {
+		t.Errorf("Got error: %v / Expected: HTTP 429 with Retry-After 42s", err)
+	}
+
+	c.Token = ""
+	_, err = c.ListJobs(ctx, 0)
+	if apiErr, ok := err.(*Error); !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Got error: %v / Expected: HTTP 401", err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("uuid") != "a,b" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(": heartbeat\n\n"))
+		w.Write([]byte("event: job.finished\ndata: {\"type\": \"job.finished\", \"uuid\": \"a\"}\n\n"))
+		w.Write([]byte("data: invalid\n\n"))
+		w.Write([]byte("event: job.failed\ndata: {\"type\": \"job.failed\", \"uuid\": \"b\", \"error\": \"login failed\"}\n\n"))
+	}))
+	defer server.Close()
+
+	events, err := New(server.URL, "pb_test").Events(context.Background(), "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []Event
+	for event := range events {
+		received = append(received, event)
+	}
+
+	if len(received) != 2 || received[0].UUID != "a" || received[1].Type != "job.failed" || received[1].Error != "login failed" {
+		t.Errorf("Got events: %v / Expected: job.finished of a and job.failed of b", received)
+	}
+}
@@ -0,0 +1,215 @@
+package client
+
+import "time"
+
+// The types below correspond to the schemas of the OpenAPI specification
+// served at /api/v1/openapi.json.
+
+// Board is a board queued for backup. Existing is set if the board already
+// had an active job. UUID is the UUID of that job then. Source is set for
+// the pages of a profile e.g. "saved". Parent is the UUID of the job of the
+// page the board was found on. Account is the Pinterest account the board
+// is scraped with.
+type Board struct {
+	URL          string   `json:"url"`
+	Host         string   `json:"host"`
+	User         string   `json:"user"`
+	Path         string   `json:"path"`
+	PathSegments []string `json:"pathsegments"`
+	UUID         string   `json:"uuid"`
+	Existing     bool     `json:"existing,omitempty"`
+	Source       string   `json:"source,omitempty"`
+	Parent       string   `json:"parent,omitempty"`
+	Account      string   `json:"account,omitempty"`
+}
+
+// BulkResult is the result of a single board of a bulk request. Status is
+// the HTTP status code the board would have gotten as single request.
+type BulkResult struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	Board  *Board `json:"board,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkResponse contains the results of a bulk request in the order of the
+// requested URLs.
+type BulkResponse struct {
+	Queued  int          `json:"queued"`
+	Failed  int          `json:"failed"`
+	Results []BulkResult `json:"results"`
+}
+
+// BoardStatus tells if the board of a URL is backed up.
+type BoardStatus struct {
+	URL    string `json:"url"`
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	Count  int    `json:"count"`
+}
+
+// Job is the state of a backup request. Source, Parent and Account are set
+// like in Board.
+type Job struct {
+	UUID       string `json:"uuid"`
+	URL        string `json:"url"`
+	Host       string `json:"host"`
+	User       string `json:"user"`
+	Path       string `json:"path"`
+	Token      string `json:"token,omitempty"`
+	Source     string `json:"source,omitempty"`
+	Parent     string `json:"parent,omitempty"`
+	Account    string `json:"account,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	PinsFound  int    `json:"pinsfound"`
+	Downloaded int    `json:"downloaded"`
+	Skipped    int    `json:"skipped"`
+	Failed     int    `json:"failed"`
+	Processed  int    `json:"processed"`
+	Created    int64  `json:"created"`
+	Updated    int64  `json:"updated"`
+	Finished   int64  `json:"finished,omitempty"`
+}
+
+// Done returns true if the job is finished or failed.
+func (j *Job) Done() bool {
+	return j.Status == "finished" || j.Status == "failed"
+}
+
+// Artifact is a file captured for troubleshooting a job e.g. a screenshot
+// of the page the scraper failed on.
+type Artifact struct {
+	Name        string `json:"name"`
+	Size        int    `json:"size"`
+	ContentType string `json:"contenttype"`
+}
+
+// UsersPage is a page of users. Next is empty on the last page.
+type UsersPage struct {
+	Items []string `json:"items"`
+	Next  string   `json:"next,omitempty"`
+}
+
+// BoardSummary is a backed up board of a user.
+type BoardSummary struct {
+	Path     string `json:"path"`
+	Count    int    `json:"count"`
+	LastSync int64  `json:"lastsync"`
+}
+
+// BoardsPage is a page of boards. Next is empty on the last page.
+type BoardsPage struct {
+	Items []BoardSummary `json:"items"`
+	Next  string         `json:"next,omitempty"`
+}
+
+// PinsPage is a page of pin filenames. Next is empty on the last page.
+type PinsPage struct {
+	Items []string `json:"items"`
+	Next  string   `json:"next,omitempty"`
+}
+
+// Pin is the metadata of a pin.
+type Pin struct {
+	Name       string    `json:"name"`
+	User       string    `json:"user"`
+	Path       string    `json:"path"`
+	InRedis    bool      `json:"inredis"`
+	InStorage  bool      `json:"instorage"`
+	URL        string    `json:"url,omitempty"`
+	UUID       string    `json:"uuid,omitempty"`
+	Downloaded int64     `json:"downloaded,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	ModTime    time.Time `json:"modtime,omitempty"`
+}
+
+// BoardChange is a change of the metadata of a board. Changes of lists
+// e.g. the sections are recorded as items added and removed.
+type BoardChange struct {
+	Time    int64    `json:"time"`
+	Field   string   `json:"field"`
+	Old     string   `json:"old,omitempty"`
+	New     string   `json:"new,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// BoardMeta is the metadata of a board captured on the last scrape.
+// History contains its changes, newest first.
+type BoardMeta struct {
+	User          string        `json:"user"`
+	Path          string        `json:"path"`
+	Title         string        `json:"title"`
+	Description   string        `json:"description"`
+	Category      string        `json:"category,omitempty"`
+	Privacy       string        `json:"privacy"`
+	Cover         string        `json:"cover,omitempty"`
+	CoverFile     string        `json:"coverfile,omitempty"`
+	Collaborators []string      `json:"collaborators"`
+	Sections      []string      `json:"sections"`
+	Scraped       int64         `json:"scraped"`
+	History       []BoardChange `json:"history"`
+}
+
+// BoardVerification is the result of comparing the pictures in Redis and
+// in the storage.
+type BoardVerification struct {
+	User             string   `json:"user"`
+	Path             string   `json:"path"`
+	OK               bool     `json:"ok"`
+	MissingInStorage []string `json:"missinginstorage"`
+	MissingInRedis   []string `json:"missinginredis"`
+}
+
+// TrashEntry is a deleted board.
+type TrashEntry struct {
+	ID        string   `json:"id"`
+	User      string   `json:"user"`
+	Path      string   `json:"path"`
+	Paths     []string `json:"paths"`
+	Pictures  int      `json:"pictures"`
+	KeepFiles bool     `json:"keepfiles"`
+	Deleted   int64    `json:"deleted"`
+}
+
+// Page selects a page of a paginated list. The zero value selects the
+// first page with the default size.
+type Page struct {
+	Cursor string
+	Count  int
+}
+
+// EnqueueOptions control how boards are backed up.
+type EnqueueOptions struct {
+	// Account is the name of the Pinterest account the boards are scraped
+	// with. The default login of the scraper is used if it's empty.
+	Account string
+}
+
+// Account is a Pinterest account boards can be queued with.
+type Account struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// DeleteOptions control how a board is deleted.
+type DeleteOptions struct {
+	// KeepFiles only forgets the board and keeps the pictures.
+	KeepFiles bool
+	// Purge deletes the board immediately instead of moving it into the
+	// trash.
+	Purge bool
+}
+
+// Event is a job lifecycle event sent by the event stream.
+type Event struct {
+	Type  string `json:"type"`
+	UUID  string `json:"uuid"`
+	Time  int64  `json:"time"`
+	User  string `json:"user,omitempty"`
+	Path  string `json:"path,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Count int    `json:"count,omitempty"`
+	Error string `json:"error,omitempty"`
+}
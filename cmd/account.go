@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/githubixx/pinbackup/account"
+	redisPool "github.com/githubixx/pinbackup/redis"
+)
+
+func init() {
+	rootCmd.AddCommand(accountCmd)
+	accountCmd.AddCommand(accountAddCmd)
+	accountCmd.AddCommand(accountListCmd)
+	accountCmd.AddCommand(accountDeleteCmd)
+	accountCmd.AddCommand(accountGenKeyCmd)
+
+	accountCmd.PersistentFlags().StringVar(&redisHost, "redis-host", "localhost", "Redis host name")
+	accountCmd.PersistentFlags().IntVar(&redisPort, "redis-port", 6379, "Redis port")
+
+	accountAddCmd.Flags().StringVar(&accountEmail, "email", "", "Pinterest login name of the account")
+	accountAddCmd.Flags().StringVar(&accountKey, "account-key", "", "Key encrypting the credentials. Must be the same as the scraper's (see account genkey)")
+	accountAddCmd.MarkFlagRequired("email")
+
+	replacer := strings.NewReplacer("-", "_")
+	viper.SetEnvKeyReplacer(replacer)
+
+	viper.AutomaticEnv()
+}
+
+// readPassword reads the password from the first line of stdin so it
+// doesn't end up in the shell history.
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+var accountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Manages Pinterest accounts",
+	Long: `Manages the Pinterest accounts the scraper can log in with. Boards are
+scraped with an account if its name is given when they are queued. The
+credentials are stored in Redis encrypted with the account key.`,
+}
+
+var accountAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Adds or replaces a Pinterest account",
+	Long: `Adds or replaces a Pinterest account. The password is read from stdin and
+stored encrypted with the account key.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := account.ParseKey(viper.GetString("account-key"))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		password, err := readPassword()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		redisPool.InitPool(viper.GetString("redis-host"), viper.GetInt("redis-port"))
+
+		conn, err := redisPool.GetConnection()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+
+		a, err := account.Save(conn, key, args[0], accountEmail, password)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Account %s (%s) saved\n", a.Name, a.Email)
+	},
+}
+
+var accountListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all Pinterest accounts",
+	Long:  `Lists all Pinterest accounts. Passwords aren't shown.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		redisPool.InitPool(viper.GetString("redis-host"), viper.GetInt("redis-port"))
+
+		conn, err := redisPool.GetConnection()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+
+		accounts, err := account.List(conn)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tEMAIL\tCREATED")
+		for _, a := range accounts {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", a.Name, a.Email, a.Created.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	},
+}
+
+var accountDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Deletes a Pinterest account",
+	Long:  `Deletes a Pinterest account and its stored session. Queued boards of the account fail.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		redisPool.InitPool(viper.GetString("redis-host"), viper.GetInt("redis-port"))
+
+		conn, err := redisPool.GetConnection()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+
+		if err := account.Delete(conn, args[0]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Account %s deleted\n", args[0])
+	},
+}
+
+var accountGenKeyCmd = &cobra.Command{
+	Use:   "genkey",
+	Short: "Generates a new account key",
+	Long: `Generates a new random key to encrypt the credentials of the accounts
+with. Pass it to the scraper and to "account add" with --account-key or
+ACCOUNT_KEY.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := account.GenerateKey()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Println(key)
+	},
+}
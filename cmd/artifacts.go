@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/githubixx/pinbackup/client"
+)
+
+func init() {
+	rootCmd.AddCommand(artifactsCmd)
+
+	addClientFlags(artifactsCmd)
+	addOutputFlag(artifactsCmd)
+
+	artifactsCmd.Flags().StringVarP(&artifactsDir, "download", "d", "", "Download the artifacts into this directory")
+}
+
+// downloadArtifact writes an artifact of a job into dir. The file is named
+// like the artifact prefixed with the job UUID.
+func downloadArtifact(ctx context.Context, c *client.Client, uuid string, name string, dir string) (string, error) {
+	body, err := c.GetArtifact(ctx, uuid, name)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	file := filepath.Join(dir, uuid+"-"+name)
+	f, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	return file, f.Close()
+}
+
+var artifactsCmd = &cobra.Command{
+	Use:   "artifacts <uuid> [name]...",
+	Short: "Lists or downloads the troubleshooting artifacts of a job",
+	Long: `Lists the artifacts the scraper captured for a job e.g. a screenshot, the DOM,
+the console messages and the network activity (HAR) of the page it failed on.
+With --download all or the given artifacts are written into a directory. Needs
+an API token with read scope.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format := output()
+		c := apiClient()
+		ctx := context.Background()
+		uuid := args[0]
+
+		artifacts, err := c.ListArtifacts(ctx, uuid)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if len(args) > 1 {
+			wanted := map[string]bool{}
+			for _, name := range args[1:] {
+				wanted[name] = true
+			}
+			selected := []client.Artifact{}
+			for _, a := range artifacts {
+				if wanted[a.Name] {
+					selected = append(selected, a)
+					delete(wanted, a.Name)
+				}
+			}
+			for name := range wanted {
+				fmt.Fprintf(os.Stderr, "Job %s has no artifact %s\n", uuid, name)
+				os.Exit(1)
+			}
+			artifacts = selected
+		}
+
+		if artifactsDir != "" {
+			for _, a := range artifacts {
+				file, err := downloadArtifact(ctx, c, uuid, a.Name, artifactsDir)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", a.Name, err)
+					os.Exit(1)
+				}
+				fmt.Println(file)
+			}
+			return
+		}
+
+		if format == outputJSON {
+			printJSON(artifacts)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSIZE\tCONTENT TYPE")
+		for _, a := range artifacts {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", a.Name, a.Size, a.ContentType)
+		}
+		w.Flush()
+	},
+}
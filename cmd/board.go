@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/githubixx/pinbackup/client"
+)
+
+func init() {
+	rootCmd.AddCommand(boardCmd)
+	boardCmd.AddCommand(boardDeleteCmd)
+	boardCmd.AddCommand(boardTrashCmd)
+	boardCmd.AddCommand(boardRestoreCmd)
+	boardCmd.AddCommand(boardPurgeCmd)
+
+	addClientFlags(boardCmd)
+
+	boardDeleteCmd.Flags().BoolVar(&boardKeepFiles, "keep-files", false, "Only forget the board in Redis and keep the stored pictures")
+	boardDeleteCmd.Flags().BoolVar(&boardPurge, "purge", false, "Delete the board immediately instead of moving it into the trash")
+	boardPurgeCmd.Flags().BoolVar(&purgeExpired, "expired", false, "Purge all boards whose trash period is over")
+	boardPurgeCmd.Flags().DurationVar(&purgeTrashPeriod, "trash-period", 0, "How long deleted boards are kept in the trash (default: --trash-period of the server)")
+
+	replacer := strings.NewReplacer("-", "_")
+	viper.SetEnvKeyReplacer(replacer)
+
+	viper.AutomaticEnv()
+}
+
+var boardCmd = &cobra.Command{
+	Use:   "board",
+	Short: "Manages backed up boards",
+	Long:  `Manages backed up boards via the REST API of the server.`,
+}
+
+var boardDeleteCmd = &cobra.Command{
+	Use:   "delete <user> <board>",
+	Short: "Deletes a board",
+	Long: `Deletes a board including its sections. The board is moved into the trash first
+and can be restored until it's purged. The server purges boards in the trash
+after its --trash-period. With --keep-files only Redis forgets the board and
+the stored pictures are never deleted. Needs an API token with delete scope.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		entry, err := apiClient().DeleteBoard(context.Background(), args[0], args[1], client.DeleteOptions{
+			KeepFiles: boardKeepFiles,
+			Purge:     boardPurge,
+		})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if entry == nil {
+			fmt.Printf("Board %s/%s deleted\n", args[0], strings.Trim(args[1], "/"))
+			return
+		}
+
+		fmt.Printf("Board %s/%s moved into trash %s\n", entry.User, entry.Path, entry.ID)
+	},
+}
+
+var boardTrashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Lists deleted boards",
+	Long:  `Lists deleted boards that weren't purged yet.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := apiClient().ListTrash(context.Background())
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tBOARD\tPICTURES\tKEEP FILES\tDELETED")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s/%s\t%d\t%t\t%s\n", e.ID, e.User, e.Path, e.Pictures, e.KeepFiles, time.Unix(e.Deleted, 0).Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	},
+}
+
+var boardRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Restores a deleted board",
+	Long:  `Restores a deleted board from the trash. Needs an API token with delete scope.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		entry, err := apiClient().RestoreTrash(context.Background(), args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Board %s/%s restored\n", entry.User, entry.Path)
+	},
+}
+
+var boardPurgeCmd = &cobra.Command{
+	Use:   "purge <id>... | --expired",
+	Short: "Deletes boards in the trash",
+	Long: `Deletes boards in the trash immediately including the stored pictures. With
+--expired all boards whose trash period is over are deleted. Needs an API token
+with delete scope.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if purgeExpired == (len(args) > 0) {
+			fmt.Println("Either trash IDs or --expired is required")
+			os.Exit(1)
+		}
+
+		c := apiClient()
+
+		if purgeExpired {
+			purged, err := c.PurgeExpiredTrash(context.Background(), purgeTrashPeriod)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Printf("%d boards purged\n", purged)
+			return
+		}
+
+		for _, id := range args {
+			if err := c.PurgeTrash(context.Background(), id); err != nil {
+				fmt.Printf("%s: %s\n", id, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Trash %s purged\n", id)
+		}
+	},
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/githubixx/pinbackup/client"
+)
+
+// addClientFlags adds the flags needed to call the REST API of the server
+// to cmd.
+func addClientFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&serverURL, "server-url", "http://localhost:8080", "URL of the pinbackup server")
+	cmd.PersistentFlags().StringVar(&apiToken, "api-token", "", "API token with the scopes needed by the command (see token create)")
+
+	viper.BindPFlag("server-url", cmd.PersistentFlags().Lookup("server-url"))
+	viper.BindPFlag("api-token", cmd.PersistentFlags().Lookup("api-token"))
+}
+
+// apiClient returns a client for the REST API of the server. The command
+// exits if no API token is configured.
+func apiClient() *client.Client {
+	if viper.GetString("api-token") == "" {
+		fmt.Println("API token missing: Set --api-token or the API_TOKEN environment variable")
+		os.Exit(1)
+	}
+
+	return client.New(viper.GetString("server-url"), viper.GetString("api-token"))
+}
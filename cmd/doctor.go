@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/githubixx/pinbackup/downloader"
+	"github.com/githubixx/pinbackup/health"
+	redisPool "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/scraper"
+)
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.PersistentFlags().StringVar(&redisHost, "redis-host", "localhost", "Redis host name")
+	doctorCmd.PersistentFlags().IntVar(&redisPort, "redis-port", 6379, "Redis port")
+	doctorCmd.PersistentFlags().StringVar(&loginName, "login-name", "", "Pinterest login name (login is only checked if set)")
+	doctorCmd.PersistentFlags().StringVar(&loginPassword, "login-password", "", "Pinterest login password")
+	doctorCmd.PersistentFlags().StringVar(&chromeWsDebuggerHost, "chrome-ws-debugger-host", "localhost", "Comma separated list of Chrome DevTools endpoints: host, host:port or srv:_service._tcp.domain")
+	doctorCmd.PersistentFlags().StringVar(&fsDownloadPath, "fs-download-path", "/tmp", "Directory to store pins")
+	doctorCmd.PersistentFlags().Uint64Var(&minFreeSpace, "min-free-space", 1024, "Minimum free space in MiB in download path")
+
+	replacer := strings.NewReplacer("-", "_")
+	viper.SetEnvKeyReplacer(replacer)
+
+	viper.AutomaticEnv()
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks if all components pinbackup depends on are working",
+	Long: `Checks if all components pinbackup depends on are working: Redis,
+Chrome DevTools, the Pinterest login and the download storage. For every
+failed check a hint is printed how to fix it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		redisPool.InitPool(viper.GetString("redis-host"), viper.GetInt("redis-port"))
+
+		scraperConfig := scraper.Config{
+			LoginName:            viper.GetString("login-name"),
+			LoginPassword:        viper.GetString("login-password"),
+			ChromeWsDebuggerHost: viper.GetString("chrome-ws-debugger-host"),
+		}
+		downloaderConfig := downloader.Config{
+			FsDownloadPath: viper.GetString("fs-download-path"),
+			MinFreeSpace:   viper.GetUint64("min-free-space"),
+		}
+
+		// The downloader checks already include Redis.
+		checks := downloader.HealthChecks(&downloaderConfig)
+		checks = append(checks, scraper.DoctorChecks(&scraperConfig)...)
+
+		// Logging in takes a while because of the delays needed to not
+		// trigger Pinterest's bot detection.
+		report := health.Run(context.Background(), 90*time.Second, checks...)
+
+		for _, result := range report.Checks {
+			if result.Status == health.StatusOK {
+				fmt.Printf("[ OK ] %s\n", result.Name)
+				continue
+			}
+
+			fmt.Printf("[FAIL] %s: %s\n", result.Name, result.Error)
+			fmt.Printf("       %s\n", result.Hint)
+		}
+
+		if report.Status != health.StatusOK {
+			os.Exit(1)
+		}
+	},
+}
@@ -6,8 +6,11 @@ import (
 
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/githubixx/pinbackup/downloader"
+	"github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/shutdown"
 )
 
 func init() {
@@ -19,6 +22,11 @@ func init() {
 	downloaderCmd.PersistentFlags().StringVar(&fsDownloadPath, "fs-download-path", "/tmp", "Directory to store pins")
 	downloaderCmd.PersistentFlags().StringVar(&downloadQueue, "download-queue", "download", "Redis queue for pictures to download")
 
+	downloaderCmd.PersistentFlags().Uint64Var(&minFreeSpace, "min-free-space", 1024, "Minimum free space in MiB in download path for the downloader to be ready")
+	downloaderCmd.PersistentFlags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "How long downloads in flight may take on shutdown")
+	downloaderCmd.PersistentFlags().StringVar(&ffmpeg, "ffmpeg", downloader.DefaultFFmpeg, "ffmpeg executable used to remux HLS video streams into MP4 files")
+	downloaderCmd.PersistentFlags().StringVar(&metricsListen, "metrics-listen", "", "Address to expose Prometheus metrics and health probes on e.g. :9090 (disabled if empty)")
+
 	replacer := strings.NewReplacer("-", "_")
 	viper.SetEnvKeyReplacer(replacer)
 
@@ -28,6 +36,10 @@ func init() {
 	viper.BindPFlag("storage-type", downloaderCmd.PersistentFlags().Lookup("storage-type"))
 	viper.BindPFlag("fs-download-path", downloaderCmd.PersistentFlags().Lookup("fs-download-path"))
 	viper.BindPFlag("download-queue", downloaderCmd.PersistentFlags().Lookup("download-queue"))
+	viper.BindPFlag("min-free-space", downloaderCmd.PersistentFlags().Lookup("min-free-space"))
+	viper.BindPFlag("metrics-listen", downloaderCmd.PersistentFlags().Lookup("metrics-listen"))
+	viper.BindPFlag("shutdown-timeout", downloaderCmd.PersistentFlags().Lookup("shutdown-timeout"))
+	viper.BindPFlag("ffmpeg", downloaderCmd.PersistentFlags().Lookup("ffmpeg"))
 }
 
 var downloaderCmd = &cobra.Command{
@@ -41,8 +53,20 @@ var downloaderCmd = &cobra.Command{
 			StorageType:    viper.GetString("storage-type"),
 			FsDownloadPath: viper.GetString("fs-download-path"),
 			DownloadQueue:  viper.GetString("download-queue"),
+			MetricsListen:  viper.GetString("metrics-listen"),
+			MinFreeSpace:   viper.GetUint64("min-free-space"),
+			FFmpeg:         viper.GetString("ffmpeg"),
+
+			ShutdownTimeout: viper.GetDuration("shutdown-timeout"),
+		}
+		ctx, stop := shutdown.Context()
+		defer stop()
+
+		if err := downloader.StartProcessQueue(ctx, &config); err != nil {
+			fmt.Println(err)
 		}
-		if err := downloader.StartProcessQueue(&config); err != nil {
+
+		if err := redis.ClosePool(); err != nil {
 			fmt.Println(err)
 		}
 	},
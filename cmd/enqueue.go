@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/githubixx/pinbackup/client"
+)
+
+func init() {
+	rootCmd.AddCommand(enqueueCmd)
+
+	addClientFlags(enqueueCmd)
+	addOutputFlag(enqueueCmd)
+	enqueueCmd.Flags().StringVarP(&enqueueFile, "file", "f", "", "File with one board URL per line (- reads from stdin)")
+	enqueueCmd.Flags().StringVar(&enqueueAccount, "account", "", "Pinterest account the boards are scraped with (see account list)")
+}
+
+// enqueueResult is the result of enqueuing a single URL.
+type enqueueResult struct {
+	URL   string        `json:"url"`
+	Board *client.Board `json:"board,omitempty"`
+	Error string        `json:"error,omitempty"`
+}
+
+// readURLs returns the board URLs of r. Empty lines and lines starting with
+// "#" are ignored.
+func readURLs(r io.Reader) ([]string, error) {
+	var urls []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+
+	return urls, scanner.Err()
+}
+
+// enqueueURLs returns the URLs passed as arguments and read from the file
+// passed with --file.
+func enqueueURLs(args []string) ([]string, error) {
+	urls := append([]string{}, args...)
+	if enqueueFile == "" {
+		return urls, nil
+	}
+
+	var r io.Reader = os.Stdin
+	if enqueueFile != "-" {
+		file, err := os.Open(enqueueFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	fromFile, err := readURLs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(urls, fromFile...), nil
+}
+
+var enqueueCmd = &cobra.Command{
+	Use:   "enqueue <url>...",
+	Short: "Backs up boards",
+	Long: `Sends board URLs to the server to back them up. URLs are passed as arguments
+or read from a file with one URL per line. The server normalizes the URLs
+e.g. resolves pin.it short links. Prints the UUIDs of the jobs which
+can be followed with the status and wait commands. Exits with 1 if a URL
+couldn't be queued. Needs an API token with enqueue scope.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format := output()
+
+		urls, err := enqueueURLs(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if len(urls) == 0 {
+			fmt.Fprintln(os.Stderr, "No board URLs given")
+			os.Exit(1)
+		}
+
+		c := apiClient()
+		failed := false
+		results := []enqueueResult{}
+		for start := 0; start < len(urls); start += client.MaxBulkBoards {
+			end := start + client.MaxBulkBoards
+			if end > len(urls) {
+				end = len(urls)
+			}
+
+			response, err := c.EnqueueBoards(context.Background(), urls[start:end], client.EnqueueOptions{Account: enqueueAccount})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			for _, r := range response.Results {
+				results = append(results, enqueueResult{URL: r.URL, Board: r.Board, Error: r.Error})
+			}
+			failed = failed || response.Failed > 0
+		}
+
+		if format == outputJSON {
+			printJSON(results)
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "UUID\tURL\tERROR")
+			for _, r := range results {
+				uuid := "-"
+				if r.Board != nil {
+					uuid = r.Board.UUID
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", uuid, r.URL, r.Error)
+			}
+			w.Flush()
+		}
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
@@ -18,6 +18,10 @@ func init() {
 	importCmd.PersistentFlags().IntVar(&redisPort, "redis-port", 6379, "Redis port")
 	importCmd.PersistentFlags().StringVar(&importDir, "dir", "/tmp", "Directory where pins are stored")
 	importCmd.PersistentFlags().StringVar(&userDatabaseName, "database", "user", "Database name where users and pins are stored")
+	importCmd.PersistentFlags().BoolVar(&importDryRun, "dry-run", false, "Only show what would be imported without changing Redis")
+	importCmd.PersistentFlags().BoolVar(&importPrune, "prune", false, "Remove pictures and boards from Redis that no longer exist on disk")
+	importCmd.PersistentFlags().BoolVar(&importProgress, "progress", true, "Show progress while importing")
+	importCmd.PersistentFlags().IntVar(&importBatchSize, "batch-size", 500, "Number of Redis commands sent in one pipeline")
 
 	replacer := strings.NewReplacer("-", "_")
 	viper.SetEnvKeyReplacer(replacer)
@@ -27,6 +31,10 @@ func init() {
 	viper.BindPFlag("redis-port", importCmd.PersistentFlags().Lookup("redis-port"))
 	viper.BindPFlag("importDir", importCmd.PersistentFlags().Lookup("dir"))
 	viper.BindPFlag("userDatabaseName", importCmd.PersistentFlags().Lookup("database"))
+	viper.BindPFlag("import-dry-run", importCmd.PersistentFlags().Lookup("dry-run"))
+	viper.BindPFlag("import-prune", importCmd.PersistentFlags().Lookup("prune"))
+	viper.BindPFlag("import-progress", importCmd.PersistentFlags().Lookup("progress"))
+	viper.BindPFlag("import-batch-size", importCmd.PersistentFlags().Lookup("batch-size"))
 }
 
 var importCmd = &cobra.Command{
@@ -40,9 +48,16 @@ var importCmd = &cobra.Command{
 		config := importer.Config{
 			ImportDir:        viper.GetString("importDir"),
 			UserDatabaseName: viper.GetString("database"),
+			DryRun:           viper.GetBool("import-dry-run"),
+			Prune:            viper.GetBool("import-prune"),
+			Progress:         viper.GetBool("import-progress"),
+			BatchSize:        viper.GetInt("import-batch-size"),
 		}
-		if err := importer.StartImport(ctx, &config); err != nil {
+		summary, err := importer.StartImport(ctx, &config)
+		if err != nil {
 			fmt.Println(err)
+			return
 		}
+		fmt.Println(summary)
 	},
 }
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/githubixx/pinbackup/client"
+)
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+
+	addClientFlags(lsCmd)
+	addOutputFlag(lsCmd)
+}
+
+// lsBoard is a backed up board of a user.
+type lsBoard struct {
+	User string `json:"user"`
+	client.BoardSummary
+}
+
+// allUsers returns all users with backed up boards.
+func allUsers(ctx context.Context, c *client.Client) ([]string, error) {
+	var (
+		users []string
+		page  client.Page
+	)
+
+	for {
+		result, err := c.ListUsers(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, result.Items...)
+		if result.Next == "" {
+			return users, nil
+		}
+		page.Cursor = result.Next
+	}
+}
+
+// userBoards returns all backed up boards of a user.
+func userBoards(ctx context.Context, c *client.Client, user string) ([]lsBoard, error) {
+	var (
+		boards []lsBoard
+		page   client.Page
+	)
+
+	for {
+		result, err := c.ListBoards(ctx, user, page)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range result.Items {
+			boards = append(boards, lsBoard{User: user, BoardSummary: b})
+		}
+		if result.Next == "" {
+			return boards, nil
+		}
+		page.Cursor = result.Next
+	}
+}
+
+var lsCmd = &cobra.Command{
+	Use:   "ls [user]...",
+	Short: "Lists backed up boards",
+	Long: `Lists the backed up boards of the given users or of all users with the number
+of pins and the time of the last finished sync. Needs an API token with read
+scope.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format := output()
+		c := apiClient()
+		ctx := context.Background()
+
+		users := args
+		if len(users) == 0 {
+			var err error
+			users, err = allUsers(ctx, c)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+
+		boards := []lsBoard{}
+		for _, user := range users {
+			b, err := userBoards(ctx, c, user)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", user, err)
+				os.Exit(1)
+			}
+			boards = append(boards, b...)
+		}
+
+		// The API returns users and boards in no particular order.
+		sort.Slice(boards, func(i, j int) bool {
+			if boards[i].User != boards[j].User {
+				return boards[i].User < boards[j].User
+			}
+			return boards[i].Path < boards[j].Path
+		})
+
+		if format == outputJSON {
+			printJSON(boards)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "USER\tBOARD\tPINS\tLAST SYNC")
+		for _, b := range boards {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", b.User, b.Path, b.Count, formatUnix(b.LastSync))
+		}
+		w.Flush()
+	},
+}
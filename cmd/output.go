@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/githubixx/pinbackup/client"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// progressWidth is the number of characters of a progress bar.
+const progressWidth = 20
+
+// addOutputFlag adds the --output flag to cmd.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputTable, "Output format ("+outputTable+" or "+outputJSON+")")
+}
+
+// output returns the requested output format. The command exits if the
+// format is unknown.
+func output() string {
+	format := viper.GetString("output")
+	if format != outputTable && format != outputJSON {
+		fmt.Fprintf(os.Stderr, "Unknown output format %s: Use %s or %s\n", format, outputTable, outputJSON)
+		os.Exit(1)
+	}
+
+	return format
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// formatUnix formats a Unix time. 0 is shown as "-".
+func formatUnix(t int64) string {
+	if t == 0 {
+		return "-"
+	}
+
+	return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+}
+
+// progressBar returns a text progress bar for a job e.g.
+// "[#######.............] 35/100".
+func progressBar(job *client.Job) string {
+	if job.PinsFound == 0 {
+		return "-"
+	}
+
+	done := job.Processed * progressWidth / job.PinsFound
+	if done > progressWidth {
+		done = progressWidth
+	}
+
+	bar := fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("#", done), strings.Repeat(".", progressWidth-done), job.Processed, job.PinsFound)
+	if job.Failed > 0 {
+		bar += fmt.Sprintf(" (%d failed)", job.Failed)
+	}
+
+	return bar
+}
+
+// printJobs writes jobs as table to w.
+func printJobs(w io.Writer, jobs []client.Job) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "UUID\tBOARD\tSTATUS\tPROGRESS\tCREATED")
+	for i := range jobs {
+		job := &jobs[i]
+		status := job.Status
+		if job.Error != "" {
+			status += ": " + job.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s/%s\t%s\t%s\t%s\n", job.UUID, job.User, job.Path, status, progressBar(job), formatUnix(job.Created))
+	}
+	tw.Flush()
+}
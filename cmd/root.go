@@ -3,8 +3,10 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -20,12 +22,90 @@ var (
 	chromeWsDebuggerHost string
 	importDir            string
 	userDatabaseName     string
+	importDryRun         bool
+	importPrune          bool
+	importProgress       bool
+	importBatchSize      int
+	metricsListen        string
+	minFreeSpace         uint64
+	disableAuth          bool
+	tokenName            string
+	tokenScopes          []string
+	corsOrigins          []string
+	trashPeriod          time.Duration
+	boardKeepFiles       bool
+	boardPurge           bool
+	purgeExpired         bool
+	purgeTrashPeriod     time.Duration
+	serverURL            string
+	apiToken             string
+	outputFormat         string
+	enqueueFile          string
+	enqueueAccount       string
+	statusWatch          bool
+	statusLimit          int
+	waitTimeout          time.Duration
+	rateLimit            int
+	trustForwardedFor    bool
+	maxBodySize          int64
+	maxActiveJobs        int
+	listen               string
+	tlsCert              string
+	tlsKey               string
+	tlsSelfSigned        bool
+	shutdownTimeout      time.Duration
+	concurrency          int
+	chromeMaxTabs        int
+	chromeRecycleAfter   int
+	blockResources       []string
+	noBlockResources     bool
+	stepTimeout          time.Duration
+	boardTimeout         time.Duration
+	stallScrolls         int
+	maxScrolls           int
+	maxPins              int
+	captureOnFailure     bool
+	captureSteps         bool
+	artifactTTL          time.Duration
+	artifactsDir         string
+	ffmpeg               string
+	accountKey           string
+	accountEmail         string
 )
 
+// sharedFlags are flags defined by more than one command. viper can only
+// bind one flag per key and the last command initialized would win. So
+// these flags are bound again for the command that is actually executed.
+var sharedFlags = []string{
+	"redis-host",
+	"redis-port",
+	"login-name",
+	"login-password",
+	"download-queue",
+	"chrome-ws-debugger-host",
+	"storage-type",
+	"fs-download-path",
+	"min-free-space",
+	"metrics-listen",
+	"server-url",
+	"api-token",
+	"output",
+	"shutdown-timeout",
+	"account-key",
+	"max-active-jobs",
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "pinbackup",
 	Short: "Backup your boards at Pinterest",
 	Long:  `Backup your boards at Pinterest.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		for _, name := range sharedFlags {
+			if flag := cmd.Flags().Lookup(name); flag != nil {
+				viper.BindPFlag(name, flag)
+			}
+		}
+	},
 }
 
 // Execute this command
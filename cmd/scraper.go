@@ -6,8 +6,11 @@ import (
 
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/githubixx/pinbackup/redis"
 	"github.com/githubixx/pinbackup/scraper"
+	"github.com/githubixx/pinbackup/shutdown"
 )
 
 func init() {
@@ -17,14 +20,32 @@ func init() {
 	scraperCmd.PersistentFlags().IntVar(&redisPort, "redis-port", 6379, "Redis port")
 	scraperCmd.PersistentFlags().StringVar(&loginName, "login-name", "", "Pinterest login name")
 	scraperCmd.PersistentFlags().StringVar(&loginPassword, "login-password", "", "Pinterest login password")
-	scraperCmd.PersistentFlags().StringVar(&selectorPreviewPins, "selector-preview-pins", "", "CSS selector for preview pins")
+	scraperCmd.PersistentFlags().StringVar(&accountKey, "account-key", "", "Key decrypting the credentials of the accounts boards can be queued with (see account genkey)")
+	scraperCmd.PersistentFlags().StringVar(&selectorPreviewPins, "selector-preview-pins", "", "CSS selector for the preview pictures of pins. Tried before the built-in strategies that find them automatically")
 	scraperCmd.PersistentFlags().StringVar(&boardsQueue, "boards-queue", "boards", "Redis queue for boards to download")
 	scraperCmd.PersistentFlags().StringVar(&downloadQueue, "download-queue", "download", "Redis queue for pictures to download")
-	scraperCmd.PersistentFlags().StringVar(&chromeWsDebuggerHost, "chrome-ws-debugger-host", "localhost", "Chrome WebSocket debugger host")
+	scraperCmd.PersistentFlags().StringVar(&chromeWsDebuggerHost, "chrome-ws-debugger-host", "localhost", "Comma separated list of Chrome DevTools endpoints: host, host:port or srv:_service._tcp.domain")
+	scraperCmd.PersistentFlags().IntVar(&concurrency, "concurrency", 1, "Number of boards scraped at the same time")
+	scraperCmd.PersistentFlags().IntVar(&chromeMaxTabs, "chrome-max-tabs", 4, "Maximum number of tabs opened per Chrome browser")
+	scraperCmd.PersistentFlags().StringSliceVar(&blockResources, "block-resources", scraper.DefaultBlockedResources, "Resource types the browser doesn't load while scraping e.g. image, media, font, stylesheet")
+	scraperCmd.PersistentFlags().BoolVar(&noBlockResources, "no-block-resources", false, "Load all resources while scraping e.g. if lazy loading of pins depends on pictures")
+	scraperCmd.PersistentFlags().IntVar(&chromeRecycleAfter, "chrome-recycle-after", 0, "Close a Chrome browser after this many boards to free leaked memory (0 disables)")
 
 	scraperCmd.MarkFlagRequired("loginName")
 	scraperCmd.MarkFlagRequired("loginPassword")
 
+	scraperCmd.PersistentFlags().DurationVar(&stepTimeout, "step-timeout", scraper.DefaultStepTimeout, "How long a single browser step e.g. loading the board or scrolling may take (0 disables)")
+	scraperCmd.PersistentFlags().DurationVar(&boardTimeout, "board-timeout", scraper.DefaultBoardTimeout, "How long scraping a board may take until its job fails (0 disables)")
+	scraperCmd.PersistentFlags().IntVar(&stallScrolls, "stall-scrolls", scraper.DefaultStallScrolls, "Number of scrolls without new pins after which the end of a board is assumed")
+	scraperCmd.PersistentFlags().IntVar(&maxScrolls, "max-scrolls", scraper.DefaultMaxScrolls, "Fail the job of a board that needs more scrolls (0 disables)")
+	scraperCmd.PersistentFlags().IntVar(&maxPins, "max-pins", 0, "Fail the job of a board with more pins (0 disables)")
+	scraperCmd.PersistentFlags().IntVar(&maxActiveJobs, "max-active-jobs", 100, "Maximum number of active jobs per API token when queueing boards found on saved and following pages (0 disables the limit)")
+	scraperCmd.PersistentFlags().BoolVar(&captureOnFailure, "capture-on-failure", true, "Store a screenshot, the DOM, console messages and a HAR of the page as job artifacts if scraping fails")
+	scraperCmd.PersistentFlags().BoolVar(&captureSteps, "capture-steps", false, "Store a screenshot and the DOM after every scraping step for debugging")
+	scraperCmd.PersistentFlags().DurationVar(&artifactTTL, "artifact-ttl", scraper.DefaultArtifactTTL, "How long job artifacts are kept")
+	scraperCmd.PersistentFlags().DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second, "How long boards in flight may take on shutdown until their jobs fail")
+	scraperCmd.PersistentFlags().StringVar(&metricsListen, "metrics-listen", "", "Address to expose Prometheus metrics and health probes on e.g. :9090 (disabled if empty)")
+
 	replacer := strings.NewReplacer("-", "_")
 	viper.SetEnvKeyReplacer(replacer)
 
@@ -33,10 +54,27 @@ func init() {
 	viper.BindPFlag("redis-port", scraperCmd.PersistentFlags().Lookup("redis-port"))
 	viper.BindPFlag("login-name", scraperCmd.PersistentFlags().Lookup("login-name"))
 	viper.BindPFlag("login-password", scraperCmd.PersistentFlags().Lookup("login-password"))
+	viper.BindPFlag("account-key", scraperCmd.PersistentFlags().Lookup("account-key"))
 	viper.BindPFlag("selector-preview-pins", scraperCmd.PersistentFlags().Lookup("selector-preview-pins"))
 	viper.BindPFlag("boards-queue", scraperCmd.PersistentFlags().Lookup("boards-queue"))
 	viper.BindPFlag("download-queue", scraperCmd.PersistentFlags().Lookup("download-queue"))
+	viper.BindPFlag("metrics-listen", scraperCmd.PersistentFlags().Lookup("metrics-listen"))
+	viper.BindPFlag("shutdown-timeout", scraperCmd.PersistentFlags().Lookup("shutdown-timeout"))
 	viper.BindPFlag("chrome-ws-debugger-host", scraperCmd.PersistentFlags().Lookup("chrome-ws-debugger-host"))
+	viper.BindPFlag("concurrency", scraperCmd.PersistentFlags().Lookup("concurrency"))
+	viper.BindPFlag("chrome-max-tabs", scraperCmd.PersistentFlags().Lookup("chrome-max-tabs"))
+	viper.BindPFlag("chrome-recycle-after", scraperCmd.PersistentFlags().Lookup("chrome-recycle-after"))
+	viper.BindPFlag("block-resources", scraperCmd.PersistentFlags().Lookup("block-resources"))
+	viper.BindPFlag("no-block-resources", scraperCmd.PersistentFlags().Lookup("no-block-resources"))
+	viper.BindPFlag("step-timeout", scraperCmd.PersistentFlags().Lookup("step-timeout"))
+	viper.BindPFlag("board-timeout", scraperCmd.PersistentFlags().Lookup("board-timeout"))
+	viper.BindPFlag("stall-scrolls", scraperCmd.PersistentFlags().Lookup("stall-scrolls"))
+	viper.BindPFlag("max-scrolls", scraperCmd.PersistentFlags().Lookup("max-scrolls"))
+	viper.BindPFlag("max-pins", scraperCmd.PersistentFlags().Lookup("max-pins"))
+	viper.BindPFlag("max-active-jobs", scraperCmd.PersistentFlags().Lookup("max-active-jobs"))
+	viper.BindPFlag("capture-on-failure", scraperCmd.PersistentFlags().Lookup("capture-on-failure"))
+	viper.BindPFlag("capture-steps", scraperCmd.PersistentFlags().Lookup("capture-steps"))
+	viper.BindPFlag("artifact-ttl", scraperCmd.PersistentFlags().Lookup("artifact-ttl"))
 }
 
 var scraperCmd = &cobra.Command{
@@ -49,12 +87,38 @@ var scraperCmd = &cobra.Command{
 			RedisPort:            viper.GetInt("redis-port"),
 			LoginName:            viper.GetString("login-name"),
 			LoginPassword:        viper.GetString("login-password"),
+			AccountKey:           viper.GetString("account-key"),
+			MaxActiveJobs:        viper.GetInt("max-active-jobs"),
 			SelectorPreviewPins:  viper.GetString("selector-preview-pins"),
 			BoardsQueue:          viper.GetString("boards-queue"),
 			DownloadQueue:        viper.GetString("download-queue"),
 			ChromeWsDebuggerHost: viper.GetString("chrome-ws-debugger-host"),
+			MetricsListen:        viper.GetString("metrics-listen"),
+			ShutdownTimeout:      viper.GetDuration("shutdown-timeout"),
+			Concurrency:          viper.GetInt("concurrency"),
+			ChromeMaxTabs:        viper.GetInt("chrome-max-tabs"),
+			ChromeRecycleAfter:   viper.GetInt("chrome-recycle-after"),
+			BlockResources:       viper.GetStringSlice("block-resources"),
+			StepTimeout:          viper.GetDuration("step-timeout"),
+			BoardTimeout:         viper.GetDuration("board-timeout"),
+			StallScrolls:         viper.GetInt("stall-scrolls"),
+			MaxScrolls:           viper.GetInt("max-scrolls"),
+			MaxPins:              viper.GetInt("max-pins"),
+			CaptureOnFailure:     viper.GetBool("capture-on-failure"),
+			CaptureSteps:         viper.GetBool("capture-steps"),
+			ArtifactTTL:          viper.GetDuration("artifact-ttl"),
+		}
+		if viper.GetBool("no-block-resources") {
+			config.BlockResources = nil
+		}
+		ctx, stop := shutdown.Context()
+		defer stop()
+
+		if err := scraper.StartProcessQueue(ctx, &config); err != nil {
+			fmt.Println(err)
 		}
-		if err := scraper.StartProcessQueue(&config); err != nil {
+
+		if err := redis.ClosePool(); err != nil {
 			fmt.Println(err)
 		}
 	},
@@ -2,8 +2,6 @@ package cmd
 
 import (
 	"context"
-	"os"
-	"os/signal"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -11,44 +9,131 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/githubixx/pinbackup/board"
+	"github.com/githubixx/pinbackup/health"
+	"github.com/githubixx/pinbackup/metrics"
 	redisPool "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/server"
+	"github.com/githubixx/pinbackup/shutdown"
+	"github.com/githubixx/pinbackup/storage"
+	"github.com/githubixx/pinbackup/trash"
+	"github.com/githubixx/pinbackup/web"
 
 	"net/http"
 	"strings"
 	"time"
 )
 
+// trashExpiryInterval is how often the server purges expired boards from
+// the trash.
+const trashExpiryInterval = 10 * time.Minute
+
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
+	serverCmd.PersistentFlags().StringVar(&listen, "listen", "0.0.0.0:3333", "Address to listen on e.g. :3333 or unix:/run/pinbackup.sock for a unix socket")
+	serverCmd.PersistentFlags().StringVar(&tlsCert, "tls-cert", "", "TLS certificate file. Reloaded when it changes")
+	serverCmd.PersistentFlags().StringVar(&tlsKey, "tls-key", "", "TLS key file. Reloaded when it changes")
+	serverCmd.PersistentFlags().BoolVar(&tlsSelfSigned, "tls-self-signed", false, "Serve TLS with a self-signed certificate created on start if no certificate is given")
+	serverCmd.PersistentFlags().DurationVar(&shutdownTimeout, "shutdown-timeout", 15*time.Second, "How long requests in flight may take on shutdown")
 	serverCmd.PersistentFlags().StringVar(&redisHost, "redis-host", "localhost", "Redis host name")
 	serverCmd.PersistentFlags().IntVar(&redisPort, "redis-port", 6379, "Redis port")
+	serverCmd.PersistentFlags().BoolVar(&disableAuth, "disable-auth", false, "Allow API requests without token (development only)")
+	serverCmd.PersistentFlags().StringVar(&storageType, "storage-type", "fs", "Currently only fs (filesystem) supported")
+	serverCmd.PersistentFlags().StringVar(&fsDownloadPath, "fs-download-path", "/tmp", "Directory where the downloader stores pins")
+	serverCmd.PersistentFlags().DurationVar(&trashPeriod, "trash-period", 7*24*time.Hour, "How long deleted boards are kept in the trash before the pictures are deleted (0 deletes immediately)")
+	serverCmd.PersistentFlags().StringSliceVar(&corsOrigins, "cors-origin", []string{}, "Origins allowed to call the API from a browser e.g. https://www.pinterest.com (* allows all)")
+	serverCmd.PersistentFlags().IntVar(&rateLimit, "rate-limit", 1200, "API requests per minute per token or IP address (0 disables the limit)")
+	serverCmd.PersistentFlags().BoolVar(&trustForwardedFor, "trust-forwarded-for", false, "Use X-Forwarded-For to get the IP address of clients (only behind a proxy)")
+	serverCmd.PersistentFlags().Int64Var(&maxBodySize, "max-body-size", 1<<20, "Maximum size of API request bodies in bytes (0 disables the limit)")
+	serverCmd.PersistentFlags().IntVar(&maxActiveJobs, "max-active-jobs", 100, "Maximum number of active jobs per API token (0 disables the limit)")
 
 	replacer := strings.NewReplacer("-", "_")
 	viper.SetEnvKeyReplacer(replacer)
 
 	viper.AutomaticEnv()
+	viper.BindPFlag("listen", serverCmd.PersistentFlags().Lookup("listen"))
+	viper.BindPFlag("tls-cert", serverCmd.PersistentFlags().Lookup("tls-cert"))
+	viper.BindPFlag("tls-key", serverCmd.PersistentFlags().Lookup("tls-key"))
+	viper.BindPFlag("tls-self-signed", serverCmd.PersistentFlags().Lookup("tls-self-signed"))
+	viper.BindPFlag("shutdown-timeout", serverCmd.PersistentFlags().Lookup("shutdown-timeout"))
 	viper.BindPFlag("redis-host", serverCmd.PersistentFlags().Lookup("redis-host"))
 	viper.BindPFlag("redis-port", serverCmd.PersistentFlags().Lookup("redis-port"))
+	viper.BindPFlag("disable-auth", serverCmd.PersistentFlags().Lookup("disable-auth"))
+	viper.BindPFlag("storage-type", serverCmd.PersistentFlags().Lookup("storage-type"))
+	viper.BindPFlag("fs-download-path", serverCmd.PersistentFlags().Lookup("fs-download-path"))
+	viper.BindPFlag("trash-period", serverCmd.PersistentFlags().Lookup("trash-period"))
+	viper.BindPFlag("cors-origin", serverCmd.PersistentFlags().Lookup("cors-origin"))
+	viper.BindPFlag("rate-limit", serverCmd.PersistentFlags().Lookup("rate-limit"))
+	viper.BindPFlag("trust-forwarded-for", serverCmd.PersistentFlags().Lookup("trust-forwarded-for"))
+	viper.BindPFlag("max-body-size", serverCmd.PersistentFlags().Lookup("max-body-size"))
+	viper.BindPFlag("max-active-jobs", serverCmd.PersistentFlags().Lookup("max-active-jobs"))
 }
 
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Receives board to scrape and put it into a queue",
-	Long:  `Receives board to scrape and put it into a queue to be consumed by the scraper process.`,
+	Long: `Receives board to scrape and put it into a queue to be consumed by the scraper process.
+On SIGINT or SIGTERM the server stops accepting connections and waits up to
+--shutdown-timeout for requests in flight before it exits.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		port := "3333"
-		wait := time.Second * 15
+		ctx, stop := shutdown.Context()
+		defer stop()
+
+		if viper.GetBool("disable-auth") {
+			log.Warn().
+				Str("method", "server/init()").
+				Msg("API authentication disabled")
+		}
 
-		router := board.Routes()
+		pictureStorage, err := storage.New(viper.GetString("storage-type"), viper.GetString("fs-download-path"))
+		if err != nil {
+			log.Fatal().
+				Str("method", "server/init()").
+				Msg(err.Error())
+		}
+
+		tlsConfig, err := server.TLSConfig(viper.GetString("tls-cert"), viper.GetString("tls-key"), viper.GetBool("tls-self-signed"))
+		if err != nil {
+			log.Fatal().
+				Str("method", "server/init()").
+				Msg(err.Error())
+		}
+
+		listener, err := server.Listen(viper.GetString("listen"))
+		if err != nil {
+			log.Fatal().
+				Str("method", "server/init()").
+				Msg(err.Error())
+		}
+
+		router := board.Routes(&board.Config{
+			AuthDisabled: viper.GetBool("disable-auth"),
+			CORSOrigins:  viper.GetStringSlice("cors-origin"),
+			Storage:      pictureStorage,
+			TrashPeriod:  viper.GetDuration("trash-period"),
+
+			RateLimit:         viper.GetInt("rate-limit"),
+			TrustForwardedFor: viper.GetBool("trust-forwarded-for"),
+			MaxBodySize:       viper.GetInt64("max-body-size"),
+			MaxActiveJobs:     viper.GetInt("max-active-jobs"),
+
+			Done: ctx.Done(),
+		})
+		router.Handle("/metrics", metrics.Handler()).Methods("GET")
+		for pattern, handler := range health.Routes(health.Redis()) {
+			router.Handle(pattern, handler).Methods("GET")
+		}
+		router.PathPrefix("/").Handler(web.Handler()).Methods("GET")
 
 		srv := &http.Server{
-			Addr: "0.0.0.0:" + port,
 			// Good practice to set timeouts to avoid Slowloris attacks.
-			WriteTimeout: time.Second * 15,
-			ReadTimeout:  time.Second * 15,
-			IdleTimeout:  time.Second * 60,
-			Handler:      router,
+			// There is no WriteTimeout as it would also end the event
+			// stream and board exports after that time.
+			ReadHeaderTimeout: time.Second * 15,
+			ReadTimeout:       time.Second * 15,
+			IdleTimeout:       time.Second * 60,
+			Handler:           router,
+			TLSConfig:         tlsConfig,
 		}
 
 		log.Debug().
@@ -57,32 +142,59 @@ var serverCmd = &cobra.Command{
 
 		redisPool.InitPool(viper.GetString("redis-host"), viper.GetInt("redis-port"))
 
+		expiryCtx, stopExpiry := context.WithCancel(context.Background())
+		expiryDone := make(chan struct{})
+		go func() {
+			defer close(expiryDone)
+			trash.StartExpiry(expiryCtx, pictureStorage, viper.GetDuration("trash-period"), trashExpiryInterval)
+		}()
+
 		// Run our server in a goroutine so that it doesn't block.
+		serveErr := make(chan error, 1)
 		go func() {
-			log.Debug().Msgf("Starting HTTP server: %s", port)
-			if err := srv.ListenAndServe(); err != nil {
-				log.Fatal().Err(err)
+			log.Info().
+				Str("method", "server/init()").
+				Msgf("Starting HTTP server: %s (TLS: %t)", viper.GetString("listen"), tlsConfig != nil)
+
+			if tlsConfig != nil {
+				serveErr <- srv.ServeTLS(listener, "", "")
+			} else {
+				serveErr <- srv.Serve(listener)
 			}
 		}()
 
-		c := make(chan os.Signal, 1)
-		// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-		// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-		signal.Notify(c, os.Interrupt)
-
-		// Block until we receive our signal.
-		<-c
+		// Block until we receive a signal or the server fails.
+		select {
+		case <-ctx.Done():
+		case err := <-serveErr:
+			log.Error().
+				Str("method", "server/init()").
+				Msgf("HTTP server failed: %s", err.Error())
+			stop()
+		}
 
-		// Create a deadline to wait for.
-		ctx, cancel := context.WithTimeout(context.Background(), wait)
-		defer cancel()
-		// Doesn't block if no connections, but will otherwise wait
-		// until the timeout deadline.
 		log.Info().
 			Str("method", "server/init()").
 			Msg("Shutting HTTP server down")
 
-		srv.Shutdown(ctx)
-		os.Exit(0)
+		// Shutdown waits for requests in flight until the deadline.
+		// Event streams end as soon as ctx is done.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("shutdown-timeout"))
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Warn().
+				Str("method", "server/init()").
+				Msgf("Requests still in flight: %s", err.Error())
+			srv.Close()
+		}
+
+		stopExpiry()
+		<-expiryDone
+
+		if err := redisPool.ClosePool(); err != nil {
+			log.Error().
+				Str("method", "server/init()").
+				Msgf("Can not close Redis pool: %s", err.Error())
+		}
 	},
 }
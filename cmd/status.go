@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/githubixx/pinbackup/client"
+	"github.com/githubixx/pinbackup/shutdown"
+)
+
+const (
+	// pollInterval is how often jobs are fetched again while the event
+	// stream is unavailable.
+	pollInterval = 2 * time.Second
+	// refreshInterval is how often jobs are fetched again in addition to
+	// the updates triggered by events.
+	refreshInterval = 10 * time.Second
+	// clearScreen moves the cursor to the top left corner and clears the
+	// terminal.
+	clearScreen = "\033[H\033[2J"
+)
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(waitCmd)
+
+	addClientFlags(statusCmd)
+	addOutputFlag(statusCmd)
+	statusCmd.Flags().BoolVarP(&statusWatch, "watch", "w", false, "Update the display until all jobs are done")
+	statusCmd.Flags().IntVar(&statusLimit, "limit", 20, "Number of latest jobs shown if no UUID is given")
+
+	addClientFlags(waitCmd)
+	addOutputFlag(waitCmd)
+	waitCmd.Flags().DurationVar(&waitTimeout, "timeout", 0, "Give up after this duration (0 waits forever)")
+}
+
+// fetchJobs returns the jobs with the given UUIDs or the latest limit jobs
+// if no UUID is given.
+func fetchJobs(ctx context.Context, c *client.Client, uuids []string, limit int) ([]client.Job, error) {
+	if len(uuids) == 0 {
+		return c.ListJobs(ctx, limit)
+	}
+
+	jobs := []client.Job{}
+	for _, uuid := range uuids {
+		job, err := c.GetJob(ctx, uuid)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", uuid, err)
+		}
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, nil
+}
+
+// allDone returns true if all jobs are finished or failed.
+func allDone(jobs []client.Job) bool {
+	for i := range jobs {
+		if !jobs[i].Done() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// watchJobs fetches the jobs again on every event of the event stream and
+// calls update with the current jobs until update returns true or ctx is
+// done. If the event stream is unavailable the jobs are polled.
+func watchJobs(ctx context.Context, c *client.Client, uuids []string, limit int, update func([]client.Job) bool) error {
+	events, err := c.Events(ctx, uuids...)
+	if err != nil {
+		events = nil
+	}
+
+	for {
+		jobs, err := fetchJobs(ctx, c, uuids, limit)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if update(jobs) {
+			return nil
+		}
+
+		interval := refreshInterval
+		if events == nil {
+			interval = pollInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+			}
+		case <-time.After(interval):
+		}
+	}
+}
+
+// printStatus writes jobs in the requested format.
+func printStatus(format string, jobs []client.Job, watch bool) {
+	switch {
+	case format == outputJSON && watch:
+		// One JSON document per line so the output can be processed while
+		// watching.
+		json.NewEncoder(os.Stdout).Encode(jobs)
+	case format == outputJSON:
+		printJSON(jobs)
+	case watch:
+		fmt.Print(clearScreen)
+		fmt.Printf("Updated %s\n\n", time.Now().Format("15:04:05"))
+		printJobs(os.Stdout, jobs)
+	default:
+		printJobs(os.Stdout, jobs)
+	}
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status [uuid]...",
+	Short: "Shows the status of jobs",
+	Long: `Shows the status and progress of the given jobs or of the latest jobs. With
+--watch the display is updated on every change until all jobs are done. Needs
+an API token with read scope.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format := output()
+		c := apiClient()
+
+		if !statusWatch {
+			jobs, err := fetchJobs(context.Background(), c, args, statusLimit)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			printStatus(format, jobs, false)
+			return
+		}
+
+		ctx, cancel := shutdown.Context()
+		defer cancel()
+
+		err := watchJobs(ctx, c, args, statusLimit, func(jobs []client.Job) bool {
+			printStatus(format, jobs, true)
+			return len(jobs) > 0 && allDone(jobs)
+		})
+		if err != nil && err != context.Canceled {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	},
+}
+
+var waitCmd = &cobra.Command{
+	Use:   "wait <uuid>",
+	Short: "Waits until a job is done",
+	Long: `Waits until a job is finished or failed and prints it. Exits with 0 if the
+job finished, with 1 if it failed or an error occurred and with 2 if
+--timeout was reached. Needs an API token with read scope.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format := output()
+		c := apiClient()
+
+		ctx, cancel := shutdown.Context()
+		defer cancel()
+		if waitTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, waitTimeout)
+			defer cancel()
+		}
+
+		var job client.Job
+		err := watchJobs(ctx, c, args, 0, func(jobs []client.Job) bool {
+			job = jobs[0]
+			return job.Done()
+		})
+		if err == context.DeadlineExceeded {
+			fmt.Fprintf(os.Stderr, "Timeout: Job %s is still %s\n", args[0], job.Status)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		printStatus(format, []client.Job{job}, false)
+
+		if job.Status != "finished" {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	redisPool "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/token"
+)
+
+func init() {
+	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenListCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+
+	tokenCmd.PersistentFlags().StringVar(&redisHost, "redis-host", "localhost", "Redis host name")
+	tokenCmd.PersistentFlags().IntVar(&redisPort, "redis-port", 6379, "Redis port")
+
+	tokenCreateCmd.Flags().StringVar(&tokenName, "name", "", "Name describing what the token is used for")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenScopes, "scope", []string{token.ScopeRead, token.ScopeEnqueue}, "Scopes granted to the token ("+strings.Join(token.Scopes, ", ")+")")
+	tokenCreateCmd.MarkFlagRequired("name")
+
+	replacer := strings.NewReplacer("-", "_")
+	viper.SetEnvKeyReplacer(replacer)
+
+	viper.AutomaticEnv()
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manages API tokens",
+	Long:  `Manages API tokens. Tokens are required to access the REST API of the server.`,
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a new API token",
+	Long:  `Creates a new API token. The token is only shown once. Only its hash is stored in Redis.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		redisPool.InitPool(viper.GetString("redis-host"), viper.GetInt("redis-port"))
+
+		conn, err := redisPool.GetConnection()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+
+		plain, t, err := token.Create(conn, tokenName, tokenScopes)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("ID:     %s\n", t.ID)
+		fmt.Printf("Name:   %s\n", t.Name)
+		fmt.Printf("Scopes: %s\n", strings.Join(t.Scopes, ", "))
+		fmt.Printf("Token:  %s\n", plain)
+		fmt.Println()
+		fmt.Println("Store the token now. It can't be shown again.")
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all API tokens",
+	Long:  `Lists all API tokens.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		redisPool.InitPool(viper.GetString("redis-host"), viper.GetInt("redis-port"))
+
+		conn, err := redisPool.GetConnection()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+
+		tokens, err := token.List(conn)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCREATED")
+		for _, t := range tokens {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.ID, t.Name, strings.Join(t.Scopes, ","), t.Created.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revokes an API token",
+	Long:  `Revokes an API token. Requests using the token are rejected afterwards.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		redisPool.InitPool(viper.GetString("redis-host"), viper.GetInt("redis-port"))
+
+		conn, err := redisPool.GetConnection()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer conn.Close()
+
+		if err := token.Revoke(conn, args[0]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Token %s revoked\n", args[0])
+	},
+}
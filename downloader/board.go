@@ -0,0 +1,110 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"path"
+
+	"github.com/rs/zerolog/log"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/scraper"
+	"github.com/githubixx/pinbackup/storage"
+)
+
+// boardFile is the content of the metadata file stored next to the
+// pictures of a board.
+type boardFile struct {
+	User string `json:"user"`
+	Path string `json:"path"`
+	*redisClient.BoardMeta
+	History []redisClient.BoardChange `json:"history"`
+}
+
+// coverName returns the name the cover is stored under.
+func coverName(cover string) string {
+	ext := ".jpg"
+	if u, err := url.Parse(cover); err == nil && path.Ext(u.Path) != "" {
+		ext = path.Ext(u.Path)
+	}
+
+	return storage.CoverFile + ext
+}
+
+// saveCover downloads the cover of a board.
+func (d *downloader) saveCover(ctx context.Context, user string, board string, cover string, name string) error {
+	resp, err := get(ctx, cover)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	file, err := d.storage.Create(user, board, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Abort()
+		return err
+	}
+
+	return file.Close()
+}
+
+// saveBoard stores the metadata of a board including its changes next to
+// the pictures. The cover is downloaded again if it changed.
+func (d *downloader) saveBoard(ctx context.Context, picture *scraper.Picture) error {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	meta, err := redisClient.GetBoardMeta(conn, picture.User, picture.Path)
+	if err != nil || meta == nil {
+		return err
+	}
+
+	if meta.Cover != "" {
+		name := coverName(meta.Cover)
+		_, statErr := d.storage.Stat(picture.User, picture.Path, name)
+		if meta.CoverFile != name || statErr != nil {
+			if err := d.saveCover(ctx, picture.User, picture.Path, meta.Cover, name); err != nil {
+				// The metadata is still worth saving.
+				log.Warn().
+					Str("method", "saveBoard").
+					Msgf("Can not download cover %s of %s:%s: %s", meta.Cover, picture.User, picture.Path, err.Error())
+			} else {
+				meta.CoverFile = name
+				if err := redisClient.SetBoardCoverFile(conn, picture.User, picture.Path, meta.Cover, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	history, err := redisClient.BoardHistory(conn, picture.User, picture.Path)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(boardFile{User: picture.User, Path: picture.Path, BoardMeta: meta, History: history}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := d.storage.Create(picture.User, picture.Path, storage.BoardMetaFile)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Abort()
+		return err
+	}
+
+	return file.Close()
+}
@@ -8,16 +8,27 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/rs/zerolog/log"
 
+	"github.com/githubixx/pinbackup/events"
+	"github.com/githubixx/pinbackup/health"
+	"github.com/githubixx/pinbackup/job"
+	"github.com/githubixx/pinbackup/metrics"
 	redisClient "github.com/githubixx/pinbackup/redis"
 	"github.com/githubixx/pinbackup/scraper"
+	"github.com/githubixx/pinbackup/shutdown"
+	"github.com/githubixx/pinbackup/storage"
 )
 
 var (
@@ -32,23 +43,29 @@ type Config struct {
 	StorageType    string
 	FsDownloadPath string
 	DownloadQueue  string
+	MetricsListen  string
+	// FFmpeg is the ffmpeg executable used to remux HLS streams into MP4
+	// files.
+	FFmpeg string
+	// MinFreeSpace is the minimum free space in MiB required in
+	// FsDownloadPath for the downloader to be ready.
+	MinFreeSpace uint64
+	// ShutdownTimeout is how long downloads in flight may take to finish
+	// on shutdown until they are aborted.
+	ShutdownTimeout time.Duration
 }
 
+const (
+	// outcomeDownloaded is returned by download if the picture was fetched.
+	outcomeDownloaded = "downloaded"
+	// outcomeSkipped is returned by download if the picture already existed.
+	outcomeSkipped = "skipped"
+)
+
 // downloader struct contains configuration for downloader
 type downloader struct {
-	config *Config
-}
-
-// createDirectory creates a directory and all subpaths. All directories
-// will be created with permissions specified in fileMode parameter.
-func createDirectory(path string, fileMode uint32) error {
-	if path == "" {
-		return errors.New("Path needed to create destination directory.")
-	}
-
-	err := os.MkdirAll(path, os.FileMode(fileMode))
-
-	return err
+	config  *Config
+	storage storage.Storage
 }
 
 // parseFilename returns the filename that is part of the requestURI e.g.:
@@ -68,75 +85,247 @@ func parseFilename(requestURI string) (string, error) {
 	return filename[1], nil
 }
 
-// download fetches picture and stores it int specified path.
-func (d *downloader) download(ctx context.Context, picture *scraper.Picture, fsDownloadPath string) error {
-	var (
-		err error
-	)
+// get fetches a URL and fails on any other status than 200 OK.
+func get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
 
-	// Parse URL of picture
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New(fmt.Sprintf("Fetching %s failed: %s", u, resp.Status))
+	}
+
+	return resp, nil
+}
+
+// mediaFilename returns the name a picture is stored under. HLS playlists
+// are stored as the MP4 file their segments are remuxed into.
+func mediaFilename(picture *scraper.Picture) (string, error) {
 	parsedURL, err := url.Parse(picture.Url)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	// Parse filename
-	filename, err := parseFilename(parsedURL.RequestURI())
+	if picture.Kind != scraper.KindHLS {
+		return parseFilename(parsedURL.RequestURI())
+	}
+
+	filename, err := parseFilename(parsedURL.Path)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	// Construct destination where to store pictures
-	destinationPath := fsDownloadPath + "/" + picture.User + "/" + picture.Path
-	destinationFile := destinationPath + "/" + filename
+	return strings.TrimSuffix(filename, path.Ext(filename)) + ".mp4", nil
+}
+
+// tempFile is a file that's removed together with its directory on close.
+type tempFile struct {
+	*os.File
+	dir string
+}
 
-	// Skip download if file already exists
-	if _, err := os.Stat(destinationFile); !os.IsNotExist(err) {
+func (t *tempFile) Close() error {
+	err := t.File.Close()
+	os.RemoveAll(t.dir)
+	return err
+}
+
+// open returns the content of a picture. HLS streams are remuxed into a
+// temporary MP4 file first.
+func (d *downloader) open(ctx context.Context, picture *scraper.Picture) (io.ReadCloser, error) {
+	if picture.Kind != scraper.KindHLS {
+		// TODO Implement retry logic
+		// The download is aborted with ctx on shutdown. Error pages of
+		// the CDN are not saved as pictures.
+		response, err := get(ctx, picture.Url)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Fetching picture %s failed: %s", picture.Url, err.Error()))
+		}
+		return response.Body, nil
+	}
+
+	dir, err := ioutil.TempDir("", "pinbackup-hls-")
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := d.remuxHLS(ctx, picture.Url, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return &tempFile{File: f, dir: dir}, nil
+}
+
+// download fetches picture and stores it in the storage backend. Returns
+// outcomeDownloaded or outcomeSkipped if the picture was already stored.
+func (d *downloader) download(ctx context.Context, picture *scraper.Picture) (string, error) {
+	var (
+		err   error
+		start = time.Now()
+	)
+
+	// Parse filename
+	filename, err := mediaFilename(picture)
+	if err != nil {
+		return "", err
+	}
+
+	// Skip download if file already exists. Other errors e.g. an invalid
+	// user or board fail the picture.
+	_, err = d.storage.Stat(picture.User, picture.Path, filename)
+	if err == nil {
 		log.Trace().
 			Str("method", "download").
-			Msgf("%s already exists. Skipping...", destinationFile)
-		return nil
+			Msgf("%s/%s/%s already exists. Skipping...", picture.User, picture.Path, filename)
+		metrics.Downloads.WithLabelValues("skipped").Inc()
+		return outcomeSkipped, nil
+	}
+	if err != storage.ErrNotExist {
+		return "", err
 	}
 
-	// Create destination directory
-	err = createDirectory(destinationPath, 0755)
+	content, err := d.open(ctx, picture)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Creating destination directory for picture %s failed: %s", picture.Url, err.Error()))
+		return "", err
 	}
+	defer content.Close()
 
-	// TODO Implement retry logic
-	// TODO Implement timeout
-	response, err := http.Get(picture.Url)
+	// Create destination file
+	file, err := d.storage.Create(picture.User, picture.Path, filename)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Fetching picture %s failed.", picture.Url))
+		return "", errors.New(fmt.Sprintf("Saving picture %s failed: %s", filename, err.Error()))
 	}
-	defer response.Body.Close()
 
-	// Create destination file
-	// TODO Check if filesystem has enough space
-	file, err := os.Create(destinationFile)
+	// A truncated picture would be skipped by all later downloads.
+	written, err := io.Copy(file, content)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Saving picture %s failed: %s", filename, err.Error()))
+		file.Abort()
+		return "", errors.New(fmt.Sprintf("Saving picture %s failed: %s", filename, err.Error()))
+	}
+	if err := file.Close(); err != nil {
+		return "", errors.New(fmt.Sprintf("Saving picture %s failed: %s", filename, err.Error()))
+	}
+
+	metrics.Downloads.WithLabelValues("success").Inc()
+	metrics.DownloadedBytes.Add(float64(written))
+	metrics.DownloadDuration.Observe(time.Since(start).Seconds())
+
+	return outcomeDownloaded, nil
+}
+
+// record adds the picture to the board in Redis and updates the counters
+// of the job the picture belongs to. outcome is outcomeDownloaded,
+// outcomeSkipped or "failed".
+func record(picture *scraper.Picture, outcome string) error {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if outcome != "failed" {
+		filename, err := mediaFilename(picture)
+		if err != nil {
+			return err
+		}
+
+		if err := redisClient.AddPicture(conn, picture.User+":"+picture.Path, filename); err != nil {
+			return err
+		}
+
+		if err := redisClient.IndexBoard(conn, picture.User, picture.Path); err != nil {
+			return err
+		}
+
+		// Pictures that were skipped keep the metadata of the download.
+		info := &redisClient.PictureInfo{URL: picture.Url, UUID: picture.UUID, Downloaded: time.Now().Unix()}
+		if err := redisClient.SetPictureInfo(conn, picture.User, picture.Path, filename, info, outcome == outcomeDownloaded); err != nil {
+			return err
+		}
+	}
+
+	// Pictures published by older scrapers don't belong to a job.
+	if picture.UUID == "" {
+		return nil
+	}
+
+	if err := job.IncrProcessed(conn, picture.UUID, outcome); err != nil {
+		return err
 	}
-	defer file.Close()
 
-	_, err = io.Copy(file, response.Body)
+	event := events.Event{UUID: picture.UUID, User: picture.User, Path: picture.Path, URL: picture.Url}
+	switch outcome {
+	case outcomeDownloaded:
+		event.Type = events.TypePictureDownloaded
+	case outcomeSkipped:
+		event.Type = events.TypePictureSkipped
+	default:
+		event.Type = events.TypePictureFailed
+	}
+	events.Publish(conn, event)
+
+	finished, err := job.FinishIfDone(conn, picture.UUID)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Saving picture %s failed: %s", filename, err.Error()))
+		return err
+	}
+
+	if finished {
+		if err := redisClient.TouchBoard(conn, picture.User, picture.Path, time.Now()); err != nil {
+			return err
+		}
+		events.Publish(conn, events.Event{
+			Type: events.TypeJobFinished,
+			UUID: picture.UUID,
+			User: picture.User,
+			Path: picture.Path,
+		})
 	}
 
 	return nil
 }
 
-// StartProcessQueue waits for incoming download jobs and download pictures.
-func StartProcessQueue(config *Config) error {
+// HealthChecks returns the checks used for the readiness probe of the
+// downloader: Redis, storage writable and free disk space.
+func HealthChecks(config *Config) []health.Check {
+	return []health.Check{
+		health.Redis(),
+		health.StorageWritable(config.FsDownloadPath),
+		health.FreeSpace(config.FsDownloadPath, config.MinFreeSpace<<20),
+	}
+}
+
+// StartProcessQueue waits for incoming download jobs and download pictures
+// until ctx is done. Downloads in flight are drained before it returns.
+func StartProcessQueue(ctx context.Context, config *Config) error {
 	semChan := make(chan bool, 1)
 
 	log.Debug().
 		Str("method", "StartProcessQueue").
 		Msg("Init Redis connection pool")
 
+	pictureStorage, err := storage.New(config.StorageType, config.FsDownloadPath)
+	if err != nil {
+		return err
+	}
+
 	redisClient.InitPool(config.RedisHost, config.RedisPort)
+
+	metrics.Serve(config.MetricsListen, health.Routes(HealthChecks(config)...))
+
 	conn, err := redisClient.GetConnection()
 	if err != nil {
 		return err
@@ -150,13 +339,42 @@ func StartProcessQueue(config *Config) error {
 	// TODO: Needs to be replaced with Redis Streams for persistence.
 	psc := redis.PubSubConn{Conn: conn}
 	psc.Subscribe(config.DownloadQueue)
+
+	// Unsubscribing on shutdown ends the receive loop below.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			psc.Unsubscribe()
+		case <-stop:
+		}
+	}()
+
+	// Downloads in flight use their own context so they aren't aborted
+	// immediately on shutdown.
+	var inFlight sync.WaitGroup
+	workCtx, abortWork := context.WithCancel(context.Background())
+	defer abortWork()
+
 	for {
 		switch v := psc.Receive().(type) {
 		case redis.Message:
 			// Block one slot in buffered channel
+			metrics.QueueDepth.WithLabelValues(config.DownloadQueue).Inc()
 			semChan <- true
+			metrics.QueueDepth.WithLabelValues(config.DownloadQueue).Dec()
+			inFlight.Add(1)
 			go func(message []byte) {
-				ctx, cancel := context.WithCancel(context.Background())
+				metrics.InFlight.WithLabelValues("downloader").Inc()
+				defer func() {
+					inFlight.Done()
+					metrics.InFlight.WithLabelValues("downloader").Dec()
+					// release slot in buffered channel
+					<-semChan
+				}()
+
+				ctx, cancel := context.WithCancel(workCtx)
 				defer cancel()
 
 				picture := scraper.Picture{}
@@ -170,25 +388,50 @@ func StartProcessQueue(config *Config) error {
 				}
 
 				d := downloader{
-					config: config,
+					config:  config,
+					storage: pictureStorage,
+				}
+
+				// The metadata of the board isn't a picture of the job.
+				if picture.Kind == scraper.KindBoard {
+					if err := d.saveBoard(ctx, &picture); err != nil {
+						log.Error().
+							Str("method", "StartProcessQueue").
+							Msgf("Saving metadata of %s:%s failed: %s", picture.User, picture.Path, err.Error())
+					}
+					return
 				}
 
 				log.Debug().
 					Str("method", "StartProcessQueue").
 					Msgf("Downloading picture URL: %s", picture.Url)
 
-				err = d.download(ctx, &picture, config.FsDownloadPath)
+				outcome, err := d.download(ctx, &picture)
 				if err != nil {
+					outcome = "failed"
+					metrics.Downloads.WithLabelValues("failure").Inc()
 					log.Error().
 						Str("method", "StartProcessQueue").
 						Msgf("Picture download error: %s", picture.Url)
 				}
 
-				// release slot in buffered channel
-				<-semChan
+				if err := record(&picture, outcome); err != nil {
+					log.Error().
+						Str("method", "StartProcessQueue").
+						Msgf("Recording picture %s failed: %s", picture.Url, err.Error())
+				}
 			}(v.Data)
+		case redis.Subscription:
+			if v.Count == 0 {
+				log.Info().
+					Str("method", "StartProcessQueue").
+					Msg("Waiting for downloads in flight")
+				shutdown.Drain(&inFlight, config.ShutdownTimeout, abortWork)
+				return nil
+			}
 		case error:
 			// TODO: Needs to be handled
+			shutdown.Drain(&inFlight, config.ShutdownTimeout, abortWork)
 			return v
 		}
 	}
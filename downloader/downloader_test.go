@@ -0,0 +1,77 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/githubixx/pinbackup/scraper"
+	"github.com/githubixx/pinbackup/storage"
+)
+
+func TestDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/truncated.jpg":
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("partial"))
+		case "/missing.jpg":
+			http.NotFound(w, r)
+		case "/stalled.jpg":
+			// Never answers until the request is aborted.
+			<-r.Context().Done()
+		default:
+			w.Write([]byte("picture"))
+		}
+	}))
+	defer server.Close()
+
+	fs, err := storage.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := downloader{config: &Config{}, storage: fs}
+
+	var downloadTests = []struct {
+		user    string
+		name    string
+		outcome string
+	}{
+		{"user", "a.jpg", outcomeDownloaded},
+		{"user", "a.jpg", outcomeSkipped},
+		{"..", "b.jpg", ""},
+		// Error pages are not saved as pictures.
+		{"user", "missing.jpg", ""},
+		{"user", "truncated.jpg", ""},
+		// The truncated picture wasn't stored so it's downloaded again.
+		{"user", "truncated.jpg", ""},
+	}
+
+	for _, test := range downloadTests {
+		picture := &scraper.Picture{User: test.user, Path: "board", Url: server.URL + "/" + test.name}
+		outcome, err := d.download(context.Background(), picture)
+		if outcome != test.outcome || (err != nil) != (test.outcome == "") {
+			t.Errorf("%s/%s: Got: %q, error: %v / Expected: %q", test.user, test.name, outcome, err, test.outcome)
+		}
+	}
+
+	for _, name := range []string{"missing.jpg", "truncated.jpg"} {
+		if _, err := fs.Stat("user", "board", name); err != storage.ErrNotExist {
+			t.Errorf("Got error: %v / Expected: %s not stored", err, name)
+		}
+	}
+
+	// Stalled downloads are aborted on shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	picture := &scraper.Picture{User: "user", Path: "board", Url: server.URL + "/stalled.jpg"}
+	if _, err := d.download(ctx, picture); err == nil {
+		t.Error("Got: no error for stalled download / Expected: error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Got: aborted after %s / Expected: aborted with the context", elapsed)
+	}
+}
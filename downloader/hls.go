@@ -0,0 +1,294 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxHLSSegments bounds the segments of a playlist so a broken
+	// playlist can't fill the disk.
+	maxHLSSegments = 20000
+	// maxPlaylistSize is the maximum size of a playlist in bytes.
+	maxPlaylistSize = 4 << 20
+
+	// DefaultFFmpeg is the ffmpeg executable used to remux HLS streams.
+	DefaultFFmpeg = "ffmpeg"
+)
+
+// hlsVariant is a stream of a master playlist.
+type hlsVariant struct {
+	uri       string
+	bandwidth int
+	// audio is the group of the audio renditions if the audio isn't part
+	// of the stream.
+	audio string
+}
+
+// hlsPlaylist is a master playlist listing variants or a media playlist
+// listing the segments of a stream.
+type hlsPlaylist struct {
+	variants []hlsVariant
+	// audio maps the audio groups to the URI of their first rendition.
+	audio map[string]string
+	// init is the initialization section of fragmented MP4 segments.
+	init     string
+	segments []string
+}
+
+// parseAttributes parses the attribute list of a tag e.g.
+// BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2".
+func parseAttributes(list string) map[string]string {
+	attributes := map[string]string{}
+
+	for list != "" {
+		eq := strings.IndexByte(list, '=')
+		if eq < 0 {
+			break
+		}
+		name := strings.TrimSpace(list[:eq])
+		list = list[eq+1:]
+
+		var value string
+		if strings.HasPrefix(list, `"`) {
+			end := strings.IndexByte(list[1:], '"')
+			if end < 0 {
+				value, list = list[1:], ""
+			} else {
+				value, list = list[1:end+1], list[end+2:]
+			}
+		} else if comma := strings.IndexByte(list, ','); comma >= 0 {
+			value, list = list[:comma], list[comma:]
+		} else {
+			value, list = list, ""
+		}
+		list = strings.TrimPrefix(list, ",")
+
+		attributes[name] = value
+	}
+
+	return attributes
+}
+
+// parsePlaylist parses a playlist. URIs are resolved relative to base.
+func parsePlaylist(base *url.URL, r io.Reader) (*hlsPlaylist, error) {
+	playlist := &hlsPlaylist{audio: map[string]string{}}
+
+	resolve := func(uri string) (string, error) {
+		u, err := base.Parse(uri)
+		if err != nil {
+			return "", errors.Wrapf(err, "Invalid URI %s in playlist", uri)
+		}
+		return u.String(), nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	var variant *hlsVariant
+
+	for n := 0; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if n == 0 {
+			if line != "#EXTM3U" {
+				return nil, errors.New("Not a HLS playlist")
+			}
+			continue
+		}
+
+		switch {
+		case line == "":
+			continue
+
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attributes := parseAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			bandwidth, _ := strconv.Atoi(attributes["BANDWIDTH"])
+			variant = &hlsVariant{bandwidth: bandwidth, audio: attributes["AUDIO"]}
+
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attributes := parseAttributes(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			if attributes["TYPE"] != "AUDIO" || attributes["URI"] == "" {
+				continue
+			}
+			if _, ok := playlist.audio[attributes["GROUP-ID"]]; ok && attributes["DEFAULT"] != "YES" {
+				continue
+			}
+			uri, err := resolve(attributes["URI"])
+			if err != nil {
+				return nil, err
+			}
+			playlist.audio[attributes["GROUP-ID"]] = uri
+
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			uri, err := resolve(parseAttributes(strings.TrimPrefix(line, "#EXT-X-MAP:"))["URI"])
+			if err != nil {
+				return nil, err
+			}
+			playlist.init = uri
+
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			method := parseAttributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))["METHOD"]
+			if method != "" && method != "NONE" {
+				return nil, errors.Errorf("Encrypted HLS streams (%s) are not supported", method)
+			}
+
+		case strings.HasPrefix(line, "#"):
+			// Other tags and comments don't matter for remuxing.
+			continue
+
+		default:
+			uri, err := resolve(line)
+			if err != nil {
+				return nil, err
+			}
+			if variant != nil {
+				variant.uri = uri
+				playlist.variants = append(playlist.variants, *variant)
+				variant = nil
+				continue
+			}
+			if len(playlist.segments) >= maxHLSSegments {
+				return nil, errors.Errorf("Playlist has more than %d segments", maxHLSSegments)
+			}
+			playlist.segments = append(playlist.segments, uri)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(playlist.variants) == 0 && len(playlist.segments) == 0 {
+		return nil, errors.New("Playlist has neither streams nor segments")
+	}
+
+	return playlist, nil
+}
+
+// best returns the variant with the highest bandwidth.
+func (p *hlsPlaylist) best() hlsVariant {
+	best := p.variants[0]
+	for _, variant := range p.variants[1:] {
+		if variant.bandwidth > best.bandwidth {
+			best = variant
+		}
+	}
+
+	return best
+}
+
+// fetchPlaylist fetches and parses a playlist.
+func fetchPlaylist(ctx context.Context, u string) (*hlsPlaylist, error) {
+	base, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	playlist, err := parsePlaylist(base, io.LimitReader(resp.Body, maxPlaylistSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Parsing playlist %s failed", u)
+	}
+
+	return playlist, nil
+}
+
+// fetchStream concatenates the init section and all segments of a media
+// playlist into file.
+func fetchStream(ctx context.Context, u string, file string) error {
+	playlist, err := fetchPlaylist(ctx, u)
+	if err != nil {
+		return err
+	}
+	if len(playlist.variants) > 0 {
+		return errors.Errorf("Playlist %s is a master playlist", u)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	parts := playlist.segments
+	if playlist.init != "" {
+		parts = append([]string{playlist.init}, parts...)
+	}
+
+	for _, part := range parts {
+		resp, err := get(ctx, part)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return errors.Wrapf(err, "Fetching segment %s failed", part)
+		}
+	}
+
+	return f.Close()
+}
+
+// remuxHLS fetches the best stream of a HLS playlist into dir and remuxes
+// it with ffmpeg into a MP4 file. Returns the path of the MP4 file.
+func (d *downloader) remuxHLS(ctx context.Context, u string, dir string) (string, error) {
+	playlist, err := fetchPlaylist(ctx, u)
+	if err != nil {
+		return "", err
+	}
+
+	video, audio := u, ""
+	if len(playlist.variants) > 0 {
+		variant := playlist.best()
+		video, audio = variant.uri, playlist.audio[variant.audio]
+	}
+
+	log.Trace().
+		Str("method", "remuxHLS").
+		Msgf("Fetching stream %s (audio: %s)", video, audio)
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-y"}
+
+	videoFile := filepath.Join(dir, "video")
+	if err := fetchStream(ctx, video, videoFile); err != nil {
+		return "", err
+	}
+	args = append(args, "-i", videoFile)
+
+	if audio != "" {
+		audioFile := filepath.Join(dir, "audio")
+		if err := fetchStream(ctx, audio, audioFile); err != nil {
+			return "", err
+		}
+		args = append(args, "-i", audioFile, "-map", "0:v", "-map", "1:a")
+	}
+
+	output := filepath.Join(dir, "output.mp4")
+	args = append(args, "-c", "copy", "-movflags", "+faststart", "-f", "mp4", output)
+
+	ffmpeg := d.config.FFmpeg
+	if ffmpeg == "" {
+		ffmpeg = DefaultFFmpeg
+	}
+
+	out, err := exec.CommandContext(ctx, ffmpeg, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("Remuxing %s with %s failed: %s: %s", u, ffmpeg, err, strings.TrimSpace(string(out)))
+	}
+
+	return output, nil
+}
@@ -0,0 +1,190 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/githubixx/pinbackup/scraper"
+)
+
+const (
+	testMaster = `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="English",DEFAULT=YES,URI="audio/index.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=640000,CODECS="avc1.4d401e,mp4a.40.2",AUDIO="audio"
+360p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="audio"
+720p/index.m3u8
+`
+	testMedia = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:4.0,
+segment0.m4s
+#EXTINF:4.0,
+segment1.m4s
+#EXT-X-ENDLIST
+`
+)
+
+func TestParseAttributes(t *testing.T) {
+	got := parseAttributes(`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",AUDIO="aac"`)
+	expected := map[string]string{"BANDWIDTH": "1280000", "CODECS": "avc1.4d401f,mp4a.40.2", "AUDIO": "aac"}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got: %v / Expected: %v", got, expected)
+	}
+}
+
+func TestParsePlaylist(t *testing.T) {
+	base, _ := url.Parse("https://v1.pinimg.com/videos/mc/hls/e9/48/9b/e9489b231c1c8393622c6eec79c5e6f8.m3u8")
+
+	master, err := parsePlaylist(base, strings.NewReader(testMaster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := master.best()
+	if best.uri != "https://v1.pinimg.com/videos/mc/hls/e9/48/9b/720p/index.m3u8" || best.bandwidth != 2560000 {
+		t.Errorf("Got: %+v / Expected: 720p variant", best)
+	}
+	if audio := master.audio[best.audio]; audio != "https://v1.pinimg.com/videos/mc/hls/e9/48/9b/audio/index.m3u8" {
+		t.Errorf("Got: %s / Expected: audio rendition", audio)
+	}
+
+	media, err := parsePlaylist(base, strings.NewReader(testMedia))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media.init != "https://v1.pinimg.com/videos/mc/hls/e9/48/9b/init.mp4" {
+		t.Errorf("Got: %s / Expected: init section", media.init)
+	}
+	expected := []string{
+		"https://v1.pinimg.com/videos/mc/hls/e9/48/9b/segment0.m4s",
+		"https://v1.pinimg.com/videos/mc/hls/e9/48/9b/segment1.m4s",
+	}
+	if !reflect.DeepEqual(media.segments, expected) {
+		t.Errorf("Got: %v / Expected: %v", media.segments, expected)
+	}
+
+	var invalidTests = []string{
+		"<html></html>",
+		"#EXTM3U\n#EXT-X-ENDLIST\n",
+		"#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key\"\n#EXTINF:4.0,\nsegment0.ts\n",
+	}
+	for _, playlist := range invalidTests {
+		if _, err := parsePlaylist(base, strings.NewReader(playlist)); err == nil {
+			t.Errorf("Got: no error for %q / Expected: error", playlist)
+		}
+	}
+}
+
+func TestMediaFilename(t *testing.T) {
+	var filenameTests = []struct {
+		picture  scraper.Picture
+		filename string
+	}{
+		{scraper.Picture{Url: "https://i.pinimg.com/originals/4a/69/a5/4a69a545f70f78cc99b31bb81c49831c.jpg"}, "4a69a545f70f78cc99b31bb81c49831c.jpg"},
+		{scraper.Picture{Url: "https://i.pinimg.com/originals/4a/69/a5/4a69a545f70f78cc99b31bb81c49831c.gif", Kind: scraper.KindGIF}, "4a69a545f70f78cc99b31bb81c49831c.gif"},
+		{scraper.Picture{Url: "https://v1.pinimg.com/videos/mc/720p/e9/48/9b/e9489b231c1c8393622c6eec79c5e6f8.mp4", Kind: scraper.KindVideo}, "e9489b231c1c8393622c6eec79c5e6f8.mp4"},
+		{scraper.Picture{Url: "https://v1.pinimg.com/videos/mc/hls/e9/48/9b/e9489b231c1c8393622c6eec79c5e6f8.m3u8?token=1", Kind: scraper.KindHLS}, "e9489b231c1c8393622c6eec79c5e6f8.mp4"},
+	}
+
+	for _, test := range filenameTests {
+		filename, err := mediaFilename(&test.picture)
+		if err != nil || filename != test.filename {
+			t.Errorf("Got: %s (%v) / Expected: %s", filename, err, test.filename)
+		}
+	}
+}
+
+// newHLSServer serves a master playlist at /master.m3u8 with a video and an
+// audio stream of two segments each.
+func newHLSServer() *httptest.Server {
+	files := map[string]string{
+		"/master.m3u8":        strings.Replace(testMaster, "360p/index.m3u8", "missing.m3u8", 1),
+		"/720p/index.m3u8":    testMedia,
+		"/720p/init.mp4":      "video-init ",
+		"/720p/segment0.m4s":  "video-0 ",
+		"/720p/segment1.m4s":  "video-1",
+		"/audio/index.m3u8":   testMedia,
+		"/audio/init.mp4":     "audio-init ",
+		"/audio/segment0.m4s": "audio-0 ",
+		"/audio/segment1.m4s": "audio-1",
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+}
+
+func TestFetchStream(t *testing.T) {
+	server := newHLSServer()
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "video")
+	if err := fetchStream(context.Background(), server.URL+"/720p/index.m3u8", file); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "video-init video-0 video-1" {
+		t.Errorf("Got: %q / Expected: init section followed by segments", content)
+	}
+
+	if err := fetchStream(context.Background(), server.URL+"/master.m3u8", file); err == nil {
+		t.Errorf("Got: no error for master playlist / Expected: error")
+	}
+	if err := fetchStream(context.Background(), server.URL+"/missing.m3u8", file); err == nil {
+		t.Errorf("Got: no error for missing playlist / Expected: error")
+	}
+}
+
+func TestRemuxHLS(t *testing.T) {
+	if _, err := exec.LookPath(DefaultFFmpeg); err != nil {
+		t.Skip("ffmpeg not found")
+	}
+
+	// Generate a short HLS stream to remux.
+	dir := t.TempDir()
+	out, err := exec.Command(DefaultFFmpeg, "-hide_banner", "-loglevel", "error",
+		"-f", "lavfi", "-i", "testsrc=duration=2:size=64x64:rate=10",
+		"-c:v", "mpeg4", "-f", "hls", "-hls_time", "1", "-hls_playlist_type", "vod",
+		filepath.Join(dir, "index.m3u8")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Can not generate HLS stream: %s: %s", err, out)
+	}
+
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	d := downloader{config: &Config{FFmpeg: DefaultFFmpeg}}
+	output, err := d.remuxHLS(context.Background(), server.URL+"/index.m3u8", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) < 8 || string(content[4:8]) != "ftyp" {
+		t.Errorf("Got: %d bytes without ftyp box / Expected: MP4 file", len(content))
+	}
+}
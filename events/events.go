@@ -0,0 +1,73 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/rs/zerolog/log"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// Channel is the Redis Pub/Sub channel all job lifecycle events are
+// published to.
+const Channel = "pinbackup:events"
+
+const (
+	// TypeScrapeStarted is published when the scraper starts a job.
+	TypeScrapeStarted = "scrape.started"
+	// TypePinsDiscovered is published after every scroll that found new pins.
+	TypePinsDiscovered = "pins.discovered"
+	// TypeScrapeFinished is published when the scraper found all pins.
+	TypeScrapeFinished = "scrape.finished"
+	// TypePictureDownloaded is published for every downloaded picture.
+	TypePictureDownloaded = "picture.downloaded"
+	// TypePictureSkipped is published for pictures that were already stored.
+	TypePictureSkipped = "picture.skipped"
+	// TypePictureFailed is published if a picture couldn't be downloaded.
+	TypePictureFailed = "picture.failed"
+	// TypeJobFinished is published when all pins of a job were processed.
+	TypeJobFinished = "job.finished"
+	// TypeJobFailed is published if a job couldn't be finished.
+	TypeJobFailed = "job.failed"
+)
+
+// Event describes something that happened to a job.
+type Event struct {
+	Type  string `json:"type"`
+	UUID  string `json:"uuid"`
+	Time  int64  `json:"time"`
+	User  string `json:"user,omitempty"`
+	Path  string `json:"path,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Count int    `json:"count,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Publish sends an event to Channel. Events are informational only. So
+// errors are logged but not returned to not interrupt scraping or
+// downloading.
+func Publish(conn redis.Conn, event Event) {
+	if event.UUID == "" {
+		return
+	}
+
+	if event.Time == 0 {
+		event.Time = time.Now().Unix()
+	}
+
+	message, err := json.Marshal(event)
+	if err != nil {
+		log.Error().
+			Str("method", "Publish").
+			Msgf("Can not encode event %s: %s", event.Type, err.Error())
+		return
+	}
+
+	if err := redisClient.Publish(conn, Channel, message); err != nil {
+		log.Error().
+			Str("method", "Publish").
+			Msgf("Can not publish event %s: %s", event.Type, err.Error())
+	}
+}
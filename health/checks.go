@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// Redis checks that a connection can be borrowed from the Redis pool and
+// that Redis answers to PING.
+func Redis() Check {
+	return Check{
+		Name: "redis",
+		Hint: "Verify that Redis is running and that --redis-host and --redis-port point to it.",
+		Run: func(ctx context.Context) error {
+			return redisClient.Ping()
+		},
+	}
+}
+
+// StorageWritable checks that a file can be created in path.
+func StorageWritable(path string) Check {
+	return Check{
+		Name: "storage-writable",
+		Hint: fmt.Sprintf("Make sure %s exists and is writable by the user running pinbackup (check volume mounts).", path),
+		Run: func(ctx context.Context) error {
+			file, err := ioutil.TempFile(path, ".pinbackup-health-")
+			if err != nil {
+				return err
+			}
+			file.Close()
+
+			return os.Remove(file.Name())
+		},
+	}
+}
+
+// FreeSpace checks that at least minFreeBytes are available in path.
+func FreeSpace(path string, minFreeBytes uint64) Check {
+	return Check{
+		Name: "storage-free-space",
+		Hint: fmt.Sprintf("Free up disk space in %s or point the download path to a bigger volume.", path),
+		Run: func(ctx context.Context) error {
+			free, err := freeBytes(path)
+			if err != nil {
+				return err
+			}
+
+			if free < minFreeBytes {
+				return fmt.Errorf("only %d MiB free, at least %d MiB required", free>>20, minFreeBytes>>20)
+			}
+
+			return nil
+		},
+	}
+}
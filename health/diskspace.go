@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package health
+
+import (
+	"syscall"
+)
+
+// freeBytes returns the number of bytes available to unprivileged users on
+// the filesystem containing path.
+func freeBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
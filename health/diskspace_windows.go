@@ -0,0 +1,10 @@
+package health
+
+import (
+	"errors"
+)
+
+// freeBytes isn't supported on Windows.
+func freeBytes(path string) (uint64, error) {
+	return 0, errors.New("free disk space check not supported on windows")
+}
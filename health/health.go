@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// StatusOK is reported for checks that passed.
+	StatusOK = "ok"
+	// StatusFailed is reported for checks that failed.
+	StatusFailed = "failed"
+)
+
+// Check is a single named health check. Hint should tell the user what to
+// do if the check fails.
+type Check struct {
+	Name string
+	Hint string
+	Run  func(ctx context.Context) error
+}
+
+// Result contains the outcome of a Check.
+type Result struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// Report contains the results of all checks. Status is StatusFailed if at
+// least one check failed.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Run executes all checks one after another and returns a report. Every
+// check gets at most timeout to finish.
+func Run(ctx context.Context, timeout time.Duration, checks ...Check) Report {
+	report := Report{Status: StatusOK, Checks: []Result{}}
+
+	for _, check := range checks {
+		result := Result{Name: check.Name, Status: StatusOK}
+
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := check.Run(checkCtx)
+		cancel()
+
+		if err != nil {
+			result.Status = StatusFailed
+			result.Error = err.Error()
+			result.Hint = check.Hint
+			report.Status = StatusFailed
+
+			log.Debug().
+				Str("method", "Run").
+				Msgf("Health check %s failed: %s", check.Name, err.Error())
+		}
+
+		report.Checks = append(report.Checks, result)
+	}
+
+	return report
+}
+
+// Handler returns a HTTP handler that runs all checks and responds with the
+// JSON report. The status code is 200 if all checks passed and 503
+// otherwise.
+func Handler(checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := Run(r.Context(), 5*time.Second, checks...)
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+
+		response, err := json.Marshal(report)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(status)
+		w.Write(response)
+	}
+}
+
+// Routes returns the liveness probe at /healthz, which only reports that
+// the process is able to serve requests, and the readiness probe at /readyz
+// which runs all checks.
+func Routes(checks ...Check) map[string]http.Handler {
+	return map[string]http.Handler{
+		"/healthz": Handler(),
+		"/readyz":  Handler(checks...),
+	}
+}
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func okCheck() Check {
+	return Check{Name: "ok", Run: func(ctx context.Context) error { return nil }}
+}
+
+func failedCheck() Check {
+	return Check{Name: "failed", Hint: "fix it", Run: func(ctx context.Context) error { return errors.New("broken") }}
+}
+
+func TestRun(t *testing.T) {
+	report := Run(context.Background(), time.Second, okCheck(), failedCheck())
+
+	if report.Status != StatusFailed {
+		t.Errorf("Got status: %s / Expected: %s", report.Status, StatusFailed)
+	}
+
+	if len(report.Checks) != 2 {
+		t.Fatalf("Got %d results / Expected: 2", len(report.Checks))
+	}
+
+	if report.Checks[0].Status != StatusOK {
+		t.Errorf("Got status: %s / Expected: %s", report.Checks[0].Status, StatusOK)
+	}
+
+	if report.Checks[1].Error != "broken" || report.Checks[1].Hint != "fix it" {
+		t.Errorf("Got error: %s, hint: %s / Expected error: broken, hint: fix it", report.Checks[1].Error, report.Checks[1].Hint)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var testStatus = []struct {
+		checks []Check
+		status int
+	}{
+		{[]Check{}, http.StatusOK},
+		{[]Check{okCheck()}, http.StatusOK},
+		{[]Check{okCheck(), failedCheck()}, http.StatusServiceUnavailable},
+	}
+
+	for _, ts := range testStatus {
+		rec := httptest.NewRecorder()
+		Handler(ts.checks...)(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		if rec.Code != ts.status {
+			t.Errorf("Got status code: %d / Expected: %d", rec.Code, ts.status)
+		}
+	}
+}
@@ -4,19 +4,34 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"golang.org/x/sync/errgroup"
 
 	redisClient "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/storage"
 )
 
 // Config holds the configuration
 type Config struct {
 	ImportDir        string
 	UserDatabaseName string
+	// DryRun only reports what would be imported or pruned without
+	// modifying Redis.
+	DryRun bool
+	// Prune removes pictures and boards from Redis that no longer exist
+	// on disk for the users found in ImportDir.
+	Prune bool
+	// Progress writes a continuously updated status line to stderr.
+	Progress bool
+	// BatchSize is the number of commands sent to Redis in one pipeline.
+	BatchSize int
 }
 
 // Board holds the board informaton
@@ -32,10 +47,13 @@ type User struct {
 }
 
 // StartImport imports all users and boards that exists in the specified
-// directory.
-func StartImport(ctx context.Context, config *Config) error {
+// directory. It returns a summary of what was imported (or would have been
+// imported in case of a dry-run).
+func StartImport(ctx context.Context, config *Config) (*Summary, error) {
 	g, ctx := errgroup.WithContext(ctx)
 
+	summary := &Summary{DryRun: config.DryRun, Prune: config.Prune}
+
 	log.Trace().
 		Str("method", "EnqueueBoard").
 		Msg("Getting Redis connection")
@@ -43,11 +61,19 @@ func StartImport(ctx context.Context, config *Config) error {
 	redisClient.InitPool(viper.GetString("redis-host"), viper.GetInt("redis-port"))
 	conn, err := redisClient.GetConnection()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer conn.Close()
 
+	if config.Progress {
+		p := newProgress(summary, os.Stderr, 500*time.Millisecond)
+		defer p.stop()
+	}
+
 	users := make(chan User)
+	// onDisk contains the users found in the import directory. It's only
+	// read after all workers are done.
+	onDisk := map[string]bool{}
 
 	g.Go(func() error {
 		defer close(users)
@@ -57,6 +83,8 @@ func StartImport(ctx context.Context, config *Config) error {
 		}
 
 		for _, user := range allUsers {
+			onDisk[user.Username] = true
+			atomic.AddInt64(&summary.Users, 1)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -83,6 +111,7 @@ func StartImport(ctx context.Context, config *Config) error {
 				if err := getBoards(config.ImportDir, &u); err != nil {
 					return err
 				}
+				atomic.AddInt64(&summary.Boards, int64(len(u.Boards)))
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
@@ -126,7 +155,12 @@ func StartImport(ctx context.Context, config *Config) error {
 		g.Go(func() error {
 			for daUser := range files {
 				for bname, bfiles := range daUser.Boards {
-					if err := saveBoard(daUser.Username, bname, bfiles); err != nil {
+					if err := saveBoard(config, summary, daUser.Username, bname, bfiles); err != nil {
+						return err
+					}
+				}
+				if config.Prune {
+					if err := pruneBoards(config, summary, &daUser); err != nil {
 						return err
 					}
 				}
@@ -135,13 +169,27 @@ func StartImport(ctx context.Context, config *Config) error {
 		})
 	}
 
-	return g.Wait()
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if config.Prune {
+		if err := pruneUsers(config, summary, onDisk); err != nil {
+			return nil, err
+		}
+	}
+
+	return summary, nil
 }
 
-func saveBoard(username string, boardname string, pictures []string) error {
+// saveBoard stores all pictures of a board in Redis. The pictures are written
+// in pipelined batches. In dry-run mode Redis is only queried to find out how
+// many pictures are new. If pruning is enabled pictures stored in Redis that
+// are no longer on disk are removed from the board.
+func saveBoard(config *Config, summary *Summary, username string, boardname string, pictures []string) error {
 	log.Info().
 		Str("method", "saveBoard").
-		Msgf("Importing: %s:%s\n", username, boardname)
+		Msgf("Importing: %s:%s", username, boardname)
 
 	conn, err := redisClient.GetConnection()
 	if err != nil {
@@ -149,15 +197,180 @@ func saveBoard(username string, boardname string, pictures []string) error {
 	}
 	defer conn.Close()
 
-	for _, pic := range pictures {
-		if err := redisClient.AddPicture(conn, fmt.Sprintf("%s:%s", username, boardname), pic); err != nil {
+	key := fmt.Sprintf("%s:%s", username, boardname)
+
+	var added int
+	if config.DryRun {
+		existing, err := redisClient.CountExistingPictures(conn, key, pictures, config.BatchSize)
+		if err != nil {
+			return err
+		}
+		added = len(pictures) - existing
+	} else {
+		added, err = redisClient.AddPictures(conn, key, pictures, config.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		if err := redisClient.IndexBoard(conn, username, boardname); err != nil {
+			return err
+		}
+	}
+
+	atomic.AddInt64(&summary.Files, int64(len(pictures)))
+	atomic.AddInt64(&summary.New, int64(added))
+	atomic.AddInt64(&summary.Present, int64(len(pictures)-added))
+
+	if !config.Prune {
+		return nil
+	}
+
+	stored, err := redisClient.Pictures(conn, key)
+	if err != nil {
+		return err
+	}
+
+	stale := missingPictures(stored, pictures)
+	if len(stale) == 0 {
+		return nil
+	}
+
+	log.Info().
+		Str("method", "saveBoard").
+		Msgf("Pruning %d pictures of %s no longer on disk", len(stale), key)
+
+	if !config.DryRun {
+		if _, err := redisClient.RemovePictures(conn, key, stale, config.BatchSize); err != nil {
 			return err
 		}
 	}
+	atomic.AddInt64(&summary.PrunedFiles, int64(len(stale)))
 
 	return nil
 }
 
+// pruneUsers prunes the boards of all indexed users that no longer have a
+// directory on disk. The workers only prune the users found on disk.
+func pruneUsers(config *Config, summary *Summary, onDisk map[string]bool) error {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Pruning removes users from the index so they are collected first.
+	users := []string{}
+	cursor := "0"
+	for {
+		batch, next, err := redisClient.ScanUsers(conn, cursor, 1000)
+		if err != nil {
+			return err
+		}
+		users = append(users, batch...)
+		if next == "0" {
+			break
+		}
+		cursor = next
+	}
+
+	for _, user := range users {
+		if onDisk[user] || user == redisClient.ReservedUser {
+			continue
+		}
+
+		log.Info().
+			Str("method", "pruneUsers").
+			Msgf("Pruning user %s no longer on disk", user)
+
+		if err := pruneBoards(config, summary, &User{Username: user, Boards: map[string][]string{}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneBoards removes all boards of a user from Redis that no longer have a
+// directory on disk. Boards with sections are kept as long as the directory
+// of the top level board exists. Boards are found by their picture sets
+// and in the index as a board may only be in one of them.
+func pruneBoards(config *Config, summary *Summary, u *User) error {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	keys, err := redisClient.ScanKeys(conn, escapePattern(u.Username)+":*", "set")
+	if err != nil {
+		return err
+	}
+
+	paths, err := redisClient.AllBoards(conn, u.Username)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		// Internal keys are never boards.
+		if strings.HasPrefix(key, redisClient.ReservedUser+":") {
+			continue
+		}
+		paths = append(paths, strings.TrimPrefix(key, u.Username+":"))
+	}
+	sort.Strings(paths)
+
+	for i, path := range paths {
+		if i > 0 && paths[i-1] == path {
+			continue
+		}
+
+		boardname := strings.SplitN(path, "/", 2)[0]
+		if _, ok := u.Boards[boardname]; ok {
+			continue
+		}
+
+		log.Info().
+			Str("method", "pruneBoards").
+			Msgf("Pruning board %s:%s no longer on disk", u.Username, path)
+
+		if !config.DryRun {
+			if err := redisClient.DeleteKey(conn, u.Username+":"+path); err != nil {
+				return err
+			}
+			if err := redisClient.UnindexBoard(conn, u.Username, path); err != nil {
+				return err
+			}
+		}
+		atomic.AddInt64(&summary.PrunedBoards, 1)
+	}
+
+	return nil
+}
+
+// missingPictures returns all pictures of stored that are not in onDisk.
+func missingPictures(stored []string, onDisk []string) []string {
+	present := make(map[string]struct{}, len(onDisk))
+	for _, pic := range onDisk {
+		present[pic] = struct{}{}
+	}
+
+	var missing []string
+	for _, pic := range stored {
+		if _, ok := present[pic]; !ok {
+			missing = append(missing, pic)
+		}
+	}
+
+	return missing
+}
+
+// escapePattern escapes all characters that have a special meaning in
+// Redis glob-style patterns.
+func escapePattern(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+	return replacer.Replace(s)
+}
+
 func getFiles(dir string, u *User) error {
 	for boardname := range u.Boards {
 		tmpFiles, err := ioutil.ReadDir(fmt.Sprintf("%s/%s/%s", dir, u.Username, boardname))
@@ -168,6 +381,9 @@ func getFiles(dir string, u *User) error {
 		var files []string
 
 		for _, file := range tmpFiles {
+			if storage.IsMetaFile(file.Name()) {
+				continue
+			}
 			files = append(files, file.Name())
 		}
 
@@ -203,10 +419,17 @@ func getAllUser(dir string) ([]User, error) {
 	}
 
 	for _, file := range files {
-		if file.IsDir() {
-			u := User{Username: file.Name()}
-			users = append(users, u)
+		if !file.IsDir() {
+			continue
+		}
+		// Its boards would overwrite internal keys.
+		if file.Name() == redisClient.ReservedUser {
+			log.Warn().
+				Str("method", "getAllUser").
+				Msgf("Skipping directory of reserved user %s", file.Name())
+			continue
 		}
+		users = append(users, User{Username: file.Name()})
 	}
 
 	return users, nil
@@ -0,0 +1,71 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testMissing struct {
+	stored  []string
+	onDisk  []string
+	missing []string
+}
+
+type testPattern struct {
+	input  string
+	result string
+}
+
+func TestMissingPictures(t *testing.T) {
+	var testMissingPictures = []testMissing{
+		{[]string{"a.jpg", "b.jpg"}, []string{"a.jpg", "b.jpg"}, []string{}},
+		{[]string{"a.jpg", "b.jpg"}, []string{"a.jpg"}, []string{"b.jpg"}},
+		{[]string{"a.jpg", "b.jpg"}, []string{}, []string{"a.jpg", "b.jpg"}},
+		{[]string{}, []string{"a.jpg"}, []string{}},
+	}
+
+	for _, tm := range testMissingPictures {
+		missing := missingPictures(tm.stored, tm.onDisk)
+		if len(missing) != len(tm.missing) {
+			t.Errorf("Got %d missing pictures / Expected: %d", len(missing), len(tm.missing))
+			continue
+		}
+		for x := 0; x < len(tm.missing); x++ {
+			if missing[x] != tm.missing[x] {
+				t.Errorf("Got missing picture: %s / Expected: %s", missing[x], tm.missing[x])
+			}
+		}
+	}
+}
+
+func TestEscapePattern(t *testing.T) {
+	var testEscape = []testPattern{
+		{"user1", "user1"},
+		{"user*", `user\*`},
+		{"us?er", `us\?er`},
+		{"[user]", `\[user\]`},
+		{`us\er`, `us\\er`},
+	}
+
+	for _, tp := range testEscape {
+		escaped := escapePattern(tp.input)
+		if escaped != tp.result {
+			t.Errorf("Got pattern: %s / Expected: %s", escaped, tp.result)
+		}
+	}
+}
+
+func TestGetAllUser(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"user1", "pinbackup"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	users, err := getAllUser(dir)
+	if err != nil || len(users) != 1 || users[0].Username != "user1" {
+		t.Errorf("Got users: %v, error: %v / Expected: [user1] without reserved user", users, err)
+	}
+}
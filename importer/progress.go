@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Summary holds the counters of an import run.
+type Summary struct {
+	Users        int64
+	Boards       int64
+	Files        int64
+	New          int64
+	Present      int64
+	PrunedFiles  int64
+	PrunedBoards int64
+	DryRun       bool
+	Prune        bool
+}
+
+// String returns a human readable representation of the summary.
+func (s *Summary) String() string {
+	prefix := "Imported"
+	if s.DryRun {
+		prefix = "Would import"
+	}
+
+	out := fmt.Sprintf("%s %d users, %d boards, %d files (%d new, %d already present)",
+		prefix, s.Users, s.Boards, s.Files, s.New, s.Present)
+
+	if s.Prune {
+		verb := "Pruned"
+		if s.DryRun {
+			verb = "Would prune"
+		}
+		out += fmt.Sprintf("\n%s %d files and %d boards no longer on disk", verb, s.PrunedFiles, s.PrunedBoards)
+	}
+
+	return out
+}
+
+// progress periodically writes the current counters of a Summary to w until
+// stop is called. All counters of the Summary must be updated atomically
+// while progress is running.
+type progress struct {
+	summary *Summary
+	w       io.Writer
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// newProgress starts reporting the counters of summary to w every interval.
+func newProgress(summary *Summary, w io.Writer, interval time.Duration) *progress {
+	p := &progress{
+		summary: summary,
+		w:       w,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(p.stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.print()
+			case <-p.done:
+				p.print()
+				fmt.Fprintln(p.w)
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// print writes a single status line. The line is overwritten on the next call.
+func (p *progress) print() {
+	fmt.Fprintf(p.w, "\rusers: %d  boards: %d  files: %d  new: %d  present: %d",
+		atomic.LoadInt64(&p.summary.Users),
+		atomic.LoadInt64(&p.summary.Boards),
+		atomic.LoadInt64(&p.summary.Files),
+		atomic.LoadInt64(&p.summary.New),
+		atomic.LoadInt64(&p.summary.Present))
+}
+
+// stop prints the final status line and waits until reporting has finished.
+func (p *progress) stop() {
+	close(p.done)
+	<-p.stopped
+}
@@ -0,0 +1,119 @@
+package job
+
+import (
+	"mime"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	// artifactsKeyPrefix + UUID is a hash of the artifacts captured for
+	// troubleshooting a job. Fields are the artifact names, values their
+	// content.
+	artifactsKeyPrefix = "pinbackup:artifacts:"
+
+	// MaxArtifactSize is the maximum size of a single artifact in bytes.
+	// Artifacts are stored in Redis and must not eat up its memory.
+	MaxArtifactSize = 16 << 20
+)
+
+var (
+	// ErrArtifactNotFound is returned if a job has no artifact with the
+	// given name.
+	ErrArtifactNotFound = errors.New("Artifact not found")
+
+	// artifactNameRegex restricts artifact names as they are used as file
+	// names when downloaded.
+	artifactNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,127}$`)
+)
+
+// Artifact describes a file captured while processing a job e.g. a
+// screenshot of the page the scraper failed on.
+type Artifact struct {
+	Name        string `json:"name"`
+	Size        int    `json:"size"`
+	ContentType string `json:"contenttype"`
+}
+
+// artifactsKey returns the Redis key of the artifacts of a job.
+func artifactsKey(uuid string) string {
+	return artifactsKeyPrefix + uuid
+}
+
+// ValidArtifactName returns true if name may be used for an artifact.
+func ValidArtifactName(name string) bool {
+	return artifactNameRegex.MatchString(name)
+}
+
+// ArtifactContentType returns the content type of an artifact by the
+// extension of its name.
+func ArtifactContentType(name string) string {
+	switch ext := path.Ext(name); ext {
+	case ".har":
+		return "application/json"
+	case ".log":
+		return "text/plain; charset=utf-8"
+	default:
+		if contentType := mime.TypeByExtension(ext); contentType != "" {
+			return contentType
+		}
+	}
+
+	return "application/octet-stream"
+}
+
+// SaveArtifact stores an artifact of a job. An artifact with the same name
+// is replaced. All artifacts of the job expire ttl after the latest one was
+// saved.
+func SaveArtifact(conn redis.Conn, uuid string, name string, data []byte, ttl time.Duration) error {
+	if !ValidArtifactName(name) {
+		return errors.Errorf("Invalid artifact name %s", name)
+	}
+	if len(data) > MaxArtifactSize {
+		return errors.Errorf("Artifact %s has %d bytes. At most %d bytes are allowed", name, len(data), MaxArtifactSize)
+	}
+
+	conn.Send("MULTI")
+	conn.Send("HSET", artifactsKey(uuid), name, data)
+	if ttl > 0 {
+		conn.Send("PEXPIRE", artifactsKey(uuid), ttl.Milliseconds())
+	}
+	_, err := conn.Do("EXEC")
+
+	return err
+}
+
+// ListArtifacts returns the artifacts of a job sorted by name.
+func ListArtifacts(conn redis.Conn, uuid string) ([]Artifact, error) {
+	names, err := redis.Strings(conn.Do("HKEYS", artifactsKey(uuid)))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	artifacts := []Artifact{}
+	for _, name := range names {
+		size, err := redis.Int(conn.Do("HSTRLEN", artifactsKey(uuid), name))
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, Artifact{Name: name, Size: size, ContentType: ArtifactContentType(name)})
+	}
+
+	return artifacts, nil
+}
+
+// GetArtifact returns the content of an artifact or ErrArtifactNotFound.
+func GetArtifact(conn redis.Conn, uuid string, name string) ([]byte, error) {
+	data, err := redis.Bytes(conn.Do("HGET", artifactsKey(uuid), name))
+	if err == redis.ErrNil {
+		return nil, ErrArtifactNotFound
+	}
+
+	return data, err
+}
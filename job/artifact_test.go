@@ -0,0 +1,36 @@
+package job
+
+import (
+	"testing"
+)
+
+func TestArtifactName(t *testing.T) {
+	var tests = []struct {
+		name        string
+		valid       bool
+		contentType string
+	}{
+		{"failure-screenshot.jpg", true, "image/jpeg"},
+		{"step-01-login-screenshot.png", true, "image/png"},
+		{"failure-dom.html", true, "text/html; charset=utf-8"},
+		{"console.log", true, "text/plain; charset=utf-8"},
+		{"network.har", true, "application/json"},
+		{"unknown", true, "application/octet-stream"},
+		{"../secret", false, ""},
+		{".hidden", false, ""},
+		{"Upper.txt", false, ""},
+		{"", false, ""},
+	}
+
+	for _, test := range tests {
+		if valid := ValidArtifactName(test.name); valid != test.valid {
+			t.Errorf("%s: Got valid: %t / Expected: %t", test.name, valid, test.valid)
+		}
+		if !test.valid {
+			continue
+		}
+		if contentType := ArtifactContentType(test.name); contentType != test.contentType {
+			t.Errorf("%s: Got: %s / Expected: %s", test.name, contentType, test.contentType)
+		}
+	}
+}
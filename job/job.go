@@ -0,0 +1,467 @@
+package job
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+const (
+	// StatusQueued is the status of a job published to the boards queue.
+	StatusQueued = "queued"
+	// StatusScraping is the status while the scraper collects the pins.
+	StatusScraping = "scraping"
+	// StatusDownloading is the status after the scraper finished while the
+	// downloader still fetches pictures.
+	StatusDownloading = "downloading"
+	// StatusFinished is the status after all pins were downloaded.
+	StatusFinished = "finished"
+	// StatusFailed is the status of a job that couldn't be finished.
+	StatusFailed = "failed"
+
+	// jobsKey is a sorted set containing all job UUIDs scored by the time
+	// they were created.
+	jobsKey = "pinbackup:jobs"
+	// activeKeyPrefix + user + ":" + board contains the UUID of the latest
+	// job of a board that wasn't done yet.
+	activeKeyPrefix = "pinbackup:active:"
+	// tokenJobsKeyPrefix + token ID is a set of the UUIDs of the jobs
+	// created with an API token that may still be active.
+	tokenJobsKeyPrefix = "pinbackup:tokenjobs:"
+	// boardJobsKeyPrefix + user + ":" + board is a sorted set containing
+	// the UUIDs of the jobs of a board scored by the time they were
+	// created.
+	boardJobsKeyPrefix = "pinbackup:boardjobs:"
+
+	// staleAfter is how long a queued or downloading job may go without
+	// update until it's considered lost e.g. because no scraper was
+	// subscribed when it was published. Scraping jobs are active as long as
+	// the scraper holds the board lock.
+	staleAfter = time.Hour
+
+	// Retention is how long finished and failed jobs are kept.
+	Retention = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrNotFound is returned if a job doesn't exist.
+	ErrNotFound = errors.New("Job not found")
+	// ErrJobLimit is returned if a job isn't created because its API token
+	// already has the maximum number of active jobs.
+	ErrJobLimit = errors.New("Too many active jobs")
+)
+
+// Job contains the state of a scrape request. Jobs are stored as Redis hash.
+// Source is the kind of page the job backs up e.g. "saved" and empty for
+// boards. Parent is the UUID of the job of the page a board was found on.
+// Account is the name of the Pinterest account the board is scraped with.
+type Job struct {
+	UUID       string `json:"uuid" redis:"uuid"`
+	URL        string `json:"url" redis:"url"`
+	Host       string `json:"host" redis:"host"`
+	User       string `json:"user" redis:"user"`
+	Path       string `json:"path" redis:"path"`
+	Token      string `json:"token,omitempty" redis:"token"`
+	Source     string `json:"source,omitempty" redis:"source"`
+	Parent     string `json:"parent,omitempty" redis:"parent"`
+	Account    string `json:"account,omitempty" redis:"account"`
+	Status     string `json:"status" redis:"status"`
+	Error      string `json:"error,omitempty" redis:"error"`
+	PinsFound  int    `json:"pinsfound" redis:"pins_found"`
+	Downloaded int    `json:"downloaded" redis:"downloaded"`
+	Skipped    int    `json:"skipped" redis:"skipped"`
+	Failed     int    `json:"failed" redis:"failed"`
+	Processed  int    `json:"processed" redis:"processed"`
+	Created    int64  `json:"created" redis:"created"`
+	Updated    int64  `json:"updated" redis:"updated"`
+	Finished   int64  `json:"finished,omitempty" redis:"finished"`
+}
+
+// Done returns true if the job is finished or failed.
+func (j *Job) Done() bool {
+	return j.Status == StatusFinished || j.Status == StatusFailed
+}
+
+// finishScript sets a job to finished if the scraper is done and all pins
+// found were processed by the downloader. As the scraper and the downloader
+// run concurrently both call it and the check must be atomic. The job is
+// removed from the active job of its board (KEYS[2]) at the same time.
+var finishScript = redis.NewScript(2, `
+if redis.call("HGET", KEYS[1], "status") ~= "downloading" then
+	return 0
+end
+local pins = tonumber(redis.call("HGET", KEYS[1], "pins_found") or "0")
+local processed = tonumber(redis.call("HGET", KEYS[1], "processed") or "0")
+if processed < pins then
+	return 0
+end
+redis.call("HSET", KEYS[1], "status", "finished", "finished", ARGV[1], "updated", ARGV[1])
+if redis.call("GET", KEYS[2]) == ARGV[2] then
+	redis.call("DEL", KEYS[2])
+end
+return 1
+`)
+
+// createActiveScript creates a job unless the board already has an active
+// one. Returns the UUID of the active job which is the UUID of the new job
+// if it was created. If the API token of the job already has max active
+// jobs no job is created and an empty UUID is returned. Counting and
+// creating must be atomic or concurrent requests exceed the limit. Jobs
+// of the token that are no longer active are forgotten while counting.
+//
+// KEYS: active key, board lock key, jobs key, job key, board jobs key,
+// token jobs key
+// ARGV: UUID, created, stale before, job key prefix, lock key prefix,
+// max active jobs of the token (0 disables the limit), job fields...
+var createActiveScript = redis.NewScript(6, `
+local staleBefore = tonumber(ARGV[3])
+local active = redis.call("GET", KEYS[1])
+if active then
+	local j = redis.call("HMGET", ARGV[4] .. active, "status", "updated")
+	local status, updated = j[1], tonumber(j[2] or "0")
+	if status == "scraping" and redis.call("EXISTS", KEYS[2]) == 1 then
+		return active
+	end
+	if (status == "queued" or status == "downloading") and updated >= staleBefore then
+		return active
+	end
+end
+local max = tonumber(ARGV[6])
+if max > 0 then
+	local count = 0
+	for _, uuid in ipairs(redis.call("SMEMBERS", KEYS[6])) do
+		local j = redis.call("HMGET", ARGV[4] .. uuid, "status", "updated", "user", "path")
+		local status, updated = j[1], tonumber(j[2] or "0")
+		if (status == "scraping" and redis.call("EXISTS", ARGV[5] .. j[3] .. ":" .. j[4]) == 1) or
+			((status == "queued" or status == "downloading") and updated >= staleBefore) then
+			count = count + 1
+		else
+			redis.call("SREM", KEYS[6], uuid)
+		end
+	end
+	if count >= max then
+		return ""
+	end
+end
+redis.call("HSET", KEYS[4], unpack(ARGV, 7))
+redis.call("ZADD", KEYS[3], ARGV[2], ARGV[1])
+redis.call("ZADD", KEYS[5], ARGV[2], ARGV[1])
+redis.call("SET", KEYS[1], ARGV[1])
+if KEYS[6] ~= "" then
+	redis.call("SADD", KEYS[6], ARGV[1])
+end
+return ARGV[1]
+`)
+
+// releaseActiveScript removes the active job of a board if it's still the
+// given job.
+var releaseActiveScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// key returns the Redis key of a job.
+func key(uuid string) string {
+	return "pinbackup:job:" + uuid
+}
+
+// now returns the current Unix time.
+func now() int64 {
+	return time.Now().Unix()
+}
+
+// boardJobsKey returns the Redis key of the jobs of a board.
+func boardJobsKey(user string, path string) string {
+	return boardJobsKeyPrefix + user + ":" + path
+}
+
+// Create stores a new job with status queued.
+func Create(conn redis.Conn, j *Job) error {
+	if j.UUID == "" {
+		return errors.New("Job needs a UUID")
+	}
+
+	j.Status = StatusQueued
+	j.Created = now()
+	j.Updated = j.Created
+
+	conn.Send("MULTI")
+	conn.Send("HSET", redis.Args{}.Add(key(j.UUID)).AddFlat(j)...)
+	conn.Send("ZADD", jobsKey, j.Created, j.UUID)
+	conn.Send("ZADD", boardJobsKey(j.User, j.Path), j.Created, j.UUID)
+	_, err := conn.Do("EXEC")
+
+	return err
+}
+
+// activeKey returns the Redis key of the active job of a board.
+func activeKey(user string, path string) string {
+	return activeKeyPrefix + user + ":" + path
+}
+
+// CreateOrGetActive stores a new job with status queued unless the board
+// already has an active job. Returns the UUID of the active job which is
+// j.UUID if the job was created. The API token of the job may have at most
+// maxActiveJobs active jobs, otherwise ErrJobLimit is returned. 0 disables
+// the limit.
+func CreateOrGetActive(conn redis.Conn, j *Job, maxActiveJobs int) (string, error) {
+	if j.UUID == "" {
+		return "", errors.New("Job needs a UUID")
+	}
+
+	j.Status = StatusQueued
+	j.Created = now()
+	j.Updated = j.Created
+
+	tokenJobsKey := ""
+	if j.Token != "" {
+		tokenJobsKey = tokenJobsKeyPrefix + j.Token
+	} else {
+		maxActiveJobs = 0
+	}
+
+	args := redis.Args{}.
+		Add(activeKey(j.User, j.Path), redisClient.BoardLockKey(j.User, j.Path), jobsKey, key(j.UUID), boardJobsKey(j.User, j.Path), tokenJobsKey).
+		Add(j.UUID, j.Created, j.Created-int64(staleAfter.Seconds()), key(""), redisClient.BoardLockKeyPrefix, maxActiveJobs).
+		AddFlat(j)
+
+	active, err := redis.String(createActiveScript.Do(conn, args...))
+	if err != nil {
+		return "", err
+	}
+	if active == "" {
+		return "", ErrJobLimit
+	}
+
+	return active, nil
+}
+
+// isActive returns true if a job is neither done nor stale. It matches the
+// checks of createActiveScript.
+func isActive(conn redis.Conn, j *Job) (bool, error) {
+	switch j.Status {
+	case StatusScraping:
+		return redis.Bool(conn.Do("EXISTS", redisClient.BoardLockKey(j.User, j.Path)))
+	case StatusQueued, StatusDownloading:
+		return j.Updated >= now()-int64(staleAfter.Seconds()), nil
+	}
+
+	return false, nil
+}
+
+// GetActive returns the active job of a board or nil if the board has
+// none.
+func GetActive(conn redis.Conn, user string, path string) (*Job, error) {
+	uuid, err := redis.String(conn.Do("GET", activeKey(user, path)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := Get(conn, uuid)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := isActive(conn, j)
+	if err != nil || !active {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// releaseActive removes the job from the active job of its board.
+func releaseActive(conn redis.Conn, uuid string) error {
+	values, err := redis.Strings(conn.Do("HMGET", key(uuid), "user", "path"))
+	if err != nil {
+		return err
+	}
+
+	_, err = releaseActiveScript.Do(conn, activeKey(values[0], values[1]), uuid)
+
+	return err
+}
+
+// retire lets a finished or failed job expire after Retention. Jobs
+// created before the same horizon are removed from the job indexes. The
+// token of the job doesn't need to count it as active anymore.
+func retire(conn redis.Conn, uuid string) error {
+	values, err := redis.Strings(conn.Do("HMGET", key(uuid), "user", "path", "token"))
+	if err != nil {
+		return err
+	}
+
+	retention := int64(Retention.Seconds())
+	horizon := now() - retention
+
+	conn.Send("MULTI")
+	conn.Send("EXPIRE", key(uuid), retention)
+	conn.Send("ZREMRANGEBYSCORE", jobsKey, "-inf", horizon)
+	conn.Send("ZREMRANGEBYSCORE", boardJobsKey(values[0], values[1]), "-inf", horizon)
+	conn.Send("EXPIRE", boardJobsKey(values[0], values[1]), retention)
+	if values[2] != "" {
+		conn.Send("SREM", tokenJobsKeyPrefix+values[2], uuid)
+	}
+	_, err = conn.Do("EXEC")
+
+	return err
+}
+
+// Get returns the job with the given UUID or ErrNotFound.
+func Get(conn redis.Conn, uuid string) (*Job, error) {
+	values, err := redis.Values(conn.Do("HGETALL", key(uuid)))
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+
+	j := &Job{}
+	if err := redis.ScanStruct(values, j); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Latest returns the latest job of a board or ErrNotFound.
+func Latest(conn redis.Conn, user string, path string) (*Job, error) {
+	uuids, err := redis.Strings(conn.Do("ZREVRANGE", boardJobsKey(user, path), 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	if len(uuids) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return Get(conn, uuids[0])
+}
+
+// List returns the latest jobs, newest first. At most limit jobs are
+// returned.
+func List(conn redis.Conn, limit int) ([]*Job, error) {
+	uuids, err := redis.Strings(conn.Do("ZREVRANGE", jobsKey, 0, limit-1))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []*Job{}
+	for _, uuid := range uuids {
+		j, err := Get(conn, uuid)
+		if err == ErrNotFound {
+			// Job expired after Retention but its entry wasn't trimmed
+			// yet or the job was deleted with its board.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+// SetStatus updates the status of a job. errMsg is stored for failed jobs.
+func SetStatus(conn redis.Conn, uuid string, status string, errMsg string) error {
+	args := redis.Args{}.Add(key(uuid), "status", status, "updated", now())
+	if errMsg != "" {
+		args = args.Add("error", errMsg)
+	}
+	if status == StatusFinished || status == StatusFailed {
+		args = args.Add("finished", now())
+	}
+
+	if _, err := conn.Do("HSET", args...); err != nil {
+		return err
+	}
+
+	if status == StatusFinished || status == StatusFailed {
+		if err := releaseActive(conn, uuid); err != nil {
+			return err
+		}
+		return retire(conn, uuid)
+	}
+
+	return nil
+}
+
+// IncrPinsFound increments the number of pins found by the scraper.
+func IncrPinsFound(conn redis.Conn, uuid string) error {
+	_, err := conn.Do("HINCRBY", key(uuid), "pins_found", 1)
+	return err
+}
+
+// IncrProcessed increments the counter of a processed pin. field is one of
+// "downloaded", "skipped" or "failed".
+func IncrProcessed(conn redis.Conn, uuid string, field string) error {
+	switch field {
+	case "downloaded", "skipped", "failed":
+	default:
+		return errors.Errorf("Unknown counter %s", field)
+	}
+
+	conn.Send("MULTI")
+	conn.Send("HINCRBY", key(uuid), field, 1)
+	conn.Send("HINCRBY", key(uuid), "processed", 1)
+	conn.Send("HSET", key(uuid), "updated", now())
+	_, err := conn.Do("EXEC")
+
+	return err
+}
+
+// FinishIfDone sets the job to finished if the scraper is done and all pins
+// were processed. Returns true if the job was finished by this call.
+func FinishIfDone(conn redis.Conn, uuid string) (bool, error) {
+	values, err := redis.Strings(conn.Do("HMGET", key(uuid), "user", "path"))
+	if err != nil {
+		return false, err
+	}
+
+	finished, err := redis.Int(finishScript.Do(conn, key(uuid), activeKey(values[0], values[1]), strconv.FormatInt(now(), 10), uuid))
+	if err != nil {
+		return false, err
+	}
+
+	if finished == 0 {
+		return false, nil
+	}
+
+	return true, retire(conn, uuid)
+}
+
+// DeleteBoard removes all jobs of a board created before the Unix time
+// before. Returns the number of jobs removed.
+func DeleteBoard(conn redis.Conn, user string, path string, before int64) (int, error) {
+	uuids, err := redis.Strings(conn.Do("ZRANGEBYSCORE", boardJobsKey(user, path), "-inf", before))
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, uuid := range uuids {
+		conn.Send("MULTI")
+		conn.Send("DEL", key(uuid), artifactsKey(uuid))
+		conn.Send("ZREM", jobsKey, uuid)
+		conn.Send("ZREM", boardJobsKey(user, path), uuid)
+		if _, err := conn.Do("EXEC"); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+const namespace = "pinbackup"
+
+var (
+	// BoardsEnqueued counts boards accepted by the server and published to
+	// the boards queue.
+	BoardsEnqueued = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "boards_enqueued_total",
+		Help:      "Number of boards published to the boards queue.",
+	})
+
+	// ScrapeDuration observes how long scraping a board took by outcome
+	// ("success" or "failure").
+	ScrapeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scrape_duration_seconds",
+		Help:      "Time needed to scrape a board.",
+		Buckets:   []float64{5, 15, 30, 60, 120, 300, 600, 1200, 2400, 3600},
+	}, []string{"outcome"})
+
+	// PinsFound observes the number of pins found per scraped board.
+	PinsFound = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pins_found_per_board",
+		Help:      "Number of pins found per scraped board.",
+		Buckets:   prometheus.ExponentialBuckets(10, 2, 12),
+	})
+
+	// LoginAttempts counts logins to Pinterest tried by the scraper.
+	LoginAttempts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_attempts_total",
+		Help:      "Number of Pinterest login attempts.",
+	})
+
+	// LoginFailures counts failed logins to Pinterest.
+	LoginFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_failures_total",
+		Help:      "Number of failed Pinterest login attempts.",
+	})
+
+	// Downloads counts downloaded pictures by outcome ("success", "skipped"
+	// or "failure").
+	Downloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloads_total",
+		Help:      "Number of picture downloads by outcome.",
+	}, []string{"outcome"})
+
+	// DownloadedBytes counts the bytes written to storage by the downloader.
+	DownloadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Number of bytes downloaded.",
+	})
+
+	// DownloadDuration observes how long fetching and storing a picture took.
+	DownloadDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_duration_seconds",
+		Help:      "Time needed to download a picture.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// QueueDepth is the number of messages received from a queue that are
+	// waiting for a free worker.
+	QueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Number of received messages waiting for a free worker.",
+	}, []string{"queue"})
+
+	// InFlight is the number of workers currently processing a message.
+	InFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "in_flight_workers",
+		Help:      "Number of workers currently processing a message.",
+	}, []string{"component"})
+
+	// RequestsBlocked counts requests the scraping browser didn't load by
+	// resource type e.g. "image".
+	RequestsBlocked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_blocked_total",
+		Help:      "Number of browser requests blocked while scraping by resource type.",
+	}, []string{"resource_type"})
+
+	// BrowsersHealthy is the number of Chrome browsers the scraper is
+	// connected to.
+	BrowsersHealthy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "browsers_healthy",
+		Help:      "Number of connected Chrome browsers.",
+	})
+
+	// BrowserTabs is the number of browser tabs currently used for scraping.
+	BrowserTabs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "browser_tabs",
+		Help:      "Number of browser tabs used for scraping.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		BoardsEnqueued,
+		ScrapeDuration,
+		PinsFound,
+		LoginAttempts,
+		LoginFailures,
+		Downloads,
+		DownloadedBytes,
+		DownloadDuration,
+		QueueDepth,
+		InFlight,
+		BrowsersHealthy,
+		BrowserTabs,
+		RequestsBlocked,
+	)
+}
+
+// Handler returns the HTTP handler exposing all metrics in Prometheus
+// text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve starts a HTTP listener on address exposing the metrics at /metrics
+// and all additional handlers at their pattern. The listener runs in the
+// background. Nothing is started if address is empty.
+func Serve(address string, handlers map[string]http.Handler) {
+	if address == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	for pattern, handler := range handlers {
+		mux.Handle(pattern, handler)
+	}
+
+	srv := &http.Server{
+		Addr:         address,
+		WriteTimeout: time.Second * 15,
+		ReadTimeout:  time.Second * 15,
+		IdleTimeout:  time.Second * 60,
+		Handler:      mux,
+	}
+
+	go func() {
+		log.Debug().
+			Str("method", "Serve").
+			Msgf("Starting metrics listener: %s", address)
+
+		if err := srv.ListenAndServe(); err != nil {
+			log.Error().
+				Str("method", "Serve").
+				Msgf("Metrics listener stopped: %s", err.Error())
+		}
+	}()
+}
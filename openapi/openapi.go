@@ -0,0 +1,216 @@
+package openapi
+
+import (
+	"bytes"
+	_ "embed" // needed for go:embed
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// spec is the OpenAPI 3 specification of the REST API.
+//
+//go:embed openapi.json
+var spec []byte
+
+// document contains the parts of the specification needed to validate
+// requests.
+type document struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Parameters map[string]*parameter `json:"parameters"`
+		Schemas    map[string]*schema    `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *schema `json:"schema"`
+}
+
+var doc = mustLoad(spec)
+
+// mustLoad parses the specification. The specification is embedded so an
+// invalid specification is a programming error.
+func mustLoad(data []byte) *document {
+	d := &document{}
+	if err := json.Unmarshal(data, d); err != nil {
+		panic("openapi: Invalid specification: " + err.Error())
+	}
+
+	return d
+}
+
+// Handler serves the specification.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Write(spec)
+	})
+}
+
+// HasOperation returns true if the specification describes method on the
+// path template e.g. "/api/v1/board/{user}/{board}".
+func HasOperation(method string, pathTemplate string) bool {
+	return doc.operation(method, pathTemplate) != nil
+}
+
+// operation returns the operation of method on pathTemplate or nil.
+func (d *document) operation(method string, pathTemplate string) *operation {
+	item, ok := d.Paths[pathTemplate]
+	if !ok {
+		return nil
+	}
+
+	return item[strings.ToLower(method)]
+}
+
+// resolve returns the parameter p refers to.
+func (d *document) resolve(p *parameter) *parameter {
+	if p.Ref == "" {
+		return p
+	}
+
+	if resolved, ok := d.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]; ok {
+		return resolved
+	}
+
+	return p
+}
+
+// Validate checks the parameters and the JSON body of a request against the
+// operation of method and pathTemplate. pathVars contains the decoded path
+// parameters. Requests of operations that aren't specified are not
+// validated. The body is read and replaced so handlers can read it again.
+func Validate(r *http.Request, pathTemplate string, pathVars map[string]string) error {
+	op := doc.operation(r.Method, pathTemplate)
+	if op == nil {
+		return nil
+	}
+
+	for _, p := range op.Parameters {
+		p = doc.resolve(p)
+
+		var (
+			values  []string
+			present bool
+		)
+		switch p.In {
+		case "path":
+			var value string
+			value, present = pathVars[p.Name]
+			values = []string{value}
+		case "query":
+			values, present = r.URL.Query()[p.Name]
+		default:
+			continue
+		}
+
+		if !present {
+			if p.Required {
+				return errors.Errorf("Invalid request: %s parameter %s is required", p.In, p.Name)
+			}
+			continue
+		}
+
+		for _, raw := range values {
+			if err := validateParameter(p, raw); err != nil {
+				return err
+			}
+		}
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+
+	content, ok := op.RequestBody.Content["application/json"]
+	if !ok || content.Schema == nil {
+		return nil
+	}
+
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return errors.Wrap(err, "Invalid request: Can't read body")
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return errors.New("Invalid request: Body is required")
+		}
+		return nil
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return errors.New("Invalid request: Body is not valid JSON")
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("Invalid request: Body contains more than one JSON value")
+	}
+
+	if err := content.Schema.validate(doc, value, "body"); err != nil {
+		return errors.Wrap(err, "Invalid request")
+	}
+
+	return nil
+}
+
+// validateParameter converts the raw value of a parameter to the type of
+// its schema and validates it.
+func validateParameter(p *parameter, raw string) error {
+	if p.Schema == nil {
+		return nil
+	}
+
+	location := p.In + " parameter " + p.Name
+	schema := doc.resolveSchema(p.Schema)
+
+	var value interface{} = raw
+	switch schema.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return errors.Errorf("Invalid request: %s must be a number", location)
+		}
+		value = json.Number(raw)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.Errorf("Invalid request: %s must be a boolean", location)
+		}
+		value = b
+	}
+
+	if err := schema.validate(doc, value, location); err != nil {
+		return errors.Wrap(err, "Invalid request")
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package openapi
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var testRequests = []struct {
+		method   string
+		target   string
+		template string
+		vars     map[string]string
+		body     string
+		valid    bool
+	}{
+		{http.MethodPost, "/api/v1/board", "/api/v1/board", nil, `{"url": "https://www.pinterest.com/user1/board/"}`, true},
+		{http.MethodPost, "/api/v1/board", "/api/v1/board", nil, ``, false},
+		{http.MethodPost, "/api/v1/board", "/api/v1/board", nil, `{"url": ""}`, false},
+		{http.MethodPost, "/api/v1/board", "/api/v1/board", nil, `{"url": true}`, false},
+		{http.MethodPost, "/api/v1/board", "/api/v1/board", nil, `[]`, false},
+		{http.MethodPost, "/api/v1/board", "/api/v1/board", nil, `{"url": "x"} {}`, false},
+		{http.MethodGet, "/api/v1/jobs", "/api/v1/jobs", nil, ``, true},
+		{http.MethodGet, "/api/v1/jobs?limit=10", "/api/v1/jobs", nil, ``, true},
+		{http.MethodGet, "/api/v1/jobs?limit=1.5", "/api/v1/jobs", nil, ``, false},
+		{http.MethodGet, "/api/v1/jobs?limit=x", "/api/v1/jobs", nil, ``, false},
+		{http.MethodGet, "/api/v1/users?cursor=12&count=1000", "/api/v1/users", nil, ``, true},
+		{http.MethodGet, "/api/v1/users?count=1001", "/api/v1/users", nil, ``, false},
+		{http.MethodGet, "/api/v1/boardstatus", "/api/v1/boardstatus", nil, ``, false},
+		{http.MethodGet, "/api/v1/board/user1/board/pins", "/api/v1/board/{user}/{board}/pins", map[string]string{"user": "user1", "board": "board"}, ``, true},
+		{http.MethodGet, "/api/v1/board/user1/board/pins", "/api/v1/board/{user}/{board}/pins", map[string]string{"user": "user1"}, ``, false},
+		{http.MethodGet, "/unknown", "/unknown", nil, ``, true},
+	}
+
+	for _, tr := range testRequests {
+		r := httptest.NewRequest(tr.method, tr.target, strings.NewReader(tr.body))
+		err := Validate(r, tr.template, tr.vars)
+		if (err == nil) != tr.valid {
+			t.Errorf("%s %s %s: Got error: %v / Expected valid: %t", tr.method, tr.target, tr.body, err, tr.valid)
+		}
+	}
+}
+
+func TestValidateKeepsBody(t *testing.T) {
+	body := `{"path": "/user1/board/"}`
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/existsboard", strings.NewReader(body))
+
+	if err := Validate(r, "/api/v1/existsboard", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != body {
+		t.Errorf("Got body: %s / Expected: %s", content, body)
+	}
+}
@@ -0,0 +1,147 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// schema is the subset of the OpenAPI schema object used by the
+// specification.
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Required   []string           `json:"required"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+	Enum       []interface{}      `json:"enum"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	Pattern    string             `json:"pattern"`
+	Minimum    *float64           `json:"minimum"`
+	Maximum    *float64           `json:"maximum"`
+}
+
+// resolveSchema returns the schema s refers to.
+func (d *document) resolveSchema(s *schema) *schema {
+	if s.Ref == "" {
+		return s
+	}
+
+	if resolved, ok := d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]; ok {
+		return resolved
+	}
+
+	return s
+}
+
+// validate checks value against the schema. value is a decoded JSON value
+// with numbers decoded as json.Number. location describes the value in
+// error messages.
+func (s *schema) validate(d *document, value interface{}, location string) error {
+	s = d.resolveSchema(s)
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("%s must be an object", location)
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return errors.Errorf("%s.%s is required", location, name)
+			}
+		}
+		for name, property := range s.Properties {
+			if v, ok := object[name]; ok {
+				if err := property.validate(d, v, location+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return errors.Errorf("%s must be an array", location)
+		}
+		if s.MinItems != nil && len(array) < *s.MinItems {
+			return errors.Errorf("%s must have at least %d items", location, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(array) > *s.MaxItems {
+			return errors.Errorf("%s must have at most %d items", location, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, v := range array {
+				if err := s.Items.validate(d, v, fmt.Sprintf("%s[%d]", location, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return errors.Errorf("%s must be a string", location)
+		}
+		length := utf8.RuneCountInString(str)
+		if s.MinLength != nil && length < *s.MinLength {
+			return errors.Errorf("%s must have at least %d characters", location, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return errors.Errorf("%s must have at most %d characters", location, *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return errors.Wrapf(err, "%s has an invalid pattern in the specification", location)
+			}
+			if !re.MatchString(str) {
+				return errors.Errorf("%s must match %s", location, s.Pattern)
+			}
+		}
+
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return errors.Errorf("%s must be a number", location)
+		}
+		f, err := number.Float64()
+		if err != nil {
+			return errors.Errorf("%s must be a number", location)
+		}
+		if s.Type == "integer" {
+			if _, err := number.Int64(); err != nil {
+				return errors.Errorf("%s must be an integer", location)
+			}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return errors.Errorf("%s must be at least %v", location, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			return errors.Errorf("%s must be at most %v", location, *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return errors.Errorf("%s must be a boolean", location)
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		for _, allowed := range s.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		return errors.Errorf("%s must be one of %v", location, s.Enum)
+	}
+
+	return nil
+}
@@ -0,0 +1,513 @@
+package pinteresttest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultEmail and DefaultPassword are the credentials accepted by the
+	// login form of a new Server.
+	DefaultEmail    = "pinner@example.com"
+	DefaultPassword = "secret"
+	// DefaultPageSize is the number of pins rendered with the board page
+	// and loaded per scroll.
+	DefaultPageSize = 25
+
+	// authCookie is the cookie the scraper looks for to know it's logged in.
+	authCookie = "_auth"
+	// feedPath serves the pins loaded while scrolling.
+	feedPath = "/resource/BoardFeedResource/get/"
+)
+
+// Failure makes a board behave like Pinterest does when things go wrong.
+type Failure string
+
+const (
+	// FailureNone serves the board normally.
+	FailureNone Failure = ""
+	// FailureCaptcha shows a captcha instead of the pins.
+	FailureCaptcha Failure = "captcha"
+	// FailureServerError responds to the board page with 500.
+	FailureServerError Failure = "server-error"
+	// FailureFeedError responds with 500 to every scroll so only the pins
+	// rendered with the page are found.
+	FailureFeedError Failure = "feed-error"
+	// FailureNoOriginals renders pins without a link to the original
+	// picture like a changed page layout would.
+	FailureNoOriginals Failure = "no-originals"
+)
+
+// Board is a board of the fake site. Path may contain a section e.g.
+// "recipes/desserts". The section is listed on the page of its board.
+type Board struct {
+	User string
+	Path string
+	// Pins is the number of pins of the board.
+	Pins int
+	// Private boards are only shown after logging in.
+	Private bool
+	Failure Failure
+	// The first Videos pins are HLS video pins, the next GIFs pins are
+	// animated GIFs and the next IdeaPins pins are idea pins with IdeaPages
+	// pages each. Only the cover of idea pins is shown on the board. The
+	// remaining pins are pictures.
+	Videos    int
+	GIFs      int
+	IdeaPins  int
+	IdeaPages int
+	// Title, Description, Category and Collaborators are shown on the page
+	// of the board. Title defaults to the last segment of Path. Secret
+	// boards show an indicator.
+	Title         string
+	Description   string
+	Category      string
+	Collaborators []string
+	Secret        bool
+}
+
+// Cover returns the link to the cover picture of a board. It's a preview
+// of the first pin.
+func Cover(b Board) string {
+	if b.Pins == 0 {
+		return ""
+	}
+
+	return pictureURL("222x", pinHash(b.User, b.Path, 0))
+}
+
+// pin is a pin as shown on a board.
+type pin struct {
+	ID     string `json:"id"`
+	Srcset string `json:"srcset"`
+	// GIF is the animated GIF shown instead of the still preview.
+	GIF string `json:"gif,omitempty"`
+	// Video is the HLS playlist of a video pin.
+	Video string `json:"video,omitempty"`
+	// Pages is the number of pages of an idea pin.
+	Pages int `json:"pages,omitempty"`
+}
+
+// Server is a fake Pinterest site for testing the scraper without the
+// real one. It has a login form and boards that load further pins while
+// scrolling like Pinterest does.
+type Server struct {
+	*httptest.Server
+
+	// Email and Password are the credentials accepted by the login form.
+	Email    string
+	Password string
+	// PageSize is the number of pins rendered with the board page and
+	// loaded per scroll.
+	PageSize int
+	// Window is the maximum number of pins kept in the DOM. Like Pinterest
+	// the oldest pins are removed while scrolling. 0 keeps all pins.
+	Window int
+
+	mu        sync.Mutex
+	boards    map[string]Board
+	following map[string][]string
+	logins    int
+}
+
+// NewServer starts a fake site. It has to be closed by the caller.
+func NewServer() *Server {
+	s := &Server{
+		Email:     DefaultEmail,
+		Password:  DefaultPassword,
+		PageSize:  DefaultPageSize,
+		boards:    map[string]Board{},
+		following: map[string][]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/", s.login)
+	mux.HandleFunc(feedPath, s.feed)
+	mux.HandleFunc("/pin/", s.pin)
+	mux.HandleFunc("/", s.page)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// Host returns the host and port of the site to be used as Board.Host.
+func (s *Server) Host() string {
+	return s.Listener.Addr().String()
+}
+
+// AddBoard adds or replaces a board.
+func (s *Server) AddBoard(b Board) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.boards[boardKey(b.User, b.Path)] = b
+}
+
+// Follow makes user follow boards given as "user/board". They are listed
+// on the following page of user.
+func (s *Server) Follow(user string, boards ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.following[user] = append(s.following[user], boards...)
+}
+
+// Logins returns the number of successful logins.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logins
+}
+
+// Media returns the links to the files of all pins of a board: the
+// original pictures and GIFs, the HLS playlists of videos and the pictures
+// of all pages of idea pins. These are the links the scraper has to find.
+func (s *Server) Media(user string, path string) []string {
+	s.mu.Lock()
+	b, ok := s.boards[boardKey(user, path)]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	media := []string{}
+	for i := 0; i < b.Pins; i++ {
+		p := pinAt(b, i)
+		switch {
+		case p.Video != "":
+			media = append(media, p.Video)
+		case p.GIF != "":
+			media = append(media, p.GIF)
+		case p.Pages > 0:
+			for page := 0; page < p.Pages; page++ {
+				media = append(media, pictureURL("originals", pageHash(b, i, page)))
+			}
+		default:
+			media = append(media, Original(user, path, i))
+		}
+	}
+
+	return media
+}
+
+// Original returns the link to the original picture of the i-th pin of a
+// board.
+func Original(user string, path string, i int) string {
+	return pictureURL("originals", pinHash(user, path, i))
+}
+
+// pinAt returns the i-th pin of a board.
+func pinAt(b Board, i int) pin {
+	hash := pinHash(b.User, b.Path, i)
+	p := pin{ID: hash[:16], Srcset: srcset(b, hash)}
+
+	switch {
+	case i < b.Videos:
+		p.Video = fmt.Sprintf("https://v1.pinimg.com/videos/mc/hls/%s/%s/%s/%s.m3u8", hash[0:2], hash[2:4], hash[4:6], hash)
+	case i < b.Videos+b.GIFs:
+		p.GIF = strings.TrimSuffix(pictureURL("originals", hash), ".jpg") + ".gif"
+	case i < b.Videos+b.GIFs+b.IdeaPins:
+		p.Pages = b.IdeaPages
+		if p.Pages < 1 {
+			p.Pages = 1
+		}
+	}
+
+	return p
+}
+
+// srcset returns the srcset attribute of a preview picture.
+func srcset(b Board, hash string) string {
+	sizes := []string{"236x", "474x", "736x", "originals"}
+	if b.Failure == FailureNoOriginals {
+		sizes[3] = "1200x"
+	}
+
+	candidates := make([]string, 0, len(sizes))
+	for n, size := range sizes {
+		candidates = append(candidates, fmt.Sprintf("%s %dx", pictureURL(size, hash), n+1))
+	}
+
+	return strings.Join(candidates, ", ")
+}
+
+func pinHash(user string, path string, i int) string {
+	sum := md5.Sum([]byte(fmt.Sprintf("%s/%s/%d", user, path, i)))
+	return hex.EncodeToString(sum[:])
+}
+
+// pageHash returns the hash of the picture of a page of an idea pin.
+func pageHash(b Board, i int, page int) string {
+	sum := md5.Sum([]byte(fmt.Sprintf("%s/%s/%d/%d", b.User, b.Path, i, page)))
+	return hex.EncodeToString(sum[:])
+}
+
+func pictureURL(size string, hash string) string {
+	return fmt.Sprintf("https://i.pinimg.com/%s/%s/%s/%s/%s.jpg", size, hash[0:2], hash[2:4], hash[4:6], hash)
+}
+
+func boardKey(user string, path string) string {
+	return user + "/" + strings.Trim(path, "/")
+}
+
+// authenticated returns true if the request has the cookie set by the
+// login form.
+func authenticated(r *http.Request) bool {
+	cookie, err := r.Cookie(authCookie)
+	return err == nil && cookie.Value != ""
+}
+
+// lookup returns the board for the request and the HTTP status if it
+// can't be shown.
+func (s *Server) lookup(r *http.Request, key string) (Board, int) {
+	s.mu.Lock()
+	b, ok := s.boards[key]
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		return b, http.StatusNotFound
+	case b.Private && !authenticated(r):
+		return b, http.StatusUnauthorized
+	}
+
+	return b, http.StatusOK
+}
+
+// pins returns the pins starting at offset and if these are the last
+// ones.
+func (s *Server) pins(b Board, offset int) ([]pin, bool) {
+	end := offset + s.PageSize
+	if s.PageSize < 1 || end > b.Pins {
+		end = b.Pins
+	}
+
+	pins := []pin{}
+	for i := offset; i < end; i++ {
+		pins = append(pins, pinAt(b, i))
+	}
+
+	return pins, end >= b.Pins
+}
+
+// findPin returns the board and index of a pin.
+func (s *Server) findPin(id string) (Board, int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range s.boards {
+		for i := 0; i < b.Pins; i++ {
+			if pinHash(b.User, b.Path, i)[:16] == id {
+				return b, i, true
+			}
+		}
+	}
+
+	return Board{}, 0, false
+}
+
+// sections returns the paths of the sections of a board.
+func (s *Server) sections(b Board) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := boardKey(b.User, b.Path) + "/"
+	sections := []string{}
+	for key, section := range s.boards {
+		if strings.HasPrefix(key, prefix) {
+			sections = append(sections, section.Path)
+		}
+	}
+	sort.Strings(sections)
+
+	return sections
+}
+
+// savedBoards returns the paths of the boards of user as "user/board".
+// Private boards are only listed after logging in.
+func (s *Server) savedBoards(r *http.Request, user string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	boards := []string{}
+	for _, b := range s.boards {
+		if b.User == user && !strings.Contains(b.Path, "/") && (!b.Private || authenticated(r)) {
+			boards = append(boards, boardKey(b.User, b.Path))
+		}
+	}
+	sort.Strings(boards)
+
+	return boards
+}
+
+// profile shows the boards of a user or the boards the user follows. All
+// boards are rendered at once.
+func (s *Server) profile(w http.ResponseWriter, r *http.Request, user string, page string) {
+	boards := s.savedBoards(r, user)
+	if page == "following" {
+		s.mu.Lock()
+		boards = append([]string{}, s.following[user]...)
+		s.mu.Unlock()
+	}
+
+	links := []string{}
+	for _, b := range boards {
+		links = append(links, (&url.URL{Path: "/" + b + "/"}).String())
+	}
+
+	render(w, profileTemplate, struct {
+		User   string
+		Boards []string
+	}{user, links})
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	data := struct{ Failed bool }{}
+
+	if r.Method == http.MethodPost {
+		if r.FormValue("id") == s.Email && r.FormValue("password") == s.Password {
+			s.mu.Lock()
+			s.logins++
+			s.mu.Unlock()
+
+			http.SetCookie(w, &http.Cookie{Name: authCookie, Value: "1", Path: "/", HttpOnly: true})
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		data.Failed = true
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	render(w, loginTemplate, data)
+}
+
+func (s *Server) feed(w http.ResponseWriter, r *http.Request) {
+	b, status := s.lookup(r, r.URL.Query().Get("board"))
+	if status == http.StatusOK && b.Failure == FailureFeedError {
+		status = http.StatusInternalServerError
+	}
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	pins, end := s.pins(b, offset)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Pins []pin `json:"pins"`
+		End  bool  `json:"end"`
+	}{pins, end})
+}
+
+// pin shows the page of a pin. Idea pins show all their pages.
+func (s *Server) pin(w http.ResponseWriter, r *http.Request) {
+	b, i, ok := s.findPin(strings.Trim(strings.TrimPrefix(r.URL.Path, "/pin/"), "/"))
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	} else if b.Private && !authenticated(r) {
+		status = http.StatusUnauthorized
+	}
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		render(w, errorTemplate, status)
+		return
+	}
+
+	p := pinAt(b, i)
+	pages := []string{}
+	for page := 0; page < p.Pages; page++ {
+		pages = append(pages, srcset(b, pageHash(b, i, page)))
+	}
+
+	render(w, pinTemplate, struct {
+		Pin   pin
+		Pages []string
+	}{p, pages})
+}
+
+func (s *Server) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		render(w, homeTemplate, authenticated(r))
+		return
+	}
+
+	segments := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 2)
+	if len(segments) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+	if segments[1] == "_saved" || segments[1] == "following" {
+		s.profile(w, r, segments[0], segments[1])
+		return
+	}
+	key := boardKey(segments[0], segments[1])
+
+	b, status := s.lookup(r, key)
+	if status == http.StatusOK && b.Failure == FailureServerError {
+		status = http.StatusInternalServerError
+	}
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		render(w, errorTemplate, status)
+		return
+	}
+
+	pins, end := s.pins(b, 0)
+
+	sections := []string{}
+	for _, section := range s.sections(b) {
+		sections = append(sections, (&url.URL{Path: "/" + b.User + "/" + section + "/"}).String())
+	}
+
+	if b.Title == "" {
+		b.Title = b.Path[strings.LastIndex(b.Path, "/")+1:]
+	}
+
+	render(w, boardTemplate, struct {
+		Board    Board
+		Cover    string
+		Key      string
+		Captcha  bool
+		Pins     []pin
+		End      bool
+		Window   int
+		Sections []string
+		Feed     string
+	}{
+		Board:    b,
+		Cover:    Cover(b),
+		Key:      key,
+		Captcha:  b.Failure == FailureCaptcha,
+		Pins:     pins,
+		End:      end,
+		Window:   s.Window,
+		Sections: sections,
+		Feed:     feedPath,
+	})
+}
+
+func render(w http.ResponseWriter, tpl *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tpl.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,232 @@
+package pinteresttest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newClient(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &http.Client{Jar: jar}
+}
+
+func get(t *testing.T, c *http.Client, u string) (int, string) {
+	resp, err := c.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(body)
+}
+
+func TestLogin(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddBoard(Board{User: "pinner", Path: "secret", Pins: 3, Private: true})
+
+	var loginTests = []struct {
+		password string
+		status   int
+		logins   int
+	}{
+		{"wrong", http.StatusUnauthorized, 0},
+		{DefaultPassword, http.StatusOK, 1},
+	}
+
+	for _, test := range loginTests {
+		c := newClient(t)
+
+		resp, err := c.PostForm(s.URL+"/login/", url.Values{"id": {DefaultEmail}, "password": {test.password}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("Got: %d / Expected: %d", resp.StatusCode, test.status)
+		}
+		if s.Logins() != test.logins {
+			t.Errorf("Got: %d logins / Expected: %d", s.Logins(), test.logins)
+		}
+
+		status, _ := get(t, c, s.URL+"/pinner/secret/")
+		expected := http.StatusUnauthorized
+		if test.status == http.StatusOK {
+			expected = http.StatusOK
+		}
+		if status != expected {
+			t.Errorf("Got: %d for private board / Expected: %d", status, expected)
+		}
+	}
+}
+
+func TestBoard(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.PageSize = 10
+	s.AddBoard(Board{User: "pinner", Path: "recipes", Pins: 25})
+	s.AddBoard(Board{User: "pinner", Path: "recipes/desserts", Pins: 5})
+	s.AddBoard(Board{User: "pinner", Path: "broken", Pins: 5, Failure: FailureServerError})
+	s.AddBoard(Board{User: "pinner", Path: "captcha", Pins: 5, Failure: FailureCaptcha})
+
+	c := newClient(t)
+
+	status, body := get(t, c, s.URL+"/pinner/recipes/")
+	if status != http.StatusOK {
+		t.Fatalf("Got: %d / Expected: %d", status, http.StatusOK)
+	}
+	if n := strings.Count(body, `data-test-id="pin" `); n != s.PageSize {
+		t.Errorf("Got: %d pins / Expected: %d", n, s.PageSize)
+	}
+	if !strings.Contains(body, Original("pinner", "recipes", 0)) {
+		t.Errorf("Got: page without original of first pin / Expected: %s", Original("pinner", "recipes", 0))
+	}
+	if !strings.Contains(body, `href="/pinner/recipes/desserts/"`) {
+		t.Errorf("Got: page without section / Expected: link to /pinner/recipes/desserts/")
+	}
+
+	// Scrolling loads the remaining pins page by page.
+	found := 10
+	for offset := 10; ; offset += s.PageSize {
+		status, body := get(t, c, s.URL+feedPath+"?board=pinner/recipes&offset="+strconv.Itoa(offset))
+		if status != http.StatusOK {
+			t.Fatalf("Got: %d / Expected: %d", status, http.StatusOK)
+		}
+		page := struct {
+			Pins []pin
+			End  bool
+		}{}
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		found += len(page.Pins)
+		if page.End {
+			break
+		}
+	}
+	if found != 25 {
+		t.Errorf("Got: %d pins / Expected: %d", found, 25)
+	}
+
+	if media := s.Media("pinner", "recipes/desserts"); len(media) != 5 {
+		t.Errorf("Got: %d media / Expected: %d", len(media), 5)
+	}
+
+	var statusTests = []struct {
+		path   string
+		status int
+	}{
+		{"/pinner/recipes/desserts/", http.StatusOK},
+		{"/pinner/missing/", http.StatusNotFound},
+		{"/pinner/broken/", http.StatusInternalServerError},
+		{"/pinner/captcha/", http.StatusOK},
+	}
+
+	for _, test := range statusTests {
+		status, body := get(t, c, s.URL+test.path)
+		if status != test.status {
+			t.Errorf("Got: %d for %s / Expected: %d", status, test.path, test.status)
+		}
+		if test.path == "/pinner/captcha/" && strings.Contains(body, "/originals/") {
+			t.Errorf("Got: pins on captcha page / Expected: none")
+		}
+	}
+}
+
+func TestPinKinds(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddBoard(Board{User: "pinner", Path: "mixed", Pins: 5, Videos: 1, GIFs: 1, IdeaPins: 1, IdeaPages: 3})
+
+	c := newClient(t)
+
+	_, body := get(t, c, s.URL+"/pinner/mixed/")
+	var kindTests = []string{
+		`<video muted src="https://v1.pinimg.com/videos/mc/hls/`,
+		`.gif"></a>`,
+		`data-test-id="story-pin-indicator">3 pages`,
+	}
+	for _, expected := range kindTests {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Got: board without %s / Expected: all kinds of pins", expected)
+		}
+	}
+
+	// Videos, GIFs, three pages of the idea pin and two pictures
+	media := s.Media("pinner", "mixed")
+	if len(media) != 7 {
+		t.Errorf("Got: %d media / Expected: %d", len(media), 7)
+	}
+
+	idea := pinAt(Board{User: "pinner", Path: "mixed", Pins: 5, Videos: 1, GIFs: 1, IdeaPins: 1, IdeaPages: 3}, 2)
+	status, body := get(t, c, s.URL+"/pin/"+idea.ID+"/")
+	if status != http.StatusOK {
+		t.Fatalf("Got: %d / Expected: %d", status, http.StatusOK)
+	}
+	if n := strings.Count(body, `data-test-id="story-pin-page"`); n != 3 {
+		t.Errorf("Got: %d pages / Expected: %d", n, 3)
+	}
+	for _, m := range media[2:5] {
+		if !strings.Contains(body, m) {
+			t.Errorf("Got: idea pin without page %s / Expected: all pages", m)
+		}
+	}
+
+	if status, _ := get(t, c, s.URL+"/pin/0000000000000000/"); status != http.StatusNotFound {
+		t.Errorf("Got: %d / Expected: %d", status, http.StatusNotFound)
+	}
+}
+
+func TestProfilePages(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddBoard(Board{User: "pinner", Path: "recipes", Pins: 1})
+	s.AddBoard(Board{User: "pinner", Path: "recipes/desserts", Pins: 1})
+	s.AddBoard(Board{User: "pinner", Path: "secret", Pins: 1, Private: true})
+	s.AddBoard(Board{User: "other", Path: "cars", Pins: 1})
+	s.Follow("pinner", "other/cars")
+
+	c := newClient(t)
+
+	var profileTests = []struct {
+		page    string
+		boards  []string
+		missing []string
+	}{
+		{"_saved", []string{`href="/pinner/recipes/"`}, []string{`href="/pinner/secret/"`, `href="/pinner/recipes/desserts/"`, `href="/other/cars/"`}},
+		{"following", []string{`href="/other/cars/"`}, []string{`href="/pinner/recipes/"`}},
+	}
+
+	for _, test := range profileTests {
+		status, body := get(t, c, s.URL+"/pinner/"+test.page+"/")
+		if status != http.StatusOK {
+			t.Fatalf("Got: %d / Expected: %d", status, http.StatusOK)
+		}
+		for _, expected := range test.boards {
+			if !strings.Contains(body, expected) {
+				t.Errorf("%s: Got: page without %s / Expected: board listed", test.page, expected)
+			}
+		}
+		for _, unexpected := range test.missing {
+			if strings.Contains(body, unexpected) {
+				t.Errorf("%s: Got: page with %s / Expected: board not listed", test.page, unexpected)
+			}
+		}
+	}
+}
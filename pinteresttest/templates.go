@@ -0,0 +1,170 @@
+package pinteresttest
+
+import "html/template"
+
+var (
+	homeTemplate = template.Must(template.New("home").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Pinterest</title></head>
+<body>
+{{if .}}<p>Home feed</p>{{else}}<a href="/login/">Log in</a>{{end}}
+</body>
+</html>
+`))
+
+	loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Log in | Pinterest</title></head>
+<body>
+<form method="post" action="/login/">
+	{{if .Failed}}<p class="error">The password you entered is incorrect.</p>{{end}}
+	<input id="email" name="id" type="email" placeholder="Email">
+	<input id="password" name="password" type="password" placeholder="Password">
+	<button class="red SignupButton active" type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+	errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Pinterest</title></head>
+<body>
+{{if eq . 401}}<p>Log in to see this board.</p>{{else if eq . 404}}<p>Sorry! We couldn't find that page.</p>{{else}}<p>Something went wrong.</p>{{end}}
+</body>
+</html>
+`))
+
+	// pinTemplate renders the page of a pin. Idea pins show all their pages.
+	pinTemplate = template.Must(template.New("pin").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Pin | Pinterest</title></head>
+<body>
+<div data-test-id="closeup-body">
+{{if .Pages}}{{range .Pages}}<div data-test-id="story-pin-page"><img alt="" width="236" height="280" srcset="{{.}}"></div>
+{{end}}{{else}}<img alt="" width="236" height="280" srcset="{{.Pin.Srcset}}">{{end}}
+</div>
+</body>
+</html>
+`))
+
+	// profileTemplate renders the boards of a profile page. Besides the
+	// boards it links to the user and its pages like Pinterest does.
+	profileTemplate = template.Must(template.New("profile").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.User}} | Pinterest</title></head>
+<body>
+<nav><a href="/{{.User}}/">{{.User}}</a> <a href="/{{.User}}/_saved/">Saved</a> <a href="/{{.User}}/following/">Following</a> <a href="/{{.User}}/pins/">Pins</a></nav>
+<div role="list">
+{{range .Boards}}<div data-test-id="board-card" role="listitem"><a href="{{.}}">{{.}}</a></div>
+{{end}}</div>
+</body>
+</html>
+`))
+
+	// boardTemplate renders the first pins of a board. Further pins are
+	// fetched from the feed whenever the bottom of the page is reached and
+	// added by the script with the same markup as the "pin" template.
+	boardTemplate = template.Must(template.New("board").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>{{.Board.Title}} | Pinterest</title>
+<meta property="og:title" content="{{.Board.Title}}">
+{{if .Board.Description}}<meta property="og:description" content="{{.Board.Description}}">{{end}}
+{{if .Board.Category}}<meta property="pinterestapp:category" content="{{.Board.Category}}">{{end}}
+{{if .Cover}}<meta property="og:image" content="{{.Cover}}">{{end}}
+<style>
+	[data-test-id="pin"] { width: 236px; height: 300px; }
+	[data-test-id="pin"] img { width: 236px; height: 280px; }
+</style>
+</head>
+<body>
+<h1>{{.Board.Title}}</h1>
+{{if .Board.Secret}}<div data-test-id="board-secret-indicator">Secret</div>{{end}}
+{{if .Board.Description}}<div data-test-id="board-description">{{.Board.Description}}</div>{{end}}
+<div data-test-id="board-collaborators"><a href="/{{.Board.User}}/">{{.Board.User}}</a>{{range .Board.Collaborators}}<a href="/{{.}}/">{{.}}</a>{{end}}</div>
+{{if .Captcha}}
+<div id="captcha">Please confirm that you're not a robot.</div>
+{{else}}
+{{if .Sections}}<div data-test-id="board-sections">{{range .Sections}}<a href="{{.}}">{{.}}</a>{{end}}</div>{{end}}
+<div id="grid" role="list">
+{{range .Pins}}{{template "pin" .}}
+{{end}}</div>
+<script>
+(function() {
+	var grid = document.getElementById("grid");
+	var board = {{.Key}};
+	var feed = {{.Feed}};
+	var offset = {{len .Pins}};
+	var end = {{.End}};
+	var max = {{.Window}};
+	var loading = false;
+
+	function add(data) {
+		var pin = document.createElement("div");
+		pin.setAttribute("data-test-id", "pin");
+		pin.setAttribute("data-grid-item", "true");
+		pin.setAttribute("role", "listitem");
+		var link = document.createElement("a");
+		link.href = "/pin/" + data.id + "/";
+		var img = document.createElement("img");
+		img.alt = "";
+		img.srcset = data.srcset;
+		if (data.gif) {
+			img.src = data.gif;
+		}
+		link.appendChild(img);
+		pin.appendChild(link);
+		if (data.video) {
+			var video = document.createElement("video");
+			video.muted = true;
+			video.src = data.video;
+			pin.appendChild(video);
+		}
+		if (data.pages) {
+			var indicator = document.createElement("div");
+			indicator.setAttribute("data-test-id", "story-pin-indicator");
+			indicator.textContent = data.pages + " pages";
+			pin.appendChild(indicator);
+		}
+		grid.appendChild(pin);
+		while (max > 0 && grid.children.length > max) {
+			grid.removeChild(grid.firstElementChild);
+		}
+	}
+
+	function load() {
+		if (loading || end) {
+			return;
+		}
+		if (window.innerHeight + window.scrollY < document.body.scrollHeight - 600) {
+			return;
+		}
+		loading = true;
+		fetch(feed + "?board=" + encodeURIComponent(board) + "&offset=" + offset)
+			.then(function(response) {
+				if (!response.ok) {
+					throw new Error("Feed responded with " + response.status);
+				}
+				return response.json();
+			})
+			.then(function(data) {
+				data.pins.forEach(add);
+				offset += data.pins.length;
+				end = data.end;
+				loading = false;
+			})
+			.catch(function(e) {
+				console.error(e.message);
+				loading = false;
+			});
+	}
+
+	window.addEventListener("scroll", load);
+})();
+</script>
+{{end}}
+</body>
+</html>
+{{define "pin"}}<div data-test-id="pin" data-grid-item="true" role="listitem"><a href="/pin/{{.ID}}/"><img alt="" srcset="{{.Srcset}}"{{if .GIF}} src="{{.GIF}}"{{end}}></a>{{if .Video}}<video muted src="{{.Video}}"></video>{{end}}{{if .Pages}}<div data-test-id="story-pin-indicator">{{.Pages}} pages</div>{{end}}</div>{{end}}`))
+)
@@ -7,11 +7,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 
-	"os"
-	"os/signal"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 )
 
@@ -19,6 +16,11 @@ var (
 	redisPool *redis.Pool
 )
 
+// ReservedUser is the first part of the keys pinbackup uses internally.
+// The board sets of a Pinterest user with this name would clash with them.
+// So the user can't be backed up.
+const ReservedUser = "pinbackup"
+
 // GetConnection returns a Redis connection from connection pool or error if no
 // connection is available. Remember to use Close() after the connection is no
 // longer needed to avoid memory leaks and too many Redis connection in use.
@@ -36,6 +38,19 @@ func GetConnection() (redis.Conn, error) {
 	return conn, nil
 }
 
+// Ping borrows a connection from the pool and sends PING to Redis.
+func Ping() error {
+	conn, err := GetConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("PING")
+
+	return err
+}
+
 // InitPool initializes a Redis connection pool with max. 10 idle connections,
 // 100 max active connections and 240 sec timeout.
 func InitPool(host string, port int) {
@@ -65,25 +80,20 @@ func InitPool(host string, port int) {
 			return err
 		},
 	}
-
-	cleanupHook()
 }
 
-// cleanupHook cleans up resources and shuts down gracefully.
-func cleanupHook() {
-	log.Trace().
-		Str("method", "cleanupHook").
-		Msg("Waiting for signal to exit gracefully")
-
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	signal.Notify(c, syscall.SIGTERM)
-	signal.Notify(c, syscall.SIGKILL)
-	go func() {
-		<-c
-		redisPool.Close()
-		os.Exit(0)
-	}()
+// ClosePool closes the Redis connection pool. Call it after all work using
+// Redis connections is done.
+func ClosePool() error {
+	if redisPool == nil {
+		return nil
+	}
+
+	log.Debug().
+		Str("method", "ClosePool").
+		Msg("Closing Redis pool")
+
+	return redisPool.Close()
 }
 
 // Publish takes a Redis connection, the channel name and the message which
@@ -134,3 +144,99 @@ func AddPicture(conn redis.Conn, key string, picture string) error {
 
 	return nil
 }
+
+// AddPictures adds all pictures to a key. The SADD commands are pipelined in
+// batches of batchSize to avoid one round-trip per picture. Returns the number
+// of pictures that were not yet stored in the set.
+func AddPictures(conn redis.Conn, key string, pictures []string, batchSize int) (int, error) {
+	return pipelineMembers(conn, "SADD", key, pictures, batchSize)
+}
+
+// RemovePictures removes all pictures from a key. The SREM commands are
+// pipelined in batches of batchSize. Returns the number of pictures that
+// were actually removed.
+func RemovePictures(conn redis.Conn, key string, pictures []string, batchSize int) (int, error) {
+	return pipelineMembers(conn, "SREM", key, pictures, batchSize)
+}
+
+// CountExistingPictures returns how many of the pictures are already stored
+// in the set of a key. The SISMEMBER commands are pipelined in batches of
+// batchSize.
+func CountExistingPictures(conn redis.Conn, key string, pictures []string, batchSize int) (int, error) {
+	return pipelineMembers(conn, "SISMEMBER", key, pictures, batchSize)
+}
+
+// Pictures returns all pictures stored in the set of a key.
+func Pictures(conn redis.Conn, key string) ([]string, error) {
+	return redis.Strings(conn.Do("SMEMBERS", key))
+}
+
+// ScanKeys returns all keys of the given type matching pattern. SCAN is used
+// instead of KEYS to avoid blocking Redis on large databases. The TYPE
+// option of SCAN needs Redis 6.0 or newer.
+func ScanKeys(conn redis.Conn, pattern string, keyType string) ([]string, error) {
+	var (
+		cursor int64
+		keys   []string
+	)
+
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 1000, "TYPE", keyType))
+		if err != nil {
+			return nil, err
+		}
+
+		var batch []string
+		if _, err := redis.Scan(values, &cursor, &batch); err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+// DeleteKey removes a key from Redis.
+func DeleteKey(conn redis.Conn, key string) error {
+	_, err := conn.Do("DEL", key)
+	return err
+}
+
+// pipelineMembers sends command for every member of a key in batches of
+// batchSize and sums up the integer replies.
+func pipelineMembers(conn redis.Conn, command string, key string, members []string, batchSize int) (int, error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	total := 0
+
+	for start := 0; start < len(members); start += batchSize {
+		end := start + batchSize
+		if end > len(members) {
+			end = len(members)
+		}
+
+		for _, member := range members[start:end] {
+			if err := conn.Send(command, key, member); err != nil {
+				return total, err
+			}
+		}
+
+		if err := conn.Flush(); err != nil {
+			return total, err
+		}
+
+		for range members[start:end] {
+			n, err := redis.Int(conn.Receive())
+			if err != nil {
+				return total, err
+			}
+			total += n
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,211 @@
+package redis
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// The pictures of a board are stored in a set with key "user:board". To
+// list users and boards without scanning the whole keyspace the following
+// index keys are maintained in addition.
+const (
+	// usersKey is a set of all users with at least one board.
+	usersKey = "pinbackup:users"
+	// boardsKeyPrefix + user is a sorted set of all boards of a user scored
+	// by the time the board was synced the last time.
+	boardsKeyPrefix = "pinbackup:boards:"
+	// pinsKeyPrefix + user + ":" + board is a hash containing the metadata
+	// of all pictures of a board. The field is the picture filename.
+	pinsKeyPrefix = "pinbackup:pins:"
+)
+
+// BoardEntry is a board of a user in the index.
+type BoardEntry struct {
+	Path     string
+	LastSync int64
+}
+
+// PictureInfo is the metadata stored for every downloaded picture.
+type PictureInfo struct {
+	URL        string `json:"url"`
+	UUID       string `json:"uuid,omitempty"`
+	Downloaded int64  `json:"downloaded"`
+}
+
+// boardsKey returns the key of the sorted set containing the boards of user.
+func boardsKey(user string) string {
+	return boardsKeyPrefix + user
+}
+
+// PictureInfoKey returns the key of the hash containing the picture
+// metadata of a board.
+func PictureInfoKey(user string, board string) string {
+	return pinsKeyPrefix + user + ":" + board
+}
+
+// IndexBoard adds user and board to the index if they don't exist yet.
+func IndexBoard(conn redis.Conn, user string, board string) error {
+	conn.Send("MULTI")
+	conn.Send("SADD", usersKey, user)
+	conn.Send("ZADD", boardsKey(user), "NX", 0, board)
+	_, err := conn.Do("EXEC")
+
+	return err
+}
+
+// TouchBoard sets the last sync time of a board.
+func TouchBoard(conn redis.Conn, user string, board string, t time.Time) error {
+	conn.Send("MULTI")
+	conn.Send("SADD", usersKey, user)
+	conn.Send("ZADD", boardsKey(user), t.Unix(), board)
+	_, err := conn.Do("EXEC")
+
+	return err
+}
+
+// UnindexBoard removes a board from the index. The user is removed as
+// well if it was the last board of the user.
+func UnindexBoard(conn redis.Conn, user string, board string) error {
+	conn.Send("MULTI")
+	conn.Send("ZREM", boardsKey(user), board)
+	conn.Send("DEL", PictureInfoKey(user, board), BoardMetaKey(user, board), BoardHistoryKey(user, board))
+	conn.Send("ZCARD", boardsKey(user))
+	values, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+
+	if remaining, _ := redis.Int(values[2], nil); remaining == 0 {
+		_, err = conn.Do("SREM", usersKey, user)
+	}
+
+	return err
+}
+
+// ScanUsers returns a batch of users starting at cursor and the cursor of
+// the next batch. The next cursor is "0" if all users were returned.
+// count is only a hint how many users to return.
+func ScanUsers(conn redis.Conn, cursor string, count int) ([]string, string, error) {
+	values, err := redis.Values(conn.Do("SSCAN", usersKey, cursor, "COUNT", count))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		next  string
+		users []string
+	)
+	if _, err := redis.Scan(values, &next, &users); err != nil {
+		return nil, "", err
+	}
+
+	return users, next, nil
+}
+
+// ScanBoards returns a batch of boards of a user starting at cursor and
+// the cursor of the next batch. The next cursor is "0" if all boards were
+// returned.
+func ScanBoards(conn redis.Conn, user string, cursor string, count int) ([]BoardEntry, string, error) {
+	values, err := redis.Values(conn.Do("ZSCAN", boardsKey(user), cursor, "COUNT", count))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		next    string
+		members []string
+	)
+	if _, err := redis.Scan(values, &next, &members); err != nil {
+		return nil, "", err
+	}
+
+	boards := []BoardEntry{}
+	for i := 0; i+1 < len(members); i += 2 {
+		score, err := strconv.ParseFloat(members[i+1], 64)
+		if err != nil {
+			return nil, "", err
+		}
+		boards = append(boards, BoardEntry{Path: members[i], LastSync: int64(score)})
+	}
+
+	return boards, next, nil
+}
+
+// AllBoards returns the paths of all indexed boards of a user.
+func AllBoards(conn redis.Conn, user string) ([]string, error) {
+	return redis.Strings(conn.Do("ZRANGE", boardsKey(user), 0, -1))
+}
+
+// IsBoardIndexed returns true if the board is in the index.
+func IsBoardIndexed(conn redis.Conn, user string, board string) (bool, error) {
+	_, err := redis.Int64(conn.Do("ZSCORE", boardsKey(user), board))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// ScanPictures returns a batch of pictures of a board set starting at
+// cursor and the cursor of the next batch. The next cursor is "0" if all
+// pictures were returned.
+func ScanPictures(conn redis.Conn, key string, cursor string, count int) ([]string, string, error) {
+	values, err := redis.Values(conn.Do("SSCAN", key, cursor, "COUNT", count))
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		next     string
+		pictures []string
+	)
+	if _, err := redis.Scan(values, &next, &pictures); err != nil {
+		return nil, "", err
+	}
+
+	return pictures, next, nil
+}
+
+// SetPictureInfo stores the metadata of a picture. If overwrite is false
+// existing metadata is kept.
+func SetPictureInfo(conn redis.Conn, user string, board string, name string, info *PictureInfo, overwrite bool) error {
+	value, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	command := "HSET"
+	if !overwrite {
+		command = "HSETNX"
+	}
+
+	_, err = conn.Do(command, PictureInfoKey(user, board), name, value)
+
+	return err
+}
+
+// GetPictureInfo returns the metadata of a picture or nil if there is none.
+func GetPictureInfo(conn redis.Conn, user string, board string, name string) (*PictureInfo, error) {
+	value, err := redis.Bytes(conn.Do("HGET", PictureInfoKey(user, board), name))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info := &PictureInfo{}
+	if err := json.Unmarshal(value, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// IsPicture returns true if the picture is stored in the set of a board.
+func IsPicture(conn redis.Conn, key string, name string) (bool, error) {
+	return redis.Bool(conn.Do("SISMEMBER", key, name))
+}
@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// BoardLockKeyPrefix + user + ":" + board is the key of the lock a scraper
+// holds while working a board. The value is the UUID of the job.
+const BoardLockKeyPrefix = "pinbackup:lock:board:"
+
+// refreshLockScript extends the TTL of a lock if it's still held by the
+// given owner.
+var refreshLockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseLockScript deletes a lock if it's still held by the given owner.
+var releaseLockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// BoardLockKey returns the Redis key of the lock of a board.
+func BoardLockKey(user string, board string) string {
+	return BoardLockKeyPrefix + user + ":" + board
+}
+
+// AcquireLock sets the lock key to owner if nobody holds it. The lock expires
+// after ttl unless it's refreshed. Returns the current owner if the lock is
+// held by somebody else.
+func AcquireLock(conn redis.Conn, key string, owner string, ttl time.Duration) (bool, string, error) {
+	reply, err := conn.Do("SET", key, owner, "NX", "PX", ttl.Milliseconds())
+	if err != nil {
+		return false, "", err
+	}
+	if reply != nil {
+		return true, owner, nil
+	}
+
+	current, err := redis.String(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		// Expired in the meantime. The caller may try again.
+		return false, "", nil
+	}
+
+	return false, current, err
+}
+
+// RefreshLock extends the TTL of a lock held by owner. Returns false if the
+// lock expired or is held by somebody else.
+func RefreshLock(conn redis.Conn, key string, owner string, ttl time.Duration) (bool, error) {
+	refreshed, err := redis.Int(refreshLockScript.Do(conn, key, owner, ttl.Milliseconds()))
+	if err != nil {
+		return false, err
+	}
+
+	return refreshed == 1, nil
+}
+
+// ReleaseLock deletes a lock held by owner. Locks of other owners are left
+// untouched.
+func ReleaseLock(conn redis.Conn, key string, owner string) error {
+	_, err := releaseLockScript.Do(conn, key, owner)
+	return err
+}
@@ -0,0 +1,222 @@
+package redis
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// boardMetaKeyPrefix + user + ":" + board contains the metadata of a
+	// board as JSON.
+	boardMetaKeyPrefix = "pinbackup:boardmeta:"
+	// boardHistoryKeyPrefix + user + ":" + board is a list of changes of
+	// the metadata of a board, newest first.
+	boardHistoryKeyPrefix = "pinbackup:boardhistory:"
+	// maxBoardHistory is the number of changes kept per board.
+	maxBoardHistory = 500
+)
+
+// BoardMeta is the metadata of a board captured on every scrape.
+type BoardMeta struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Category    string `json:"category,omitempty"`
+	// Privacy is "public" or "secret".
+	Privacy string `json:"privacy"`
+	// Cover is the URL of the cover picture and CoverFile the name it's
+	// stored under next to the pictures.
+	Cover     string `json:"cover,omitempty"`
+	CoverFile string `json:"coverfile,omitempty"`
+	// Collaborators are the users besides the owner who can add pins.
+	Collaborators []string `json:"collaborators"`
+	// Sections are the paths of the sections e.g. "board/section".
+	Sections []string `json:"sections"`
+	// Scraped is the time the metadata was captured.
+	Scraped int64 `json:"scraped"`
+}
+
+// BoardChange is a change of the metadata of a board. Changes of lists
+// e.g. the sections are recorded as items added and removed.
+type BoardChange struct {
+	Time    int64    `json:"time"`
+	Field   string   `json:"field"`
+	Old     string   `json:"old,omitempty"`
+	New     string   `json:"new,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// BoardMetaKey returns the key of the metadata of a board.
+func BoardMetaKey(user string, board string) string {
+	return boardMetaKeyPrefix + user + ":" + board
+}
+
+// BoardHistoryKey returns the key of the changes of the metadata of a
+// board.
+func BoardHistoryKey(user string, board string) string {
+	return boardHistoryKeyPrefix + user + ":" + board
+}
+
+// difference returns the items of a that aren't in b.
+func difference(a []string, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, item := range b {
+		in[item] = true
+	}
+
+	result := []string{}
+	for _, item := range a {
+		if !in[item] {
+			result = append(result, item)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// DiffBoardMeta returns the changes from old to new. The time of the
+// changes is the time new was scraped.
+func DiffBoardMeta(old *BoardMeta, new *BoardMeta) []BoardChange {
+	changes := []BoardChange{}
+
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"title", old.Title, new.Title},
+		{"description", old.Description, new.Description},
+		{"category", old.Category, new.Category},
+		{"privacy", old.Privacy, new.Privacy},
+		{"cover", old.Cover, new.Cover},
+	}
+	for _, field := range fields {
+		if field.old != field.new {
+			changes = append(changes, BoardChange{Time: new.Scraped, Field: field.name, Old: field.old, New: field.new})
+		}
+	}
+
+	lists := []struct {
+		name     string
+		old, new []string
+	}{
+		{"collaborators", old.Collaborators, new.Collaborators},
+		{"sections", old.Sections, new.Sections},
+	}
+	for _, list := range lists {
+		added, removed := difference(list.new, list.old), difference(list.old, list.new)
+		if len(added) > 0 || len(removed) > 0 {
+			changes = append(changes, BoardChange{Time: new.Scraped, Field: list.name, Added: added, Removed: removed})
+		}
+	}
+
+	return changes
+}
+
+// GetBoardMeta returns the metadata of a board or nil if there is none.
+func GetBoardMeta(conn redis.Conn, user string, board string) (*BoardMeta, error) {
+	value, err := redis.Bytes(conn.Do("GET", BoardMetaKey(user, board)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &BoardMeta{}
+	if err := json.Unmarshal(value, meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// SetBoardMeta stores the metadata of a board and records the changes
+// since it was stored the last time. The stored cover file is kept as
+// long as the cover doesn't change. Returns the changes.
+func SetBoardMeta(conn redis.Conn, user string, board string, meta *BoardMeta) ([]BoardChange, error) {
+	if meta.Scraped == 0 {
+		meta.Scraped = time.Now().Unix()
+	}
+
+	old, err := GetBoardMeta(conn, user, board)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []BoardChange{}
+	if old != nil {
+		changes = DiffBoardMeta(old, meta)
+		if meta.CoverFile == "" && meta.Cover == old.Cover {
+			meta.CoverFile = old.CoverFile
+		}
+	}
+
+	value, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.Send("MULTI")
+	conn.Send("SET", BoardMetaKey(user, board), value)
+	if len(changes) > 0 {
+		args := redis.Args{}.Add(BoardHistoryKey(user, board))
+		for _, change := range changes {
+			encoded, err := json.Marshal(change)
+			if err != nil {
+				conn.Do("DISCARD")
+				return nil, err
+			}
+			args = args.Add(encoded)
+		}
+		conn.Send("LPUSH", args...)
+		conn.Send("LTRIM", BoardHistoryKey(user, board), 0, maxBoardHistory-1)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// SetBoardCoverFile stores the name of the downloaded cover of a board if
+// the cover is still url.
+func SetBoardCoverFile(conn redis.Conn, user string, board string, url string, name string) error {
+	meta, err := GetBoardMeta(conn, user, board)
+	if err != nil || meta == nil || meta.Cover != url {
+		return err
+	}
+
+	meta.CoverFile = name
+	value, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("SET", BoardMetaKey(user, board), value)
+
+	return err
+}
+
+// BoardHistory returns the changes of the metadata of a board, newest
+// first.
+func BoardHistory(conn redis.Conn, user string, board string) ([]BoardChange, error) {
+	values, err := redis.ByteSlices(conn.Do("LRANGE", BoardHistoryKey(user, board), 0, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []BoardChange{}
+	for _, value := range values {
+		change := BoardChange{}
+		if err := json.Unmarshal(value, &change); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,41 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffBoardMeta(t *testing.T) {
+	old := &BoardMeta{
+		Title:         "Recipes",
+		Description:   "Food",
+		Privacy:       "public",
+		Cover:         "https://i.pinimg.com/200x150/aa/bb/cc/aabbcc.jpg",
+		Collaborators: []string{"alice", "bob"},
+		Sections:      []string{"recipes/cakes"},
+		Scraped:       100,
+	}
+	new := &BoardMeta{
+		Title:         "Recipes",
+		Description:   "Food I like",
+		Privacy:       "secret",
+		Cover:         old.Cover,
+		Collaborators: []string{"bob", "carol"},
+		Sections:      []string{"recipes/cakes"},
+		Scraped:       200,
+	}
+
+	expected := []BoardChange{
+		{Time: 200, Field: "description", Old: "Food", New: "Food I like"},
+		{Time: 200, Field: "privacy", Old: "public", New: "secret"},
+		{Time: 200, Field: "collaborators", Added: []string{"carol"}, Removed: []string{"alice"}},
+	}
+
+	if changes := DiffBoardMeta(old, new); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Got: %+v / Expected: %+v", changes, expected)
+	}
+
+	if changes := DiffBoardMeta(new, new); len(changes) != 0 {
+		t.Errorf("Got: %+v / Expected: no changes", changes)
+	}
+}
@@ -0,0 +1,146 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/account"
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// sessionTTL is how long the cookies of the session of an account are
+// kept. Pinterest sessions last longer. So the scraper only logs in again
+// if the account wasn't used for a while.
+const sessionTTL = 30 * 24 * time.Hour
+
+// loginAccount is the Pinterest account a board is scraped with instead of
+// the default login of the scraper.
+type loginAccount struct {
+	name     string
+	email    string
+	password string
+	key      []byte
+}
+
+// loadAccount returns the account name with its password decrypted.
+func loadAccount(config *Config, name string) (*loginAccount, error) {
+	key, err := account.ParseKey(config.AccountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	a, err := account.Get(conn, name)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := a.Decrypt(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loginAccount{name: a.Name, email: a.Email, password: password, key: key}, nil
+}
+
+// credentials returns the login name and password the scraper logs in
+// with.
+func (s *scraper) credentials() (string, string) {
+	if s.account != nil {
+		return s.account.email, s.account.password
+	}
+
+	return s.config.LoginName, s.config.LoginPassword
+}
+
+// cookieParams converts cookies read from the browser into cookies that
+// can be set again.
+func cookieParams(cookies []*network.Cookie) []*network.CookieParam {
+	params := make([]*network.CookieParam, 0, len(cookies))
+	for _, cookie := range cookies {
+		param := &network.CookieParam{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HTTPOnly: cookie.HTTPOnly,
+			SameSite: cookie.SameSite,
+		}
+		if !cookie.Session {
+			sec, frac := math.Modf(cookie.Expires)
+			expires := cdp.TimeSinceEpoch(time.Unix(int64(sec), int64(frac*1e9)))
+			param.Expires = &expires
+		}
+		params = append(params, param)
+	}
+
+	return params
+}
+
+// restoreSession sets the cookies of the last session of the account in
+// the isolated browser context of the tab. The login is skipped then if
+// the session is still valid.
+func (s *scraper) restoreSession(ctx context.Context) error {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	data, err := account.Cookies(conn, s.account.key, s.account.name)
+	if err != nil || data == nil {
+		return err
+	}
+
+	cookies := []*network.Cookie{}
+	if err := json.Unmarshal(data, &cookies); err != nil {
+		return err
+	}
+
+	log.Debug().
+		Str("method", "restoreSession").
+		Msgf("Restoring %d cookies of account %s", len(cookies), s.account.name)
+
+	return s.runStep(ctx, "restoring the session of account "+s.account.name, network.SetCookies(cookieParams(cookies)))
+}
+
+// saveSession stores the cookies of the tab for the next board of the
+// account.
+func (s *scraper) saveSession(ctx context.Context) error {
+	var cookies []*network.Cookie
+
+	err := s.runStep(ctx, "saving the session of account "+s.account.name, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		cookies, err = network.GetAllCookies().Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cookies)
+	if err != nil {
+		return err
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return account.SaveCookies(conn, s.account.key, s.account.name, data, sessionTTL)
+}
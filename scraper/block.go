@@ -0,0 +1,102 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/metrics"
+)
+
+// DefaultBlockedResources are the resource types not loaded while scraping.
+// The scraper only needs the srcset attributes of the pins, not the preview
+// pictures themselves.
+var DefaultBlockedResources = []string{"image", "media", "font"}
+
+// blockableResources are the resource types that may be blocked. Documents,
+// scripts and XHR requests are needed to render the board.
+var blockableResources = []network.ResourceType{
+	network.ResourceTypeImage,
+	network.ResourceTypeMedia,
+	network.ResourceTypeFont,
+	network.ResourceTypeStylesheet,
+	network.ResourceTypeTextTrack,
+	network.ResourceTypeManifest,
+	network.ResourceTypePing,
+	network.ResourceTypeCSPViolationReport,
+}
+
+// parseResourceTypes returns the resource types for names like "image" or
+// "Image".
+func parseResourceTypes(names []string) ([]network.ResourceType, error) {
+	types := []network.ResourceType{}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for _, t := range blockableResources {
+			if strings.EqualFold(name, t.String()) {
+				types = append(types, t)
+				found = true
+				break
+			}
+		}
+		if !found {
+			valid := make([]string, 0, len(blockableResources))
+			for _, t := range blockableResources {
+				valid = append(valid, strings.ToLower(t.String()))
+			}
+			return nil, fmt.Errorf("Can not block resource type %s. Valid types: %s", name, strings.Join(valid, ", "))
+		}
+	}
+
+	return types, nil
+}
+
+// blockResources aborts all requests of the tab for the given resource
+// types. Nothing is blocked if types is empty.
+func blockResources(tabCtx context.Context, types []network.ResourceType) error {
+	if len(types) == 0 {
+		return nil
+	}
+
+	patterns := make([]*fetch.RequestPattern, 0, len(types))
+	for _, t := range types {
+		patterns = append(patterns, &fetch.RequestPattern{
+			URLPattern:   "*",
+			ResourceType: t,
+			RequestStage: fetch.RequestStageRequest,
+		})
+	}
+
+	// Only requests matching the patterns are paused. So every paused
+	// request is blocked. The listener must not block, hence the
+	// goroutine.
+	chromedp.ListenTarget(tabCtx, func(ev interface{}) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+
+		metrics.RequestsBlocked.WithLabelValues(strings.ToLower(paused.ResourceType.String())).Inc()
+
+		go func() {
+			if err := chromedp.Run(tabCtx, fetch.FailRequest(paused.RequestID, network.ErrorReasonBlockedByClient)); err != nil && tabCtx.Err() == nil {
+				log.Error().
+					Str("method", "blockResources").
+					Msgf("Can not block request %s: %s", paused.Request.URL, err.Error())
+			}
+		}()
+	})
+
+	return chromedp.Run(tabCtx, fetch.Enable().WithPatterns(patterns))
+}
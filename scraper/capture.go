@@ -0,0 +1,403 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/har"
+	cdplog "github.com/chromedp/cdproto/log"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/job"
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+const (
+	// maxConsoleEntries and maxHAREntries bound the memory used for
+	// recording a tab. The oldest entries are dropped first.
+	maxConsoleEntries = 2000
+	maxHAREntries     = 5000
+	// captureTimeout is how long capturing the page may take. The page
+	// may be broken so it must not wait forever.
+	captureTimeout = 30 * time.Second
+	// screenshotQuality is the JPEG quality of screenshots.
+	screenshotQuality = 80
+
+	// DefaultArtifactTTL is how long captured artifacts are kept.
+	DefaultArtifactTTL = 7 * 24 * time.Hour
+
+	// redacted replaces secrets in the HAR artifact.
+	redacted = "[redacted]"
+)
+
+// secretHeaders are the headers masked in the HAR artifact. Artifacts can
+// be downloaded with any token with read scope so sessions must not leak.
+var secretHeaders = map[string]bool{
+	"authorization":       true,
+	"cookie":              true,
+	"proxy-authorization": true,
+	"set-cookie":          true,
+}
+
+// harRequest is a request recorded for the HAR artifact.
+type harRequest struct {
+	id    network.RequestID
+	start time.Time
+	entry *har.Entry
+}
+
+// recorder records console messages and network activity of a tab so
+// they can be stored if scraping fails.
+type recorder struct {
+	mu       sync.Mutex
+	console  []string
+	entries  []*harRequest
+	requests map[network.RequestID]*harRequest
+}
+
+// newRecorder starts recording the tab.
+func newRecorder(tabCtx context.Context) *recorder {
+	r := &recorder{requests: map[network.RequestID]*harRequest{}}
+
+	chromedp.ListenTarget(tabCtx, r.handle)
+
+	return r
+}
+
+// handle records an event of the tab.
+func (r *recorder) handle(ev interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ev := ev.(type) {
+	case *runtime.EventConsoleAPICalled:
+		args := make([]string, 0, len(ev.Args))
+		for _, arg := range ev.Args {
+			args = append(args, remoteObjectString(arg))
+		}
+		r.addConsole(timestampTime(ev.Timestamp), string(ev.Type), strings.Join(args, " "))
+	case *runtime.EventExceptionThrown:
+		details := ev.ExceptionDetails
+		text := details.Text
+		if details.Exception != nil && details.Exception.Description != "" {
+			text = details.Exception.Description
+		}
+		r.addConsole(timestampTime(ev.Timestamp), "exception", fmt.Sprintf("%s (%s:%d)", text, details.URL, details.LineNumber+1))
+	case *cdplog.EventEntryAdded:
+		r.addConsole(timestampTime(ev.Entry.Timestamp), string(ev.Entry.Level), fmt.Sprintf("%s %s", ev.Entry.Text, ev.Entry.URL))
+	case *network.EventRequestWillBeSent:
+		r.requestWillBeSent(ev)
+	case *network.EventResponseReceived:
+		if req, ok := r.requests[ev.RequestID]; ok {
+			setHARResponse(req.entry, ev.Response)
+		}
+	case *network.EventLoadingFinished:
+		if req, ok := r.requests[ev.RequestID]; ok {
+			req.entry.Time = elapsedMillis(req.start, ev.Timestamp)
+			req.entry.Timings.Wait = req.entry.Time
+			req.entry.Response.BodySize = int64(ev.EncodedDataLength)
+			req.entry.Response.Content.Size = int64(ev.EncodedDataLength)
+			delete(r.requests, ev.RequestID)
+		}
+	case *network.EventLoadingFailed:
+		if req, ok := r.requests[ev.RequestID]; ok {
+			req.entry.Time = elapsedMillis(req.start, ev.Timestamp)
+			req.entry.Timings.Wait = req.entry.Time
+			req.entry.Comment = strings.TrimSpace(fmt.Sprintf("%s %s", ev.ErrorText, ev.BlockedReason))
+			delete(r.requests, ev.RequestID)
+		}
+	}
+}
+
+// addConsole appends a console line. r.mu must be held.
+func (r *recorder) addConsole(t time.Time, level string, text string) {
+	r.console = append(r.console, fmt.Sprintf("%s [%s] %s", t.UTC().Format(time.RFC3339Nano), level, text))
+	if len(r.console) > maxConsoleEntries {
+		r.console = r.console[len(r.console)-maxConsoleEntries:]
+	}
+}
+
+// requestWillBeSent starts a new HAR entry. Redirects finish the entry of
+// the previous request with the same ID. r.mu must be held.
+func (r *recorder) requestWillBeSent(ev *network.EventRequestWillBeSent) {
+	if req, ok := r.requests[ev.RequestID]; ok && ev.RedirectResponse != nil {
+		setHARResponse(req.entry, ev.RedirectResponse)
+		req.entry.Time = elapsedMillis(req.start, ev.Timestamp)
+		req.entry.Timings.Wait = req.entry.Time
+	}
+
+	started := time.Now()
+	if ev.WallTime != nil {
+		started = ev.WallTime.Time()
+	}
+	start := started
+	if ev.Timestamp != nil {
+		start = ev.Timestamp.Time()
+	}
+
+	request := &har.Request{
+		Method:      ev.Request.Method,
+		URL:         ev.Request.URL,
+		Cookies:     []*har.Cookie{},
+		Headers:     harHeaders(ev.Request.Headers),
+		QueryString: []*har.NameValuePair{},
+		HeadersSize: -1,
+		BodySize:    int64(len(ev.Request.PostData)),
+	}
+	if u, err := url.Parse(ev.Request.URL); err == nil {
+		for name, values := range u.Query() {
+			for _, value := range values {
+				request.QueryString = append(request.QueryString, &har.NameValuePair{Name: name, Value: value})
+			}
+		}
+	}
+	// Request bodies are never stored. The body of the login request
+	// contains the password.
+	if ev.Request.PostData != "" {
+		request.PostData = &har.PostData{
+			MimeType: headerValue(ev.Request.Headers, "Content-Type"),
+			Params:   []*har.Param{},
+			Text:     redacted,
+		}
+	}
+
+	req := &harRequest{
+		id:    ev.RequestID,
+		start: start,
+		entry: &har.Entry{
+			StartedDateTime: started.UTC().Format(time.RFC3339Nano),
+			Request:         request,
+			Response: &har.Response{
+				Cookies:     []*har.Cookie{},
+				Headers:     []*har.NameValuePair{},
+				Content:     &har.Content{},
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+			Cache:   &har.Cache{},
+			Timings: &har.Timings{},
+		},
+	}
+
+	r.requests[ev.RequestID] = req
+	r.entries = append(r.entries, req)
+	if len(r.entries) > maxHAREntries {
+		for _, dropped := range r.entries[:len(r.entries)-maxHAREntries] {
+			if r.requests[dropped.id] == dropped {
+				delete(r.requests, dropped.id)
+			}
+		}
+		r.entries = r.entries[len(r.entries)-maxHAREntries:]
+	}
+}
+
+// consoleLog returns the recorded console messages one per line.
+func (r *recorder) consoleLog() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return []byte(strings.Join(r.console, "\n") + "\n")
+}
+
+// har returns the recorded network activity in HTTP Archive format.
+func (r *recorder) har() ([]byte, error) {
+	r.mu.Lock()
+	entries := make([]*har.Entry, 0, len(r.entries))
+	for _, req := range r.entries {
+		entries = append(entries, req.entry)
+	}
+	archive := &har.HAR{Log: &har.Log{
+		Version: "1.2",
+		Creator: &har.Creator{Name: "pinbackup"},
+		Entries: entries,
+	}}
+	data, err := json.Marshal(archive)
+	r.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// setHARResponse copies a response to a HAR entry.
+func setHARResponse(entry *har.Entry, resp *network.Response) {
+	entry.Request.HTTPVersion = resp.Protocol
+	entry.ServerIPAddress = resp.RemoteIPAddress
+	entry.Response.Status = resp.Status
+	entry.Response.StatusText = resp.StatusText
+	entry.Response.HTTPVersion = resp.Protocol
+	entry.Response.Headers = harHeaders(resp.Headers)
+	entry.Response.RedirectURL = headerValue(resp.Headers, "Location")
+	entry.Response.Content.MimeType = resp.MimeType
+}
+
+// harHeaders converts DevTools headers to HAR headers sorted by name.
+// The values of secretHeaders are masked.
+func harHeaders(headers network.Headers) []*har.NameValuePair {
+	pairs := []*har.NameValuePair{}
+	for name, value := range headers {
+		pair := &har.NameValuePair{Name: name, Value: fmt.Sprint(value)}
+		if secretHeaders[strings.ToLower(name)] {
+			pair.Value = redacted
+		}
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Name < pairs[j].Name
+	})
+
+	return pairs
+}
+
+// headerValue returns the value of a header regardless of the case of its
+// name.
+func headerValue(headers network.Headers, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return fmt.Sprint(value)
+		}
+	}
+
+	return ""
+}
+
+// remoteObjectString returns a console argument as text. Strings are
+// returned without quotes.
+func remoteObjectString(obj *runtime.RemoteObject) string {
+	if len(obj.Value) > 0 {
+		var s string
+		if err := json.Unmarshal(obj.Value, &s); err == nil {
+			return s
+		}
+		return string(obj.Value)
+	}
+	if obj.UnserializableValue != "" {
+		return obj.UnserializableValue.String()
+	}
+
+	return obj.Description
+}
+
+// timestampTime returns the time of a DevTools timestamp or now if it's
+// missing.
+func timestampTime(t *runtime.Timestamp) time.Time {
+	if t == nil {
+		return time.Now()
+	}
+
+	return t.Time()
+}
+
+// elapsedMillis returns the milliseconds between start and the monotonic
+// DevTools timestamp end.
+func elapsedMillis(start time.Time, end *cdp.MonotonicTime) float64 {
+	if end == nil {
+		return 0
+	}
+
+	return float64(end.Time().Sub(start)) / float64(time.Millisecond)
+}
+
+// captureArtifacts stores a full page screenshot and the DOM of the tab as
+// artifacts of the job. The names are prefixed with prefix. The recorded
+// console messages and network activity are stored too if the tab was
+// recorded. Errors are only logged as capturing is best effort.
+func (s *scraper) captureArtifacts(tabCtx context.Context, uuid string, prefix string) {
+	if tabCtx.Err() != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(tabCtx, captureTimeout)
+	defer cancel()
+
+	artifacts := map[string][]byte{}
+
+	var screenshot []byte
+	if err := chromedp.Run(ctx, chromedp.FullScreenshot(&screenshot, screenshotQuality)); err != nil || len(screenshot) > job.MaxArtifactSize {
+		// Very long pages exceed the limits of full page screenshots.
+		// The visible part is better than nothing.
+		screenshot = nil
+		if err := chromedp.Run(ctx, chromedp.CaptureScreenshot(&screenshot)); err != nil {
+			log.Error().
+				Str("method", "captureArtifacts").
+				Msgf("Can not take screenshot for job %s: %s", uuid, err.Error())
+		}
+	}
+	if len(screenshot) > 0 {
+		name := prefix + "screenshot.jpg"
+		if bytes.HasPrefix(screenshot, []byte("\x89PNG")) {
+			name = prefix + "screenshot.png"
+		}
+		artifacts[name] = screenshot
+	}
+
+	var dom string
+	if err := chromedp.Run(ctx, chromedp.Evaluate(`document.documentElement.outerHTML`, &dom)); err != nil {
+		log.Error().
+			Str("method", "captureArtifacts").
+			Msgf("Can not get DOM for job %s: %s", uuid, err.Error())
+	} else {
+		artifacts[prefix+"dom.html"] = []byte(dom)
+	}
+
+	if s.recorder != nil {
+		artifacts["console.log"] = s.recorder.consoleLog()
+		if data, err := s.recorder.har(); err != nil {
+			log.Error().
+				Str("method", "captureArtifacts").
+				Msgf("Can not create HAR for job %s: %s", uuid, err.Error())
+		} else {
+			artifacts["network.har"] = data
+		}
+	}
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		log.Error().
+			Str("method", "captureArtifacts").
+			Msgf("Can not store artifacts of job %s: %s", uuid, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	for name, data := range artifacts {
+		if err := job.SaveArtifact(conn, uuid, name, data, s.config.ArtifactTTL); err != nil {
+			log.Error().
+				Str("method", "captureArtifacts").
+				Msgf("Can not store artifact %s of job %s: %s", name, uuid, err.Error())
+			continue
+		}
+
+		log.Debug().
+			Str("method", "captureArtifacts").
+			Msgf("Stored artifact %s of job %s (%d bytes)", name, uuid, len(data))
+	}
+}
+
+// captureStep stores artifacts after a scraping step if steps are captured.
+func (s *scraper) captureStep(tabCtx context.Context, uuid string, step string) {
+	if !s.config.CaptureSteps {
+		return
+	}
+
+	s.steps++
+	s.captureArtifacts(tabCtx, uuid, fmt.Sprintf("step-%02d-%s-", s.steps, step))
+}
@@ -0,0 +1,92 @@
+package scraper
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/har"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/runtime"
+)
+
+func TestRecorder(t *testing.T) {
+	r := &recorder{requests: map[network.RequestID]*harRequest{}}
+
+	start := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	wallTime := cdp.TimeSinceEpoch(start)
+	sent := cdp.MonotonicTime(start)
+	finished := cdp.MonotonicTime(start.Add(250 * time.Millisecond))
+
+	r.handle(&network.EventRequestWillBeSent{
+		RequestID: "1",
+		Request: &network.Request{
+			Method:  "GET",
+			URL:     "https://www.pinterest.com/user1/board/?page=2",
+			Headers: network.Headers{"Accept": "text/html"},
+		},
+		Timestamp: &sent,
+		WallTime:  &wallTime,
+	})
+	r.handle(&network.EventResponseReceived{
+		RequestID: "1",
+		Response: &network.Response{
+			Status:     200,
+			StatusText: "OK",
+			Protocol:   "h2",
+			MimeType:   "text/html",
+			Headers:    network.Headers{"Content-Type": "text/html"},
+		},
+	})
+	r.handle(&network.EventLoadingFinished{RequestID: "1", Timestamp: &finished, EncodedDataLength: 1024})
+
+	r.handle(&network.EventRequestWillBeSent{
+		RequestID: "2",
+		Request:   &network.Request{Method: "GET", URL: "https://i.pinimg.com/236x/1.jpg"},
+		Timestamp: &sent,
+	})
+	r.handle(&network.EventLoadingFailed{RequestID: "2", Timestamp: &finished, ErrorText: "net::ERR_BLOCKED_BY_CLIENT"})
+
+	timestamp := runtime.Timestamp(start)
+	r.handle(&runtime.EventConsoleAPICalled{
+		Type:      runtime.APITypeError,
+		Args:      []*runtime.RemoteObject{{Type: runtime.TypeString, Value: []byte(`"Failed to load"`)}, {Type: runtime.TypeNumber, Value: []byte(`42`)}},
+		Timestamp: &timestamp,
+	})
+
+	if len(r.requests) != 0 {
+		t.Errorf("Got %d requests in flight / Expected: 0", len(r.requests))
+	}
+
+	console := string(r.consoleLog())
+	if expected := "2021-08-01T12:00:00Z [error] Failed to load 42\n"; console != expected {
+		t.Errorf("Got: %q / Expected: %q", console, expected)
+	}
+
+	data, err := r.har()
+	if err != nil {
+		t.Fatalf("Got error: %s / Expected: no error", err)
+	}
+
+	archive := har.HAR{}
+	if err := json.Unmarshal(data, &archive); err != nil {
+		t.Fatalf("Got error: %s / Expected: valid HAR", err)
+	}
+	if len(archive.Log.Entries) != 2 {
+		t.Fatalf("Got %d entries / Expected: 2", len(archive.Log.Entries))
+	}
+
+	entry := archive.Log.Entries[0]
+	if entry.Response.Status != 200 || entry.Response.BodySize != 1024 || entry.Time != 250 || entry.Request.HTTPVersion != "h2" {
+		t.Errorf("Got: status %d, size %d, time %f, version %s / Expected: status 200, size 1024, time 250, version h2",
+			entry.Response.Status, entry.Response.BodySize, entry.Time, entry.Request.HTTPVersion)
+	}
+	if len(entry.Request.QueryString) != 1 || entry.Request.QueryString[0].Name != "page" {
+		t.Errorf("Got: %v / Expected: query parameter page", entry.Request.QueryString)
+	}
+	if !strings.Contains(archive.Log.Entries[1].Comment, "ERR_BLOCKED_BY_CLIENT") {
+		t.Errorf("Got comment: %s / Expected: ERR_BLOCKED_BY_CLIENT", archive.Log.Entries[1].Comment)
+	}
+}
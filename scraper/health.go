@@ -0,0 +1,101 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+
+	"github.com/chromedp/chromedp"
+
+	"github.com/githubixx/pinbackup/board"
+	"github.com/githubixx/pinbackup/health"
+)
+
+// doctorHost is the Pinterest host used to verify the login credentials.
+const doctorHost = "www.pinterest.com"
+
+// loginState stores the outcome of the latest login of the scraper.
+type loginState struct {
+	sync.Mutex
+	err error
+}
+
+var lastLogin = &loginState{}
+
+// set stores the outcome of a login. err is nil if the login succeeded.
+func (l *loginState) set(err error) {
+	l.Lock()
+	defer l.Unlock()
+	l.err = err
+}
+
+// get returns the error of the latest login or nil if the latest login
+// succeeded or no login happened so far.
+func (l *loginState) get() error {
+	l.Lock()
+	defer l.Unlock()
+	return l.err
+}
+
+// HealthChecks returns the checks used for the readiness probe of the
+// scraper: Redis, Chrome DevTools reachability and the state of the latest
+// Pinterest login.
+func HealthChecks(config *Config) []health.Check {
+	s := &scraper{config: config}
+
+	return []health.Check{
+		health.Redis(),
+		s.chromeCheck(),
+		{
+			Name: "pinterest-login",
+			Hint: "The latest login failed. Verify --login-name and --login-password or check if Pinterest changed the login form.",
+			Run: func(ctx context.Context) error {
+				return lastLogin.get()
+			},
+		},
+	}
+}
+
+// DoctorChecks returns the checks used by the doctor command. Contrary to
+// HealthChecks the Pinterest login is actually performed in a new browser
+// tab if a login name is configured.
+func DoctorChecks(config *Config) []health.Check {
+	s := &scraper{config: config}
+
+	checks := []health.Check{s.chromeCheck()}
+
+	if config.LoginName != "" {
+		checks = append(checks, health.Check{
+			Name: "pinterest-login",
+			Hint: "Verify --login-name and --login-password. Google, Facebook, ... logins are not supported.",
+			Run: func(ctx context.Context) error {
+				chromeWsDebugURL, err := firstDevToolsURL(ctx, parseEndpoints(config.ChromeWsDebuggerHost))
+				if err != nil {
+					return err
+				}
+
+				bctx, cancelBctx := chromedp.NewRemoteAllocator(ctx, chromeWsDebugURL)
+				defer cancelBctx()
+
+				tctx, cancelTctx := chromedp.NewContext(bctx)
+				defer cancelTctx()
+
+				return s.login(tctx, &board.Board{Host: doctorHost})
+			},
+		})
+	}
+
+	return checks
+}
+
+// chromeCheck verifies that at least one Chrome DevTools endpoint is
+// reachable. The scraper can still work with fewer browsers.
+func (s *scraper) chromeCheck() health.Check {
+	return health.Check{
+		Name: "chrome-devtools",
+		Hint: "Verify that headless Chrome is running with --remote-debugging-address=0.0.0.0 --remote-debugging-port=9222 and that --chrome-ws-debugger-host resolves to it.",
+		Run: func(ctx context.Context) error {
+			_, err := firstDevToolsURL(ctx, parseEndpoints(s.config.ChromeWsDebuggerHost))
+			return err
+		},
+	}
+}
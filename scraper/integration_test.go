@@ -0,0 +1,560 @@
+package scraper
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+
+	"github.com/githubixx/pinbackup/board"
+	"github.com/githubixx/pinbackup/pinteresttest"
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// chromeCandidates are the executables tried if PINBACKUP_TEST_CHROME
+// isn't set.
+var chromeCandidates = []string{
+	"headless-shell",
+	"chromium",
+	"chromium-browser",
+	"google-chrome",
+	"google-chrome-stable",
+}
+
+// memorySink keeps the pictures found in memory instead of publishing
+// them to Redis.
+type memorySink struct {
+	pictures []Picture
+	counts   []int
+	meta     *redisClient.BoardMeta
+	boards   []string
+}
+
+func (m *memorySink) add(picture Picture) error {
+	m.pictures = append(m.pictures, picture)
+	return nil
+}
+
+func (m *memorySink) discovered(count int) {
+	m.counts = append(m.counts, count)
+}
+
+func (m *memorySink) metadata(meta *redisClient.BoardMeta) error {
+	m.meta = meta
+	return nil
+}
+
+func (m *memorySink) found(user string, path string) error {
+	m.boards = append(m.boards, user+"/"+path)
+	return nil
+}
+
+func (m *memorySink) urls() []string {
+	urls := []string{}
+	for _, picture := range m.pictures {
+		urls = append(urls, picture.Url)
+	}
+	sort.Strings(urls)
+
+	return urls
+}
+
+// chromePath returns a local Chrome or skips the test.
+func chromePath(t *testing.T) string {
+	if testing.Short() {
+		t.Skip("Skipping Chrome test in short mode")
+	}
+
+	if path := os.Getenv("PINBACKUP_TEST_CHROME"); path != "" {
+		return path
+	}
+
+	for _, name := range chromeCandidates {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+
+	t.Skip("No Chrome found. Set PINBACKUP_TEST_CHROME to run the test")
+	return ""
+}
+
+// newTestTab starts a headless Chrome and returns a tab. It's closed when
+// the test ends.
+func newTestTab(t *testing.T) context.Context {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.ExecPath(chromePath(t)),
+		chromedp.NoSandbox,
+	)
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), opts...)
+	tabCtx, cancelTab := chromedp.NewContext(allocCtx)
+	t.Cleanup(func() {
+		cancelTab()
+		cancelAlloc()
+	})
+
+	if err := chromedp.Run(tabCtx); err != nil {
+		t.Fatalf("Can not start Chrome: %s", err)
+	}
+
+	blocked, err := parseResourceTypes(DefaultBlockedResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake pins link to the real Pinterest CDN.
+	if err := blockResources(tabCtx, blocked); err != nil {
+		t.Fatal(err)
+	}
+
+	return tabCtx
+}
+
+// newTestScraper returns a scraper for the fake site. The delays meant for
+// the real site are shortened for the test.
+func newTestScraper(t *testing.T, site *pinteresttest.Server) (*scraper, *memorySink) {
+	delays := []*time.Duration{&loginFormDelay, &loginSubmitDelay, &scrollDelay}
+	saved := []time.Duration{}
+	for _, delay := range delays {
+		saved = append(saved, *delay)
+		*delay = 200 * time.Millisecond
+	}
+	t.Cleanup(func() {
+		for i, delay := range delays {
+			*delay = saved[i]
+		}
+	})
+
+	sink := &memorySink{}
+	s := &scraper{
+		config: &Config{
+			LoginName:     site.Email,
+			LoginPassword: site.Password,
+			StepTimeout:   5 * time.Second,
+			StallScrolls:  3,
+			Scheme:        "http",
+		},
+		sink: sink,
+	}
+
+	return s, sink
+}
+
+func testBoard(site *pinteresttest.Server, user string, path string) *board.Board {
+	return &board.Board{
+		Host: site.Host(),
+		User: user,
+		Path: path,
+		UUID: "00000000-0000-0000-0000-000000000000",
+	}
+}
+
+func TestScrapeFakeBoard(t *testing.T) {
+	var scrapeTests = []struct {
+		name     string
+		pins     int
+		pageSize int
+		window   int
+	}{
+		{"single page", 10, 25, 0},
+		{"several pages", 60, 25, 0},
+		{"partial last page", 53, 10, 0},
+		{"pins removed while scrolling", 80, 20, 30},
+	}
+
+	tabCtx := newTestTab(t)
+
+	for _, test := range scrapeTests {
+		site := pinteresttest.NewServer()
+		site.PageSize = test.pageSize
+		site.Window = test.window
+		site.AddBoard(pinteresttest.Board{User: "pinner", Path: "recipes", Pins: test.pins})
+
+		s, sink := newTestScraper(t, site)
+		b := testBoard(site, "pinner", "recipes")
+
+		err := s.openURL(tabCtx, b)
+		if err == nil {
+			err = s.scrape(tabCtx, b)
+		}
+		site.Close()
+
+		if err != nil {
+			t.Errorf("%s: Got: %s / Expected: no error", test.name, err)
+			continue
+		}
+
+		expected := site.Media("pinner", "recipes")
+		sort.Strings(expected)
+		if !reflect.DeepEqual(sink.urls(), expected) {
+			t.Errorf("%s: Got: %d pictures / Expected: %d", test.name, len(sink.pictures), len(expected))
+		}
+
+		for _, picture := range sink.pictures {
+			if picture.Host != b.Host || picture.User != b.User || picture.Path != b.Path || picture.UUID != b.UUID {
+				t.Errorf("%s: Got: %+v / Expected: picture of board %+v", test.name, picture, b)
+				break
+			}
+		}
+
+		if n := len(sink.counts); n == 0 || sink.counts[n-1] != test.pins {
+			t.Errorf("%s: Got: discovered counts %v / Expected: last %d", test.name, sink.counts, test.pins)
+		}
+	}
+}
+
+func TestScrapeFakeSection(t *testing.T) {
+	tabCtx := newTestTab(t)
+
+	site := pinteresttest.NewServer()
+	defer site.Close()
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "recipes", Pins: 30})
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "recipes/desserts", Pins: 12})
+
+	s, sink := newTestScraper(t, site)
+	b := testBoard(site, "pinner", "recipes/desserts")
+
+	if err := s.openURL(tabCtx, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.scrape(tabCtx, b); err != nil {
+		t.Fatalf("Got: %s / Expected: no error", err)
+	}
+
+	expected := site.Media("pinner", "recipes/desserts")
+	sort.Strings(expected)
+	if !reflect.DeepEqual(sink.urls(), expected) {
+		t.Errorf("Got: %v / Expected: %v", sink.urls(), expected)
+	}
+}
+
+func TestScrapeFakeBoardMeta(t *testing.T) {
+	tabCtx := newTestTab(t)
+
+	site := pinteresttest.NewServer()
+	defer site.Close()
+	recipes := pinteresttest.Board{
+		User:          "pinner",
+		Path:          "recipes",
+		Pins:          5,
+		Title:         "My Recipes",
+		Description:   "Things to cook",
+		Category:      "food_drink",
+		Collaborators: []string{"carol", "alice"},
+		Secret:        true,
+	}
+	site.AddBoard(recipes)
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "recipes/desserts", Pins: 2})
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "recipes/cakes", Pins: 2})
+
+	s, sink := newTestScraper(t, site)
+	b := testBoard(site, "pinner", "recipes")
+
+	if err := s.openURL(tabCtx, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.scrape(tabCtx, b); err != nil {
+		t.Fatalf("Got: %s / Expected: no error", err)
+	}
+
+	if sink.meta == nil {
+		t.Fatalf("Got: no metadata / Expected: metadata of board")
+	}
+	meta := *sink.meta
+	meta.Scraped = 0
+	expected := redisClient.BoardMeta{
+		Title:         "My Recipes",
+		Description:   "Things to cook",
+		Category:      "food_drink",
+		Privacy:       "secret",
+		Cover:         pinteresttest.Cover(recipes),
+		Collaborators: []string{"alice", "carol"},
+		Sections:      []string{"recipes/cakes", "recipes/desserts"},
+	}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Errorf("Got: %+v / Expected: %+v", meta, expected)
+	}
+}
+
+func TestResolveFakeBoards(t *testing.T) {
+	tabCtx := newTestTab(t)
+
+	site := pinteresttest.NewServer()
+	defer site.Close()
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "recipes", Pins: 1})
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "recipes/desserts", Pins: 1})
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "travel", Pins: 1})
+	site.AddBoard(pinteresttest.Board{User: "other", Path: "cars", Pins: 1})
+	site.Follow("pinner", "other/cars", "third/bikes")
+
+	var resolveTests = []struct {
+		path   string
+		source string
+		boards []string
+	}{
+		{"_saved", board.SourceSaved, []string{"pinner/recipes", "pinner/travel"}},
+		{"following", board.SourceFollowing, []string{"other/cars", "third/bikes"}},
+	}
+
+	for _, test := range resolveTests {
+		s, sink := newTestScraper(t, site)
+		b := testBoard(site, "pinner", test.path)
+		b.Source = test.source
+
+		if err := s.openURL(tabCtx, b); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.resolveBoards(tabCtx, b); err != nil {
+			t.Fatalf("%s: Got: %s / Expected: no error", test.path, err)
+		}
+
+		sort.Strings(sink.boards)
+		if !reflect.DeepEqual(sink.boards, test.boards) {
+			t.Errorf("%s: Got: %v / Expected: %v", test.path, sink.boards, test.boards)
+		}
+		if len(sink.pictures) != 0 {
+			t.Errorf("%s: Got: %d pictures / Expected: none", test.path, len(sink.pictures))
+		}
+	}
+}
+
+func TestScrapeFakeMediaKinds(t *testing.T) {
+	tabCtx := newTestTab(t)
+
+	site := pinteresttest.NewServer()
+	defer site.Close()
+	site.PageSize = 10
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "mixed", Pins: 30, Videos: 3, GIFs: 2, IdeaPins: 2, IdeaPages: 4})
+
+	s, sink := newTestScraper(t, site)
+	b := testBoard(site, "pinner", "mixed")
+
+	if err := s.openURL(tabCtx, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.scrape(tabCtx, b); err != nil {
+		t.Fatalf("Got: %s / Expected: no error", err)
+	}
+
+	expected := site.Media("pinner", "mixed")
+	sort.Strings(expected)
+	if !reflect.DeepEqual(sink.urls(), expected) {
+		t.Errorf("Got: %d files / Expected: %d", len(sink.pictures), len(expected))
+	}
+
+	kinds := map[string]int{}
+	for _, picture := range sink.pictures {
+		kinds[picture.Kind]++
+	}
+	// 23 pictures and 4 pages of 2 idea pins
+	expectedKinds := map[string]int{KindHLS: 3, KindGIF: 2, KindImage: 31}
+	if !reflect.DeepEqual(kinds, expectedKinds) {
+		t.Errorf("Got: %v / Expected: %v", kinds, expectedKinds)
+	}
+
+	// Idea pins count as one pin each.
+	if n := len(sink.counts); n == 0 || sink.counts[n-1] != 30 {
+		t.Errorf("Got: discovered counts %v / Expected: last %d", sink.counts, 30)
+	}
+}
+
+func TestLoginFake(t *testing.T) {
+	tabCtx := newTestTab(t)
+
+	site := pinteresttest.NewServer()
+	defer site.Close()
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "secret", Pins: 5, Private: true})
+
+	s, sink := newTestScraper(t, site)
+	b := testBoard(site, "pinner", "secret")
+
+	s.config.LoginPassword = "wrong"
+	err := s.login(tabCtx, b)
+	if err == nil || !strings.Contains(err.Error(), "Login failed") {
+		t.Errorf("Got: %v / Expected: Login failed", err)
+	}
+
+	s.config.LoginPassword = site.Password
+	if err := s.login(tabCtx, b); err != nil {
+		t.Fatalf("Got: %s / Expected: no error", err)
+	}
+	// The cookie of the first login is reused.
+	if err := s.login(tabCtx, b); err != nil {
+		t.Fatalf("Got: %s / Expected: no error", err)
+	}
+	if site.Logins() != 1 {
+		t.Errorf("Got: %d logins / Expected: %d", site.Logins(), 1)
+	}
+
+	if err := s.openURL(tabCtx, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.scrape(tabCtx, b); err != nil {
+		t.Fatalf("Got: %s / Expected: no error", err)
+	}
+	if len(sink.pictures) != 5 {
+		t.Errorf("Got: %d pictures of private board / Expected: %d", len(sink.pictures), 5)
+	}
+}
+
+func TestLoginFakeHARRedacted(t *testing.T) {
+	tabCtx := newTestTab(t)
+
+	site := pinteresttest.NewServer()
+	defer site.Close()
+	site.Password = "correct-horse-battery-staple"
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "secret", Pins: 5, Private: true})
+
+	s, _ := newTestScraper(t, site)
+	s.config.LoginPassword = site.Password
+	s.recorder = newRecorder(tabCtx)
+
+	if err := s.login(tabCtx, testBoard(site, "pinner", "secret")); err != nil {
+		t.Fatalf("Got: %s / Expected: no error", err)
+	}
+
+	data, err := s.recorder.har()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "/login/") {
+		t.Error("Got: no login request / Expected: login recorded in HAR")
+	}
+	if strings.Contains(string(data), site.Password) {
+		t.Error("Got: password in HAR / Expected: redacted")
+	}
+}
+
+// hasAuthCookie returns true if the tab is logged in to the fake site.
+func hasAuthCookie(t *testing.T, tabCtx context.Context) bool {
+	var cookies []*network.Cookie
+	err := chromedp.Run(tabCtx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		cookies, err = network.GetAllCookies().Do(ctx)
+		return err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cookie := range cookies {
+		if cookie.Name == "_auth" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestLoginFakeAccounts(t *testing.T) {
+	browserCtx := newTestTab(t)
+
+	site := pinteresttest.NewServer()
+	defer site.Close()
+	site.AddBoard(pinteresttest.Board{User: "pinner", Path: "secret", Pins: 5, Private: true})
+
+	s, _ := newTestScraper(t, site)
+	b := testBoard(site, "pinner", "secret")
+
+	// Only the credentials of the account are valid.
+	s.config.LoginPassword = "wrong"
+	s.account = &loginAccount{name: "alice", email: site.Email, password: site.Password}
+
+	var tabs []context.Context
+	for i := 0; i < 2; i++ {
+		tabCtx, cancel, id, err := newTab(browserCtx, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer disposeBrowserContext(browserCtx, id)
+		defer cancel()
+		if err := chromedp.Run(tabCtx); err != nil {
+			t.Fatal(err)
+		}
+		tabs = append(tabs, tabCtx)
+	}
+
+	if err := s.login(tabs[0], b); err != nil {
+		t.Fatalf("Got: %s / Expected: no error", err)
+	}
+
+	var isolationTests = []struct {
+		name     string
+		tabCtx   context.Context
+		loggedIn bool
+	}{
+		{"tab of account", tabs[0], true},
+		{"isolated tab", tabs[1], false},
+		{"default tab", browserCtx, false},
+	}
+	for _, test := range isolationTests {
+		if loggedIn := hasAuthCookie(t, test.tabCtx); loggedIn != test.loggedIn {
+			t.Errorf("%s: Got: logged in %t / Expected: %t", test.name, loggedIn, test.loggedIn)
+		}
+	}
+}
+
+func TestScrapeFakeFailures(t *testing.T) {
+	var failureTests = []struct {
+		name    string
+		board   pinteresttest.Board
+		path    string
+		maxPins int
+		// err is part of the expected error. Empty expects success.
+		err string
+		// pictures is the number of pictures expected to be found.
+		pictures int
+	}{
+		{"captcha", pinteresttest.Board{Pins: 10, Failure: pinteresttest.FailureCaptcha}, "", 0, "waiting for pins", 0},
+		{"server error", pinteresttest.Board{Pins: 10, Failure: pinteresttest.FailureServerError}, "", 0, "waiting for pins", 0},
+		{"changed layout", pinteresttest.Board{Pins: 10, Failure: pinteresttest.FailureNoOriginals}, "", 0, "waiting for pins", 0},
+		{"private", pinteresttest.Board{Pins: 10, Private: true}, "", 0, "waiting for pins", 0},
+		{"missing", pinteresttest.Board{Pins: 10}, "missing", 0, "waiting for pins", 0},
+		{"too many pins", pinteresttest.Board{Pins: 40}, "", 15, "Stopped after 15 pins", 15},
+		// A feed that stops responding looks like the end of the board.
+		{"feed error", pinteresttest.Board{Pins: 40, Failure: pinteresttest.FailureFeedError}, "", 0, "", pinteresttest.DefaultPageSize},
+	}
+
+	tabCtx := newTestTab(t)
+
+	for _, test := range failureTests {
+		site := pinteresttest.NewServer()
+		test.board.User = "pinner"
+		test.board.Path = "recipes"
+		site.AddBoard(test.board)
+
+		path := test.path
+		if path == "" {
+			path = test.board.Path
+		}
+
+		s, sink := newTestScraper(t, site)
+		s.config.StepTimeout = 3 * time.Second
+		s.config.MaxPins = test.maxPins
+		b := testBoard(site, "pinner", path)
+
+		err := s.openURL(tabCtx, b)
+		if err == nil {
+			err = s.scrape(tabCtx, b)
+		}
+		site.Close()
+
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: Got: %s / Expected: no error", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: Got: %v / Expected: error containing %q", test.name, err, test.err)
+		}
+
+		if len(sink.pictures) != test.pictures {
+			t.Errorf("%s: Got: %d pictures / Expected: %d", test.name, len(sink.pictures), test.pictures)
+		}
+	}
+}
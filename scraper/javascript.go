@@ -6,13 +6,47 @@ import (
 )
 
 const (
+	// jsDescribePin returns what a pin reveals about its media. container is
+	// the element of the pin and img its preview picture. See pinPreview.
+	jsDescribePin string = `
+function describePin(container, img) {
+	var videos = [];
+	container.querySelectorAll('video, video source').forEach(function(video) {
+		if (video.src) {
+			videos.push(video.src);
+		}
+	});
+	var link = img ? img.closest('a[href*="/pin/"]') : null;
+	if (!link) {
+		link = container.querySelector('a[href*="/pin/"]');
+	}
+	return {
+		srcset: img ? img.srcset : "",
+		src: img ? img.src : "",
+		videos: videos,
+		link: link ? link.href : "",
+		pages: container.querySelector('[data-test-id="story-pin-indicator"], [data-test-id="pinrep-story-pin-indicator"]') !== null
+	};
+}
+`
+
 	// This code selects the last pin and brings it to the visible part of the
 	// browser window. This causes the page to load further pin's.
 	tplJsScrollIntoView string = `
-var allCurrentPreviewPictures = document.querySelectorAll('{{.SelectorPreviewPins}}');
+{{.DescribePin}}
+var allCurrentPreviewPictures = document.querySelectorAll('{{js .SelectorPreviewPins}}');
 var lastPicture = allCurrentPreviewPictures[allCurrentPreviewPictures.length - 1];
 lastPicture.scrollIntoView(true);
-[].map.call(allCurrentPreviewPictures,img => (img.srcset));
+[].map.call(allCurrentPreviewPictures, img => describePin(img.closest('[data-test-id="pin"], [data-test-id="pinWrapper"], [data-grid-item], [role="listitem"]') || img.parentElement, img));
+`
+
+	// jsIdeaPinPages returns the pages of the idea pin shown on the page.
+	jsIdeaPinPages string = `
+(function() {
+` + jsDescribePin + `
+	var pages = document.querySelectorAll('[data-test-id="story-pin-page"], [data-test-id="idea-pin-page"]');
+	return [].map.call(pages, page => describePin(page, page.querySelector('img')));
+})()
 `
 )
 
@@ -28,8 +62,10 @@ func renderJsScrollIntoView(selectorPreviewPins string) func() string {
 
 			data := struct {
 				SelectorPreviewPins string
+				DescribePin         string
 			}{
 				SelectorPreviewPins: selectorPreviewPins,
+				DescribePin:         jsDescribePin,
 			}
 
 			tpl := template.Must(template.New("jsScrollIntoView").Parse(tplJsScrollIntoView))
@@ -0,0 +1,43 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	// DefaultStepTimeout is how long a single browser step e.g. loading
+	// the board or scrolling may take.
+	DefaultStepTimeout = 2 * time.Minute
+	// DefaultBoardTimeout is how long scraping a board may take including
+	// the login.
+	DefaultBoardTimeout = 2 * time.Hour
+	// DefaultStallScrolls is the number of scrolls without new pins after
+	// which the end of the board is assumed.
+	DefaultStallScrolls = 3
+	// DefaultMaxScrolls guards against boards that never end e.g. because
+	// Pinterest shows recommendations below the pins.
+	DefaultMaxScrolls = 10000
+)
+
+// runStep runs the actions with the step timeout of the configuration. If
+// the timeout expires the error tells which step took too long.
+func (s *scraper) runStep(ctx context.Context, step string, actions ...chromedp.Action) error {
+	timeout := s.config.StepTimeout
+	if timeout <= 0 {
+		return chromedp.Run(ctx, actions...)
+	}
+
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := chromedp.Run(stepCtx, actions...)
+	if err != nil && ctx.Err() == nil && stepCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Timed out after %s %s", timeout, step)
+	}
+
+	return err
+}
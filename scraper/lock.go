@@ -0,0 +1,176 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/board"
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+const (
+	// boardLockTTL is how long the lock of a board survives a scraper that
+	// died without releasing it.
+	boardLockTTL = 30 * time.Second
+	// boardLockRefresh is how often the scraper extends the lock while it
+	// works a board.
+	boardLockRefresh = 10 * time.Second
+)
+
+// boardLock is the lock a scraper holds while working a board so that no
+// other scraper works the same board concurrently. The owner of the lock is
+// the UUID of the job.
+type boardLock struct {
+	key   string
+	owner string
+	done  chan struct{}
+	wg    sync.WaitGroup
+
+	mu   sync.Mutex
+	lost bool
+}
+
+// errLockHeld is returned by lockBoard if the lock of the board is held by
+// the job holder.
+type errLockHeld struct {
+	holder string
+}
+
+func (e errLockHeld) Error() string {
+	return fmt.Sprintf("Board is already being scraped by job %s", e.holder)
+}
+
+// lockBoard acquires the lock of a board and refreshes it in the background
+// until release is called. If the lock can't be refreshed cancel is called
+// to abort the scrape.
+func lockBoard(b *board.Board, cancel context.CancelFunc) (*boardLock, error) {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	l := &boardLock{
+		key:   redisClient.BoardLockKey(b.User, b.Path),
+		owner: b.UUID,
+		done:  make(chan struct{}),
+	}
+
+	acquired, holder, err := redisClient.AcquireLock(conn, l.key, l.owner, boardLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, errLockHeld{holder}
+	}
+
+	l.wg.Add(1)
+	go l.refresh(cancel)
+
+	return l, nil
+}
+
+// lockFailed logs why the lock of board b couldn't be acquired and returns
+// the error message the job of b fails with. It's empty if the lock is
+// held by a job. The job hash is only updated by the scraper holding the
+// lock then. The holder is the job itself if it was delivered twice.
+func lockFailed(b *board.Board, err error) string {
+	held, ok := err.(errLockHeld)
+	if !ok {
+		log.Error().
+			Str("method", "lockFailed").
+			Msgf("Can not lock board %s:%s: %s", b.User, b.Path, err.Error())
+		return err.Error()
+	}
+
+	if held.holder == b.UUID {
+		log.Debug().
+			Str("method", "lockFailed").
+			Msgf("Job %s of board %s:%s is already being scraped", b.UUID, b.User, b.Path)
+		return ""
+	}
+
+	log.Warn().
+		Str("method", "lockFailed").
+		Msgf("Skipping job %s: board %s:%s is already being scraped by job %s", b.UUID, b.User, b.Path, held.holder)
+	return ""
+}
+
+// refresh extends the TTL of the lock until the lock is released.
+func (l *boardLock) refresh(cancel context.CancelFunc) {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(boardLockRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		conn, err := redisClient.GetConnection()
+		if err != nil {
+			log.Error().
+				Str("method", "refresh").
+				Msgf("Can not refresh lock %s: %s", l.key, err.Error())
+			continue
+		}
+		refreshed, err := redisClient.RefreshLock(conn, l.key, l.owner, boardLockTTL)
+		conn.Close()
+
+		if err != nil {
+			// Redis may only be unavailable for a moment. The lock is lost
+			// for sure only if it isn't refreshed within its TTL.
+			log.Error().
+				Str("method", "refresh").
+				Msgf("Can not refresh lock %s: %s", l.key, err.Error())
+			continue
+		}
+		if !refreshed {
+			log.Error().
+				Str("method", "refresh").
+				Msgf("Lost lock %s of job %s", l.key, l.owner)
+			l.mu.Lock()
+			l.lost = true
+			l.mu.Unlock()
+			cancel()
+			return
+		}
+	}
+}
+
+// isLost returns true if the lock expired or was taken by somebody else
+// while it was held.
+func (l *boardLock) isLost() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.lost
+}
+
+// release stops refreshing and deletes the lock if it's still held.
+func (l *boardLock) release() {
+	close(l.done)
+	l.wg.Wait()
+
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		log.Error().
+			Str("method", "release").
+			Msgf("Can not release lock %s: %s", l.key, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	if err := redisClient.ReleaseLock(conn, l.key, l.owner); err != nil {
+		log.Error().
+			Str("method", "release").
+			Msgf("Can not release lock %s: %s", l.key, err.Error())
+	}
+}
@@ -0,0 +1,29 @@
+package scraper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/githubixx/pinbackup/board"
+)
+
+func TestLockFailed(t *testing.T) {
+	b := &board.Board{UUID: "job1", User: "pinner", Path: "recipes"}
+
+	var lockTests = []struct {
+		err     error
+		message string
+	}{
+		// The job itself was delivered twice.
+		{errLockHeld{"job1"}, ""},
+		// The job of the other scraper owns the board.
+		{errLockHeld{"job2"}, ""},
+		{errors.New("connection refused"), "connection refused"},
+	}
+
+	for _, test := range lockTests {
+		if message := lockFailed(b, test.err); message != test.message {
+			t.Errorf("%v: Got: %q / Expected: %q", test.err, message, test.message)
+		}
+	}
+}
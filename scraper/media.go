@@ -0,0 +1,167 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/board"
+)
+
+// Kinds of media a picture handed over to the downloader can be.
+const (
+	KindImage = "image"
+	KindGIF   = "gif"
+	// KindVideo is a MP4 file that's downloaded as is.
+	KindVideo = "video"
+	// KindHLS is a HLS playlist whose segments are remuxed into a MP4 file.
+	KindHLS = "hls"
+	// KindBoard isn't a pin. It makes the downloader store the metadata
+	// and the cover of the board. Url is the cover.
+	KindBoard = "board"
+)
+
+// pinPreview is what the page reveals about a pin or a page of an idea
+// pin. It's returned by the JavaScript function describePin.
+type pinPreview struct {
+	Srcset string   `json:"srcset"`
+	Src    string   `json:"src"`
+	Videos []string `json:"videos"`
+	// Link is the link to the page of the pin.
+	Link string `json:"link"`
+	// Pages is true for idea pins consisting of several pages. Only the
+	// cover is shown on the board so their pages are scraped from the
+	// page of the pin.
+	Pages bool `json:"pages"`
+}
+
+// media is a file to download.
+type media struct {
+	URL  string
+	Kind string
+}
+
+// key identifies a pin. Every scroll returns all pins currently in the DOM
+// so most of them were already seen.
+func (p pinPreview) key() string {
+	if p.Link != "" {
+		return p.Link
+	}
+
+	return p.Srcset + " " + p.Src
+}
+
+// idea returns true if the pages of the pin have to be scraped from the
+// page of the pin.
+func (p pinPreview) idea() bool {
+	return p.Pages && p.Link != ""
+}
+
+// media returns the files to download for a pin. A video is preferred
+// over its poster and an animated GIF over its still preview. MP4 files
+// are preferred over HLS playlists as they don't need to be remuxed.
+func (p pinPreview) media() []media {
+	hls := ""
+	for _, video := range p.Videos {
+		u, err := url.Parse(video)
+		if err != nil || u.Scheme != "https" {
+			// Players using Media Source Extensions only have a blob: URL.
+			continue
+		}
+
+		switch strings.ToLower(path.Ext(u.Path)) {
+		case ".mp4":
+			return []media{{video, KindVideo}}
+		case ".m3u8":
+			if hls == "" {
+				hls = video
+			}
+		}
+	}
+	if hls != "" {
+		return []media{{hls, KindHLS}}
+	}
+
+	for _, link := range regexOriginalImageLink.FindAllString(p.Src+" "+p.Srcset, -1) {
+		if strings.EqualFold(path.Ext(link), ".gif") {
+			return []media{{link, KindGIF}}
+		}
+	}
+
+	// Processes the srcset attribute of a pin. It contains four URLs and we
+	// want the "originals" one.
+	if link := regexOriginalImageLink.FindString(p.Srcset); link != "" {
+		return []media{{link, KindImage}}
+	}
+
+	return nil
+}
+
+// publish hands a file of a pin over to the downloader.
+func (s *scraper) publish(sink pinSink, b *board.Board, m media) error {
+	log.Trace().
+		Str("method", "publish").
+		Msgf("Found %s: %s", m.Kind, m.URL)
+
+	return sink.add(Picture{
+		Url:          m.URL,
+		Kind:         m.Kind,
+		Host:         b.Host,
+		User:         b.User,
+		Path:         b.Path,
+		PathSegments: b.PathSegments,
+		UUID:         b.UUID,
+	})
+}
+
+// scrapeIdeaPin opens the page of an idea pin and publishes the files of
+// all its pages. If the pages can't be found only the cover is saved.
+func (s *scraper) scrapeIdeaPin(ctx context.Context, sink pinSink, b *board.Board, preview pinPreview) error {
+	var pages []pinPreview
+
+	err := s.runStep(ctx, "opening idea pin "+preview.Link,
+		chromedp.Navigate(preview.Link),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			for {
+				if err := chromedp.Evaluate(jsIdeaPinPages, &pages).Do(ctx); err != nil {
+					return err
+				}
+				for _, page := range pages {
+					if len(page.media()) > 0 {
+						return nil
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(discoverInterval):
+				}
+			}
+		}))
+	if err != nil {
+		// The board is done if it ran out of time.
+		if ctx.Err() != nil {
+			return err
+		}
+		log.Warn().
+			Str("method", "scrapeIdeaPin").
+			Msgf("Can not get the pages of idea pin %s: %s. Saving its cover only", preview.Link, err.Error())
+		pages = []pinPreview{{Srcset: preview.Srcset, Src: preview.Src, Videos: preview.Videos}}
+	}
+
+	for _, page := range pages {
+		for _, m := range page.media() {
+			if err := s.publish(sink, b, m); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+
+	"github.com/githubixx/pinbackup/board"
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// jsBoardMeta returns what the page of a board reveals about the board.
+// See boardPage.
+const jsBoardMeta = `
+(function() {
+	function meta(selector) {
+		var element = document.querySelector(selector);
+		return element ? (element.content || "").trim() : "";
+	}
+	function text(selector) {
+		var element = document.querySelector(selector);
+		return element ? element.textContent.trim() : "";
+	}
+	function links(selector) {
+		return [].map.call(document.querySelectorAll(selector), function(link) {
+			return link.href;
+		});
+	}
+	return {
+		title: text('[data-test-id="board-name"], h1') || meta('meta[property="og:title"]'),
+		description: text('[data-test-id="board-description"]') || meta('meta[property="og:description"], meta[name="description"]'),
+		category: text('[data-test-id="board-category"]') || meta('meta[property="pinterestapp:category"], meta[name="pinterestapp:category"]'),
+		cover: meta('meta[property="og:image"]'),
+		secret: document.querySelector('[data-test-id="board-secret-indicator"], [data-test-id="secret-board-icon"]') !== null,
+		collaborators: links('[data-test-id="board-collaborators"] a[href]'),
+		sections: links('[data-test-id="board-section"] a[href], [data-test-id="board-sections"] a[href]')
+	};
+})()
+`
+
+// boardPage is what the page of a board reveals about the board.
+type boardPage struct {
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	Category      string   `json:"category"`
+	Cover         string   `json:"cover"`
+	Secret        bool     `json:"secret"`
+	Collaborators []string `json:"collaborators"`
+	Sections      []string `json:"sections"`
+}
+
+// linkPath returns the path segments of a link.
+func linkPath(link string) []string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil
+	}
+
+	path := strings.Trim(u.Path, "/")
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
+
+// meta converts the page of board b into its metadata. Links to users and
+// sections are reduced to the user name and the section path.
+func (p boardPage) meta(b *board.Board) *redisClient.BoardMeta {
+	meta := &redisClient.BoardMeta{
+		Title:         p.Title,
+		Description:   p.Description,
+		Category:      p.Category,
+		Privacy:       "public",
+		Collaborators: []string{},
+		Sections:      []string{},
+		Scraped:       time.Now().Unix(),
+	}
+	if p.Secret {
+		meta.Privacy = "secret"
+	}
+	if u, err := url.Parse(p.Cover); err == nil && u.Scheme == "https" {
+		meta.Cover = p.Cover
+	}
+
+	collaborators := map[string]bool{}
+	for _, link := range p.Collaborators {
+		segments := linkPath(link)
+		if len(segments) != 1 || segments[0] == b.User || collaborators[segments[0]] {
+			continue
+		}
+		collaborators[segments[0]] = true
+		meta.Collaborators = append(meta.Collaborators, segments[0])
+	}
+
+	prefix := strings.Split(b.Path, "/")
+	sections := map[string]bool{}
+	for _, link := range p.Sections {
+		segments := linkPath(link)
+		// Only direct sections of the board: user/board/section
+		if len(segments) != len(prefix)+2 || segments[0] != b.User || strings.Join(segments[1:len(segments)-1], "/") != b.Path {
+			continue
+		}
+		section := strings.Join(segments[1:], "/")
+		if !sections[section] {
+			sections[section] = true
+			meta.Sections = append(meta.Sections, section)
+		}
+	}
+
+	sort.Strings(meta.Collaborators)
+	sort.Strings(meta.Sections)
+
+	return meta
+}
+
+// boardMeta returns the metadata of the board shown.
+func (s *scraper) boardMeta(ctx context.Context, b *board.Board) (*redisClient.BoardMeta, error) {
+	page := boardPage{}
+	if err := s.runStep(ctx, "reading the board metadata", chromedp.Evaluate(jsBoardMeta, &page)); err != nil {
+		return nil, err
+	}
+
+	return page.meta(b), nil
+}
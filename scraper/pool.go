@@ -0,0 +1,634 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto"
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/metrics"
+)
+
+const (
+	// defaultDevToolsPort is used for Chrome endpoints without port.
+	defaultDevToolsPort = "9222"
+	// srvPrefix marks Chrome endpoints that are DNS SRV records e.g.
+	// srv:_devtools._tcp.chrome.example.com
+	srvPrefix = "srv:"
+	// poolCheckInterval is how often the endpoints are resolved again and
+	// the browsers are health checked.
+	poolCheckInterval = 15 * time.Second
+	// acquireTimeout is how long a board waits for a free tab until it
+	// fails.
+	acquireTimeout = 5 * time.Minute
+)
+
+var (
+	// lookupHost and lookupSRV resolve Chrome endpoints. They are variables
+	// so tests can replace them.
+	lookupHost = net.DefaultResolver.LookupHost
+	lookupSRV  = net.DefaultResolver.LookupSRV
+
+	errNoBrowser = errors.New("No healthy Chrome browser with a free tab available")
+)
+
+// parseEndpoints splits a comma separated list of Chrome endpoints.
+func parseEndpoints(list string) []string {
+	endpoints := []string{}
+	for _, endpoint := range strings.Split(list, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	return endpoints
+}
+
+// resolveEndpoint returns the DevTools addresses (ip:port) of a Chrome
+// endpoint. An endpoint is a host with optional port or a DNS SRV record
+// prefixed with "srv:". Every IP address of a host is a browser of its own.
+// Chrome only accepts DevTools requests with an IP address or localhost as
+// Host header, so host names can't be used directly.
+func resolveEndpoint(ctx context.Context, endpoint string) ([]string, error) {
+	type target struct {
+		host string
+		port string
+	}
+	var targets []target
+
+	if strings.HasPrefix(endpoint, srvPrefix) {
+		_, records, err := lookupSRV(ctx, "", "", strings.TrimPrefix(endpoint, srvPrefix))
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			targets = append(targets, target{strings.TrimSuffix(record.Target, "."), fmt.Sprint(record.Port)})
+		}
+	} else {
+		host, port, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			host, port = endpoint, defaultDevToolsPort
+		}
+		targets = append(targets, target{host, port})
+	}
+
+	addrs := []string{}
+	for _, t := range targets {
+		if net.ParseIP(t.host) != nil {
+			addrs = append(addrs, net.JoinHostPort(t.host, t.port))
+			continue
+		}
+
+		ips, err := lookupHost(ctx, t.host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip, t.port))
+		}
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("No address found for Chrome endpoint %s", endpoint)
+	}
+
+	return addrs, nil
+}
+
+// resolveEndpoints returns the DevTools addresses of all endpoints. Errors
+// of single endpoints are only returned if no address was found at all.
+func resolveEndpoints(ctx context.Context, endpoints []string) ([]string, error) {
+	addrs := []string{}
+	var errs []string
+
+	for _, endpoint := range endpoints {
+		resolved, err := resolveEndpoint(ctx, endpoint)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", endpoint, err.Error()))
+			continue
+		}
+		addrs = append(addrs, resolved...)
+	}
+
+	if len(addrs) == 0 {
+		if len(errs) == 0 {
+			return nil, errors.New("No Chrome endpoint configured")
+		}
+		return nil, errors.New(strings.Join(errs, ", "))
+	}
+
+	return addrs, nil
+}
+
+// devToolsURL returns the WebSocket debugger URL of the Chrome listening on
+// addr e.g. ws://127.0.0.1:9222/devtools/browser/2689f9a9-eb4c-4f25-b1cf-f4287088bd46
+func devToolsURL(ctx context.Context, addr string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/json/version", addr), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	wsDebugURL, ok := result["webSocketDebuggerUrl"].(string)
+	if !ok || wsDebugURL == "" {
+		return "", errors.New("Chrome didn't return a webSocketDebuggerUrl")
+	}
+
+	return wsDebugURL, nil
+}
+
+// firstDevToolsURL returns the WebSocket debugger URL of the first
+// reachable Chrome of the endpoints.
+func firstDevToolsURL(ctx context.Context, endpoints []string) (string, error) {
+	addrs, err := resolveEndpoints(ctx, endpoints)
+	if err != nil {
+		return "", err
+	}
+
+	var errs []string
+	for _, addr := range addrs {
+		url, err := devToolsURL(ctx, addr)
+		if err == nil {
+			return url, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", addr, err.Error()))
+	}
+
+	return "", errors.New(strings.Join(errs, ", "))
+}
+
+// pooledBrowser is a connection to a Chrome of the pool.
+type pooledBrowser struct {
+	addr  string
+	wsURL string
+	// ctx is the chromedp context of the connection. New tabs are created
+	// from it. It's nil while the browser is down.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// tabs is the number of tabs currently used by boards.
+	tabs int
+	// jobs is the number of boards scraped since the browser was
+	// connected.
+	jobs int
+	// draining browsers get no new tabs. They are recycled or removed
+	// when their last tab is released.
+	draining bool
+	// removed is set if the address isn't returned by the endpoints
+	// anymore.
+	removed bool
+}
+
+// up returns true if the browser is connected.
+func (b *pooledBrowser) up() bool {
+	return b.ctx != nil && b.ctx.Err() == nil
+}
+
+// browserPool distributes boards across the tabs of several Chrome
+// browsers. Browsers are health checked and connected again if they went
+// down.
+type browserPool struct {
+	endpoints []string
+	// maxTabs is the maximum number of tabs per browser.
+	maxTabs int
+	// recycleAfter is the number of boards after which a browser is closed
+	// to bound memory leaks. 0 disables recycling.
+	recycleAfter int
+
+	mu       sync.Mutex
+	browsers map[string]*pooledBrowser
+	// changed is closed and replaced whenever a tab may have become
+	// available.
+	changed chan struct{}
+}
+
+// newBrowserPool returns a pool for the given Chrome endpoints. run must be
+// called to connect the browsers.
+func newBrowserPool(endpoints []string, maxTabs int, recycleAfter int) *browserPool {
+	if maxTabs < 1 {
+		maxTabs = 1
+	}
+
+	return &browserPool{
+		endpoints:    endpoints,
+		maxTabs:      maxTabs,
+		recycleAfter: recycleAfter,
+		browsers:     map[string]*pooledBrowser{},
+		changed:      make(chan struct{}),
+	}
+}
+
+// notify wakes up all boards waiting for a tab. p.mu must be held.
+func (p *browserPool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// updateMetrics exports the state of the pool. p.mu must be held.
+func (p *browserPool) updateMetrics() {
+	healthy, tabs := 0, 0
+	for _, b := range p.browsers {
+		if b.up() {
+			healthy++
+		}
+		tabs += b.tabs
+	}
+
+	metrics.BrowsersHealthy.Set(float64(healthy))
+	metrics.BrowserTabs.Set(float64(tabs))
+}
+
+// run checks the browsers until ctx is done and closes all connections
+// afterwards.
+func (p *browserPool) run(ctx context.Context) {
+	p.check(ctx)
+
+	ticker := time.NewTicker(poolCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.close()
+			return
+		case <-ticker.C:
+			p.check(ctx)
+		}
+	}
+}
+
+// check resolves the endpoints again, adds new browsers, connects browsers
+// that are down and disconnects browsers that aren't reachable anymore.
+func (p *browserPool) check(ctx context.Context) {
+	addrs, err := resolveEndpoints(ctx, p.endpoints)
+	if err != nil {
+		log.Error().
+			Str("method", "check").
+			Msgf("Can not resolve Chrome endpoints: %s", err.Error())
+	}
+
+	resolved := map[string]bool{}
+	for _, addr := range addrs {
+		resolved[addr] = true
+	}
+
+	p.mu.Lock()
+	for _, addr := range addrs {
+		if _, ok := p.browsers[addr]; !ok {
+			p.browsers[addr] = &pooledBrowser{addr: addr}
+		}
+	}
+	// Browsers are only removed if resolving worked. Otherwise a DNS
+	// hiccup would drop all of them.
+	if err == nil {
+		for addr, b := range p.browsers {
+			if !resolved[addr] {
+				b.removed = true
+				b.draining = true
+			}
+		}
+	}
+	p.removeIdle()
+	browsers := make([]*pooledBrowser, 0, len(p.browsers))
+	for _, b := range p.browsers {
+		browsers = append(browsers, b)
+	}
+	p.mu.Unlock()
+
+	for _, b := range browsers {
+		p.checkBrowser(ctx, b)
+	}
+
+	p.mu.Lock()
+	p.notify()
+	p.updateMetrics()
+	p.mu.Unlock()
+}
+
+// removeIdle drops removed browsers without tabs. p.mu must be held.
+func (p *browserPool) removeIdle() {
+	for addr, b := range p.browsers {
+		if b.removed && b.tabs == 0 {
+			if b.cancel != nil {
+				b.cancel()
+			}
+			delete(p.browsers, addr)
+			log.Info().
+				Str("method", "removeIdle").
+				Msgf("Removed Chrome %s from pool", addr)
+		}
+	}
+}
+
+// checkBrowser connects a browser that is down and verifies that a
+// connected browser is still reachable.
+func (p *browserPool) checkBrowser(ctx context.Context, b *pooledBrowser) {
+	p.mu.Lock()
+	up, removed := b.up(), b.removed
+	p.mu.Unlock()
+
+	if removed {
+		return
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, poolCheckInterval)
+	defer cancel()
+
+	wsURL, err := devToolsURL(checkCtx, b.addr)
+	if err != nil {
+		if up {
+			log.Error().
+				Str("method", "checkBrowser").
+				Msgf("Chrome %s is down: %s", b.addr, err.Error())
+			p.disconnect(b)
+		}
+		return
+	}
+
+	if up {
+		return
+	}
+
+	// A new allocator for every connection as the WebSocket URL changes
+	// when Chrome restarts.
+	allocCtx, cancelAlloc := chromedp.NewRemoteAllocator(context.Background(), wsURL)
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancelBrowser()
+		cancelAlloc()
+		log.Error().
+			Str("method", "checkBrowser").
+			Msgf("Can not connect to Chrome %s: %s", b.addr, err.Error())
+		return
+	}
+
+	log.Info().
+		Str("method", "checkBrowser").
+		Msgf("Connected to Chrome %s", b.addr)
+
+	p.mu.Lock()
+	b.wsURL = wsURL
+	b.ctx = browserCtx
+	b.cancel = func() {
+		cancelBrowser()
+		cancelAlloc()
+	}
+	b.jobs = 0
+	b.draining = false
+	p.mu.Unlock()
+}
+
+// disconnect closes the connection to a browser. Tabs still in use are
+// aborted.
+func (p *browserPool) disconnect(b *pooledBrowser) {
+	p.mu.Lock()
+	cancel := b.cancel
+	b.ctx, b.cancel = nil, nil
+	p.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// close disconnects all browsers.
+func (p *browserPool) close() {
+	p.mu.Lock()
+	browsers := make([]*pooledBrowser, 0, len(p.browsers))
+	for _, b := range p.browsers {
+		browsers = append(browsers, b)
+	}
+	p.mu.Unlock()
+
+	for _, b := range browsers {
+		p.disconnect(b)
+	}
+}
+
+// pick returns the connected browser with the fewest tabs in use that has
+// a free tab or nil. p.mu must be held.
+func (p *browserPool) pick() *pooledBrowser {
+	candidates := []*pooledBrowser{}
+	for _, b := range p.browsers {
+		if b.up() && !b.draining && b.tabs < p.maxTabs {
+			candidates = append(candidates, b)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Sorting by address makes the choice deterministic between browsers
+	// with the same number of tabs.
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].tabs != candidates[j].tabs {
+			return candidates[i].tabs < candidates[j].tabs
+		}
+		return candidates[i].addr < candidates[j].addr
+	})
+
+	return candidates[0]
+}
+
+// tab is a browser tab used for scraping a single board.
+type tab struct {
+	// ctx is the chromedp context of the tab.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	pool    *browserPool
+	browser *pooledBrowser
+	// browserContextID is the browser context of an isolated tab. It's
+	// disposed together with the tab.
+	browserContextID cdp.BrowserContextID
+}
+
+// newTab opens a tab of a browser. An isolated tab gets a browser context
+// of its own. Like an incognito window it shares no cookies or storage
+// with other tabs.
+func newTab(browserCtx context.Context, isolated bool) (context.Context, context.CancelFunc, cdp.BrowserContextID, error) {
+	if !isolated {
+		tabCtx, cancel := chromedp.NewContext(browserCtx)
+		return tabCtx, cancel, "", nil
+	}
+
+	executor := cdp.WithExecutor(browserCtx, chromedp.FromContext(browserCtx).Browser)
+
+	id, err := target.CreateBrowserContext().Do(executor)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	targetID, err := target.CreateTarget("about:blank").WithBrowserContextID(id).Do(executor)
+	if err != nil {
+		disposeBrowserContext(browserCtx, id)
+		return nil, nil, "", err
+	}
+
+	tabCtx, cancel := chromedp.NewContext(browserCtx, chromedp.WithTargetID(targetID))
+
+	return tabCtx, cancel, id, nil
+}
+
+// disposeBrowserContext closes a browser context with all its tabs.
+func disposeBrowserContext(browserCtx context.Context, id cdp.BrowserContextID) {
+	// browserCtx may already be done if the tab was aborted.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := chromedp.FromContext(browserCtx)
+	if c == nil || c.Browser == nil {
+		return
+	}
+
+	if err := target.DisposeBrowserContext(id).Do(cdp.WithExecutor(ctx, c.Browser)); err != nil {
+		log.Debug().
+			Str("method", "disposeBrowserContext").
+			Msgf("Can not dispose browser context %s: %s", id, err.Error())
+	}
+}
+
+// acquire opens a new tab in the browser with the fewest tabs in use. It
+// waits until a tab is free, ctx is done or acquireTimeout passed. The tab
+// is closed when ctx is done or release is called. An isolated tab has a
+// browser context of its own e.g. to log in with another account.
+func (p *browserPool) acquire(ctx context.Context, isolated bool) (*tab, error) {
+	timeout := time.NewTimer(acquireTimeout)
+	defer timeout.Stop()
+
+	for {
+		p.mu.Lock()
+		b := p.pick()
+		if b != nil {
+			b.tabs++
+			b.jobs++
+			if p.recycleAfter > 0 && b.jobs >= p.recycleAfter {
+				b.draining = true
+			}
+			browserCtx := b.ctx
+			p.updateMetrics()
+			p.mu.Unlock()
+
+			tabCtx, cancel, browserContextID, err := newTab(browserCtx, isolated)
+			if err != nil {
+				(&tab{cancel: func() {}, pool: p, browser: b}).release()
+				return nil, err
+			}
+
+			t := &tab{ctx: tabCtx, cancel: cancel, pool: p, browser: b, browserContextID: browserContextID}
+
+			// The tab belongs to the browser connection. Close it if
+			// the board is aborted.
+			go func() {
+				select {
+				case <-ctx.Done():
+					cancel()
+				case <-tabCtx.Done():
+				}
+			}()
+
+			// Opening the tab with its own context makes sure the tab
+			// isn't closed when the first step using it times out.
+			if err := chromedp.Run(tabCtx); err != nil {
+				t.release()
+				return nil, err
+			}
+
+			return t, nil
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout.C:
+			return nil, errNoBrowser
+		case <-changed:
+		}
+	}
+}
+
+// release closes the tab and the browser context of an isolated tab. A
+// draining browser is recycled or removed when its last tab is released.
+func (t *tab) release() {
+	t.cancel()
+
+	p, b := t.pool, t.browser
+
+	p.mu.Lock()
+	browserCtx := b.ctx
+	p.mu.Unlock()
+	if t.browserContextID != "" && browserCtx != nil {
+		disposeBrowserContext(browserCtx, t.browserContextID)
+	}
+
+	p.mu.Lock()
+	b.tabs--
+	recycle := b.draining && !b.removed && b.tabs == 0 && b.up()
+	p.removeIdle()
+	p.notify()
+	p.updateMetrics()
+	p.mu.Unlock()
+
+	if recycle {
+		p.recycle(b)
+	}
+}
+
+// recycle closes a browser to free the memory it leaked. The browser is
+// expected to be restarted by its supervisor e.g. the container runtime.
+// It's connected again by the next check.
+func (p *browserPool) recycle(b *pooledBrowser) {
+	log.Info().
+		Str("method", "recycle").
+		Msgf("Recycling Chrome %s after %d boards", b.addr, p.recycleAfter)
+
+	p.mu.Lock()
+	wsURL := b.wsURL
+	p.mu.Unlock()
+
+	p.disconnect(b)
+
+	// chromedp refuses to close remote browsers. So Browser.close is sent
+	// over a connection of its own.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := chromedp.DialContext(ctx, wsURL)
+	if err != nil {
+		log.Error().
+			Str("method", "recycle").
+			Msgf("Can not connect to Chrome %s: %s", b.addr, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	if err := conn.Write(ctx, &cdproto.Message{ID: 1, Method: browser.CommandClose}); err != nil {
+		log.Error().
+			Str("method", "recycle").
+			Msgf("Can not close Chrome %s: %s", b.addr, err.Error())
+	}
+}
@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	var tests = []struct {
+		list      string
+		endpoints []string
+	}{
+		{"headless-chrome", []string{"headless-chrome"}},
+		{" chrome-1, chrome-2:9333 ,,srv:_devtools._tcp.example.com", []string{"chrome-1", "chrome-2:9333", "srv:_devtools._tcp.example.com"}},
+		{"", []string{}},
+	}
+
+	for _, test := range tests {
+		if endpoints := parseEndpoints(test.list); !reflect.DeepEqual(endpoints, test.endpoints) {
+			t.Errorf("Got: %v / Expected: %v", endpoints, test.endpoints)
+		}
+	}
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	origHost, origSRV := lookupHost, lookupSRV
+	defer func() {
+		lookupHost, lookupSRV = origHost, origSRV
+	}()
+
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		switch host {
+		case "chrome":
+			return []string{"10.0.0.1", "10.0.0.2"}, nil
+		case "chrome-1.example.com":
+			return []string{"10.0.1.1"}, nil
+		case "chrome-2.example.com":
+			return []string{"10.0.1.2"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_devtools._tcp.example.com" {
+			return "", nil, errors.New("no such host")
+		}
+		return name, []*net.SRV{
+			{Target: "chrome-1.example.com.", Port: 9222},
+			{Target: "chrome-2.example.com.", Port: 9333},
+		}, nil
+	}
+
+	var tests = []struct {
+		endpoint string
+		addrs    []string
+		err      bool
+	}{
+		{"127.0.0.1", []string{"127.0.0.1:9222"}, false},
+		{"127.0.0.1:9333", []string{"127.0.0.1:9333"}, false},
+		{"[::1]:9222", []string{"[::1]:9222"}, false},
+		{"chrome", []string{"10.0.0.1:9222", "10.0.0.2:9222"}, false},
+		{"chrome:9333", []string{"10.0.0.1:9333", "10.0.0.2:9333"}, false},
+		{"srv:_devtools._tcp.example.com", []string{"10.0.1.1:9222", "10.0.1.2:9333"}, false},
+		{"unknown", nil, true},
+		{"srv:_unknown._tcp.example.com", nil, true},
+	}
+
+	for _, test := range tests {
+		addrs, err := resolveEndpoint(context.Background(), test.endpoint)
+		if (err != nil) != test.err {
+			t.Errorf("%s: Got error: %v / Expected error: %v", test.endpoint, err, test.err)
+		}
+		if !reflect.DeepEqual(addrs, test.addrs) {
+			t.Errorf("%s: Got: %v / Expected: %v", test.endpoint, addrs, test.addrs)
+		}
+	}
+
+	// Unresolvable endpoints are skipped as long as one is left.
+	addrs, err := resolveEndpoints(context.Background(), []string{"unknown", "127.0.0.1"})
+	if err != nil || !reflect.DeepEqual(addrs, []string{"127.0.0.1:9222"}) {
+		t.Errorf("Got: %v, error: %v / Expected: [127.0.0.1:9222]", addrs, err)
+	}
+	if _, err := resolveEndpoints(context.Background(), []string{"unknown"}); err == nil {
+		t.Errorf("Got: no error / Expected: error as no endpoint resolves")
+	}
+}
+
+func TestPick(t *testing.T) {
+	connected, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	down, cancelDown := context.WithCancel(context.Background())
+	cancelDown()
+
+	p := newBrowserPool(nil, 2, 0)
+	p.browsers = map[string]*pooledBrowser{
+		"10.0.0.1:9222": {addr: "10.0.0.1:9222", ctx: connected, tabs: 1},
+		"10.0.0.2:9222": {addr: "10.0.0.2:9222", ctx: connected, tabs: 1},
+		"10.0.0.3:9222": {addr: "10.0.0.3:9222", ctx: down},
+		"10.0.0.4:9222": {addr: "10.0.0.4:9222", ctx: connected, draining: true},
+		"10.0.0.5:9222": {addr: "10.0.0.5:9222"},
+	}
+
+	// Same number of tabs: the lowest address wins.
+	if b := p.pick(); b == nil || b.addr != "10.0.0.1:9222" {
+		t.Fatalf("Got: %v / Expected: 10.0.0.1:9222", b)
+	}
+
+	p.browsers["10.0.0.1:9222"].tabs = 2
+	if b := p.pick(); b == nil || b.addr != "10.0.0.2:9222" {
+		t.Fatalf("Got: %v / Expected: 10.0.0.2:9222", b)
+	}
+
+	// All tabs in use, browsers down or draining.
+	p.browsers["10.0.0.2:9222"].tabs = 2
+	if b := p.pick(); b != nil {
+		t.Errorf("Got: %s / Expected: no browser", b.addr)
+	}
+}
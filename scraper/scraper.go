@@ -1,9 +1,6 @@
 package scraper
 
 import (
-	"net"
-	"net/http"
-
 	"github.com/chromedp/cdproto/network"
 	"github.com/gomodule/redigo/redis"
 	"github.com/rs/zerolog/log"
@@ -16,29 +13,88 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/githubixx/pinbackup/board"
+	"github.com/githubixx/pinbackup/events"
+	"github.com/githubixx/pinbackup/health"
+	"github.com/githubixx/pinbackup/job"
+	"github.com/githubixx/pinbackup/metrics"
 	redisClient "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/shutdown"
 )
 
 var (
 	// Regex to find link to original image
 	regexOriginalImageLink = regexp.MustCompile(`(?m)https:\/\/[-a-zA-Z0-9@:%._\+~#=]{2,256}\.[a-z]{2,3}/originals\b[-a-zA-Z0-9@:%_\+.~#?&//=]*`)
 	downloadQueue          string
+
+	// Pauses giving the page time to react like a human would. They are
+	// variables so tests against a local site don't wait needlessly.
+	loginFormDelay   = 10 * time.Second
+	loginSubmitDelay = 5 * time.Second
+	scrollDelay      = 2 * time.Second
 )
 
 // Config struct contains all variables needed for scraping a board.
 type Config struct {
-	RedisHost            string
-	RedisPort            int
-	LoginName            string
-	LoginPassword        string
-	SelectorPreviewPins  string
-	BoardsQueue          string
-	DownloadQueue        string
+	RedisHost     string
+	RedisPort     int
+	LoginName     string
+	LoginPassword string
+	// AccountKey decrypts the credentials of the accounts boards can be
+	// queued with. Only needed if accounts are used.
+	AccountKey string
+	// MaxActiveJobs is the maximum number of active jobs of an API token
+	// when queueing boards found on source pages. 0 disables the limit.
+	MaxActiveJobs int
+	// SelectorPreviewPins overrides the discovery of the preview pictures
+	// of pins. See pinStrategies.
+	SelectorPreviewPins string
+	BoardsQueue         string
+	DownloadQueue       string
+	// ChromeWsDebuggerHost is a comma separated list of Chrome endpoints.
+	// See resolveEndpoint for the supported forms.
 	ChromeWsDebuggerHost string
+	MetricsListen        string
+	// Concurrency is the number of boards scraped at the same time.
+	Concurrency int
+	// ChromeMaxTabs is the maximum number of tabs opened per browser.
+	ChromeMaxTabs int
+	// ChromeRecycleAfter is the number of boards after which a browser is
+	// closed to bound memory leaks. 0 disables recycling.
+	ChromeRecycleAfter int
+	// BlockResources are the resource types e.g. "image" the browser
+	// doesn't load while scraping. Empty disables blocking.
+	BlockResources []string
+	// ShutdownTimeout is how long boards in flight may take to finish on
+	// shutdown until they are aborted and their jobs failed.
+	ShutdownTimeout time.Duration
+	// StepTimeout is how long a single browser step e.g. scrolling may
+	// take. 0 disables the timeout.
+	StepTimeout time.Duration
+	// BoardTimeout is how long scraping a board may take. 0 disables the
+	// timeout.
+	BoardTimeout time.Duration
+	// StallScrolls is the number of scrolls without new pins after which
+	// the end of the board is assumed.
+	StallScrolls int
+	// MaxScrolls and MaxPins fail the job if a board needs more scrolls or
+	// has more pins. 0 disables the limit.
+	MaxScrolls int
+	MaxPins    int
+	// CaptureOnFailure stores a screenshot, the DOM, the console messages
+	// and the network activity as artifacts of a failed job.
+	CaptureOnFailure bool
+	// CaptureSteps stores a screenshot and the DOM after every step of
+	// scraping a board for debugging.
+	CaptureSteps bool
+	// ArtifactTTL is how long artifacts are kept.
+	ArtifactTTL time.Duration
+	// Scheme is used to reach the host of a board. Empty means https.
+	// http is only meant for testing against a local fake site.
+	Scheme string
 }
 
 // Picture struct contains information after scraping a picture.
@@ -49,84 +105,54 @@ type Picture struct {
 	User         string
 	Path         string
 	PathSegments []string
+	// UUID of the job the picture belongs to
+	UUID string
+	// Kind of media e.g. KindHLS. Pictures published by older scrapers
+	// have none and are images.
+	Kind string
 }
 
 type scraper struct {
 	config *Config
+	// recorder records the tab for the artifacts. It's nil if no artifacts
+	// are captured.
+	recorder *recorder
+	// steps is the number of steps captured so far.
+	steps int
+	// sink receives the pictures found. If nil they are published to the
+	// download queue.
+	sink pinSink
+	// account is the account the board is scraped with. The default login
+	// is used if it's nil.
+	account *loginAccount
 }
 
-// lookupIP resolves a hostname to IPv4 address.
-func lookupIP(hostName string) (string, error) {
-	ips, err := net.LookupIP(hostName)
-	if err != nil {
-		return "", err
-	}
-
-	if len(ips) == 0 {
-		return "", errors.New(fmt.Sprintf("No IP address found for host %s", hostName))
+// siteURL returns the URL of path on the host of a board.
+func (s *scraper) siteURL(b *board.Board, path string) string {
+	scheme := s.config.Scheme
+	if scheme == "" {
+		scheme = "https"
 	}
 
-	log.Trace().
-		Str("method", "lookupIP").
-		Msgf("IP addresses for host %s", hostName)
-
-	// 172.217.1.238
-	// 2607:f8b0:4000:80e::200e
-	return ips[0].String(), nil
-}
-
-// getChromeWsDebugURL connects to IP address where Chrome browser is
-// listening on port 9222 to get webservice debug URL.
-func (s *scraper) getChromeWsDebugURL() (string, error) {
-	var (
-		err    error
-		config = s.config
-	)
-
-	log.Trace().
-		Str("method", "getChromeWsDebugURL").
-		Msgf("Getting IP address of %s", config.ChromeWsDebuggerHost)
-
-	ip, err := lookupIP(config.ChromeWsDebuggerHost)
-	if err != nil {
-		return "", err
-	}
-
-	// E.g.: ws://127.0.0.1:9222/devtools/browser/2689f9a9-eb4c-4f25-b1cf-f4287088bd46
-	log.Debug().
-		Str("method", "getChromeWsDebugURL").
-		Msgf("ChromeWsDebugIP: %s", ip)
-
-	resp, err := http.Get(fmt.Sprintf("http://%s:9222/json/version", ip))
-	if err != nil {
-		return "", err
-	}
-
-	var result map[string]interface{}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
-	}
-
-	return result["webSocketDebuggerUrl"].(string), nil
+	return scheme + "://" + b.Host + path
 }
 
 // login checks if authentication is already done and tries to login inf not.
 func (s *scraper) login(browserCtx context.Context, board *board.Board) error {
 	var (
-		err           error
-		authenticated = false
-		config        = s.config
+		err             error
+		authenticated   = false
+		email, password = s.credentials()
 
 		loginTasks = chromedp.Tasks{
-			chromedp.Navigate(fmt.Sprintf("https://" + board.Host + "/login/")),
+			chromedp.Navigate(s.siteURL(board, "/login/")),
 			chromedp.WaitVisible("#password", chromedp.ByID),
-			chromedp.Sleep(10 * time.Second),
-			chromedp.SendKeys("#email", config.LoginName, chromedp.ByID),
-			chromedp.SendKeys("#password", config.LoginPassword, chromedp.ByID),
+			chromedp.Sleep(loginFormDelay),
+			chromedp.SendKeys("#email", email, chromedp.ByID),
+			chromedp.SendKeys("#password", password, chromedp.ByID),
 			chromedp.Sleep(1 * time.Second),
 			chromedp.Click(`.red.SignupButton.active`),
-			chromedp.Sleep(5 * time.Second),
+			chromedp.Sleep(loginSubmitDelay),
 		}
 
 		authenticatedTasks = chromedp.Tasks{
@@ -155,7 +181,7 @@ func (s *scraper) login(browserCtx context.Context, board *board.Board) error {
 	)
 
 	// Check if we are already authenticated
-	err = chromedp.Run(browserCtx, authenticatedTasks)
+	err = s.runStep(browserCtx, "checking the login", authenticatedTasks)
 	if err != nil {
 		return err
 	}
@@ -165,12 +191,36 @@ func (s *scraper) login(browserCtx context.Context, board *board.Board) error {
 			Str("method", "login").
 			Msgf("Login needed.")
 
-		err = chromedp.Run(browserCtx, loginTasks)
+		metrics.LoginAttempts.Inc()
+
+		err = s.runStep(browserCtx, "logging in", loginTasks, authenticatedTasks)
+		if err == nil && !authenticated {
+			err = errors.New("Login failed: No _auth cookie after submitting login form")
+		}
+
 		if err != nil {
+			metrics.LoginFailures.Inc()
+			// The health of the scraper only depends on its default
+			// login. A wrong password of an account is the account's
+			// problem.
+			if s.account == nil {
+				lastLogin.set(err)
+			}
 			return err
 		}
 	}
 
+	if s.account != nil {
+		if err := s.saveSession(browserCtx); err != nil {
+			log.Warn().
+				Str("method", "login").
+				Msgf("Can not save session of account %s: %s", s.account.name, err.Error())
+		}
+		return nil
+	}
+
+	lastLogin.set(nil)
+
 	return nil
 }
 
@@ -178,13 +228,14 @@ func (s *scraper) login(browserCtx context.Context, board *board.Board) error {
 func (s *scraper) openURL(browserCtx context.Context, board *board.Board) error {
 	var (
 		err error
+		url = s.siteURL(board, "/"+board.User+"/"+board.Path)
 	)
 
 	log.Debug().
 		Str("method", "openURL").
-		Msgf("Navigating to: https://%s/%s/%s", board.Host, board.User, board.Path)
+		Msgf("Navigating to: %s", url)
 
-	err = chromedp.Run(browserCtx, chromedp.Navigate(fmt.Sprintf("https://%s/%s/%s", board.Host, board.User, board.Path)))
+	err = s.runStep(browserCtx, "opening the board", chromedp.Navigate(url))
 	if err != nil {
 		return err
 	}
@@ -193,61 +244,79 @@ func (s *scraper) openURL(browserCtx context.Context, board *board.Board) error
 }
 
 // scrape parses a board and extracts image URLs. Also scrolls down the
-// page until end.
+// page until no new pins appear anymore.
 func (s *scraper) scrape(browserCtx context.Context, board *board.Board) error {
 	var (
-		err                     error
-		config                  = s.config
-		pins                    = newStringSet() // Set to store preview pins without duplicates
-		latestPinInCurrentBatch string           // Stores the lastest pin in current scrape batch
-		latestPinInPrevBatch    string           // Stores the latest pin in previous scrape batch
+		err    error
+		config = s.config
+		pins   = newStringSet() // Set to store preview pins without duplicates
+		// Idea pins whose pages are scraped after the board
+		ideaPins []pinPreview
+		// Number of scrolls in a row that didn't reveal new pins
+		stalledScrolls = 0
 	)
 
+	stallScrolls := config.StallScrolls
+	if stallScrolls < 1 {
+		stallScrolls = 1
+	}
+
+	sink, closeSink, err := s.openSink(board)
+	if err != nil {
+		return err
+	}
+	defer closeSink()
+
 	log.Trace().
 		Str("method", "scrape").
-		Msgf("Borrow Redis connection from pool.")
+		Msg("Waiting for the first preview pins to appear.")
 
-	conn, err := redisClient.GetConnection()
+	strategy, err := s.discoverPins(browserCtx)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+
+	// The page is rendered as soon as pins appear. Missing metadata must not
+	// stop the backup of the pins. Source pages like all pins of a user
+	// have no metadata.
+	if board.Source == "" {
+		meta, err := s.boardMeta(browserCtx, board)
+		if err == nil {
+			err = sink.metadata(meta)
+		}
+		if err != nil {
+			log.Warn().
+				Str("method", "scrape").
+				Msgf("Can not save metadata of board %s:%s: %s", board.User, board.Path, err.Error())
+		}
+	}
 
 	// Get JavaScript code which "scrolls" page by page so that we can fetch
 	// the preview links.
-	jsScrollIntoView := renderJsScrollIntoView(config.SelectorPreviewPins)
+	jsScrollIntoView := renderJsScrollIntoView(strategy.Selector)
 
-	log.Trace().
-		Str("method", "scrape").
-		Msgf("Execute JavaScript to get pins count. Selector: %s", config.SelectorPreviewPins)
-
-	// TODO: Needs timeout
-	scrollIntoView := func(res *[]string) chromedp.Tasks {
+	scrollIntoView := func(res *[]pinPreview) chromedp.Tasks {
 		return chromedp.Tasks{
-			chromedp.WaitVisible(config.SelectorPreviewPins, chromedp.ByQuery),
-			chromedp.Sleep(time.Second * 2),
+			chromedp.WaitVisible(strategy.Selector, chromedp.ByQuery),
+			chromedp.Sleep(scrollDelay),
 			chromedp.Evaluate(jsScrollIntoView(), res),
-			chromedp.Sleep(time.Second * 2),
+			chromedp.Sleep(scrollDelay),
 		}
 	}
 
-	// Processes the srcset attribute of a pin. It contains four URLs and we want
-	// the "originals" one.
-	getOriginalImage := func(srcSetAttr string) string {
-		return regexOriginalImageLink.FindString(srcSetAttr)
-	}
+	s.captureStep(browserCtx, board.UUID, "pins")
 
-	log.Trace().
-		Str("method", "scrape").
-		Msg("Waiting for the first preview pins to appear.")
+	for scrolls := 1; ; scrolls++ {
+		if config.MaxScrolls > 0 && scrolls > config.MaxScrolls {
+			return fmt.Errorf("Stopped after %d scrolls with %d pins found. The end of the board wasn't reached", config.MaxScrolls, pins.Size())
+		}
 
-	if err := chromedp.Run(browserCtx, chromedp.WaitVisible(config.SelectorPreviewPins)); err != nil {
-		return err
-	}
+		// After "scrolling" store the pins here
+		var res []pinPreview
 
-	for {
-		// After "scrolling" store the pin links here
-		var res []string
+		// Number of pins found in the current batch that weren't published
+		// before
+		newPins := 0
 
 		log.Debug().
 			Str("method", "scrape").
@@ -258,82 +327,150 @@ func (s *scraper) scrape(browserCtx context.Context, board *board.Board) error {
 			Msg("Scrolling to next page.")
 
 		// Scroll further down the page and fetch next bunch of pins
-		err = chromedp.Run(browserCtx, scrollIntoView(&res))
+		err = s.runStep(browserCtx, fmt.Sprintf("scrolling after %d pins", pins.Size()), scrollIntoView(&res))
 		if err != nil {
 			return err
 		}
 
-		// For every pin extract the "/original/" path in srcset
-		for _, n := range res {
-			link := getOriginalImage(n)
-			if !strings.HasPrefix(link, "https") {
+		// For every pin extract the files to download
+		for _, preview := range res {
+			// Every scroll returns all pins currently in the DOM. So most of
+			// them were already published in a previous batch.
+			key := preview.key()
+			if pins.Has(key) {
+				continue
+			}
+
+			found := preview.media()
+			if len(found) == 0 && !preview.idea() {
 				continue
 			}
-			pins.Add(n)
 
-			latestPinInCurrentBatch = link
+			if config.MaxPins > 0 && pins.Size() >= config.MaxPins {
+				return fmt.Errorf("Stopped after %d pins. The board has more pins than allowed", config.MaxPins)
+			}
+			pins.Add(key)
+			newPins++
 
-			log.Trace().
-				Str("method", "scrape").
-				Msgf("Found picture: %s", link)
-
-			picture := Picture{}
-			picture.Url = link
-			picture.Host = board.Host
-			picture.User = board.User
-			picture.Path = board.Path
-			picture.PathSegments = board.PathSegments
-
-			message, err := json.Marshal(picture)
-			if err != nil {
-				return errors.New("Can not decode picture object")
+			if preview.idea() {
+				ideaPins = append(ideaPins, preview)
+				continue
 			}
 
-			err = redisClient.Publish(conn, config.DownloadQueue, []byte(message))
-			if err != nil {
-				return err
+			for _, m := range found {
+				if err := s.publish(sink, board, m); err != nil {
+					return err
+				}
 			}
 		}
 
-		// Check if the latest pin from the previous batch matches the latest
-		// pin from the current batch. If that's the case we can assume that
-		// we reached the end of the board. Not the greatest solution on earth
-		// but it seems to work for now. The real pin count is stored in
+		if newPins > 0 {
+			stalledScrolls = 0
+			sink.discovered(pins.Size())
+			continue
+		}
+
+		// Pinterest sometimes needs more than one scroll to load the next
+		// pins. So the end of the board is only assumed if several scrolls
+		// in a row revealed nothing new. The real pin count is stored in
 		// script tag with id "#initial-state".
-		if latestPinInCurrentBatch == latestPinInPrevBatch {
+		stalledScrolls++
+		if stalledScrolls >= stallScrolls {
+			log.Debug().
+				Str("method", "scrape").
+				Msgf("No new pins after %d scrolls. Reached end of board.", stalledScrolls)
 			break
 		}
+	}
 
-		latestPinInPrevBatch = latestPinInCurrentBatch
+	if pins.Size() == 0 {
+		return fmt.Errorf("Found no pictures in pins matching %s. The selector may be outdated", strategy.Selector)
+	}
 
+	// Opening an idea pin leaves the board. So this is done last.
+	for _, preview := range ideaPins {
+		if err := s.scrapeIdeaPin(browserCtx, sink, board, preview); err != nil {
+			return err
+		}
 	}
 
+	metrics.PinsFound.Observe(float64(pins.Size()))
+
 	return nil
 }
 
-// disablePictureLoading causes the preview images not to load in the browser
-// context. That saves quite some memory and makes things faster in general.
-// TODO: Needs to be implemented
-/*func disablePictureLoading(ctx context.Context) chromedp.Tasks{
-	return chromedp.Tasks{
-		network.SetRequestInterception([]*network.RequestPattern{
-			&network.RequestPattern{
-				URLPattern: "*", ResourceType: "Image",
-			},
-		}),
-
-		chromedp.CallbackFunc("Network.requestIntercepted", func(param interface{}, handler *chromedp.TargetHandler) {
-			network.ContinueInterceptedRequest(data.InterceptionID).WithErrorReason("Aborted")).Do(ctx, handler)
-		}),
+// updateJob sets the status of a job and publishes the matching event. If
+// the job changes to downloading it's finished immediately in case the
+// downloader already processed all pins. Errors are only logged as the job
+// status must never stop scraping.
+func updateJob(b *board.Board, status string, errMsg string) {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		log.Error().
+			Str("method", "updateJob").
+			Msgf("Can not update job %s: %s", b.UUID, err.Error())
+		return
 	}
-}*/
+	defer conn.Close()
 
-// StartProcessQueue waits for incoming scrape jobs
-func StartProcessQueue(config *Config) error {
+	if err := job.SetStatus(conn, b.UUID, status, errMsg); err != nil {
+		log.Error().
+			Str("method", "updateJob").
+			Msgf("Can not update job %s: %s", b.UUID, err.Error())
+		return
+	}
+
+	event := events.Event{UUID: b.UUID, User: b.User, Path: b.Path, URL: b.RawURL, Error: errMsg}
+
+	switch status {
+	case job.StatusScraping:
+		event.Type = events.TypeScrapeStarted
+	case job.StatusDownloading:
+		event.Type = events.TypeScrapeFinished
+	case job.StatusFailed:
+		event.Type = events.TypeJobFailed
+	default:
+		return
+	}
+	events.Publish(conn, event)
+
+	if status == job.StatusDownloading {
+		finished, err := job.FinishIfDone(conn, b.UUID)
+		if err != nil {
+			log.Error().
+				Str("method", "updateJob").
+				Msgf("Can not finish job %s: %s", b.UUID, err.Error())
+			return
+		}
+
+		if finished {
+			if err := redisClient.TouchBoard(conn, b.User, b.Path, time.Now()); err != nil {
+				log.Error().
+					Str("method", "updateJob").
+					Msgf("Can not update last sync time of %s:%s: %s", b.User, b.Path, err.Error())
+			}
+			event.Type = events.TypeJobFinished
+			events.Publish(conn, event)
+		}
+	}
+}
+
+// StartProcessQueue waits for incoming scrape jobs until ctx is done. Boards
+// in flight are drained before it returns.
+func StartProcessQueue(ctx context.Context, config *Config) error {
 	log.Debug().
 		Msg("Starting scraper queue.")
 
-	semChan := make(chan bool, 1)
+	concurrency := config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	semChan := make(chan bool, concurrency)
+
+	blocked, err := parseResourceTypes(config.BlockResources)
+	if err != nil {
+		return err
+	}
 
 	log.Trace().
 		Str("method", "StartProcessQueue").
@@ -341,6 +478,8 @@ func StartProcessQueue(config *Config) error {
 
 	redisClient.InitPool(config.RedisHost, config.RedisPort)
 
+	metrics.Serve(config.MetricsListen, health.Routes(HealthChecks(config)...))
+
 	log.Trace().
 		Str("method", "StartProcessingQueue").
 		Msg("Getting Redis connection from pool.")
@@ -351,22 +490,58 @@ func StartProcessQueue(config *Config) error {
 	}
 	defer conn.Close()
 
+	// The pool outlives ctx as boards in flight still need their tabs
+	// while draining.
+	pool := newBrowserPool(parseEndpoints(config.ChromeWsDebuggerHost), config.ChromeMaxTabs, config.ChromeRecycleAfter)
+	poolCtx, stopPool := context.WithCancel(context.Background())
+	defer stopPool()
+	go pool.run(poolCtx)
+
 	// TODO: Needs to be replaced with Redis Streams for persistence.
 	psc := redis.PubSubConn{Conn: conn}
 	psc.Subscribe(config.BoardsQueue)
+
+	// Unsubscribing on shutdown ends the receive loop below.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			psc.Unsubscribe()
+		case <-stop:
+		}
+	}()
+
+	// Boards in flight use their own context so they aren't aborted
+	// immediately on shutdown.
+	var inFlight sync.WaitGroup
+	workCtx, abortWork := context.WithCancel(context.Background())
+	defer abortWork()
+
 	for {
 		switch v := psc.Receive().(type) {
 		case redis.Message:
 			// Block one slot in buffered channel
+			metrics.QueueDepth.WithLabelValues(config.BoardsQueue).Inc()
 			semChan <- true
+			metrics.QueueDepth.WithLabelValues(config.BoardsQueue).Dec()
+			inFlight.Add(1)
 			go func(message []byte) {
+				metrics.InFlight.WithLabelValues("scraper").Inc()
+				defer func() {
+					inFlight.Done()
+					metrics.InFlight.WithLabelValues("scraper").Dec()
+					// release slot in buffered channel
+					<-semChan
+				}()
+
 				board := board.Board{}
 
 				decoder := json.NewDecoder(bytes.NewReader(message))
 				if err := decoder.Decode(&board); err != nil {
 					log.Error().
 						Str("method", "StartProcessQueue").
-						Msgf("Can not decode board %s. Error: %s", board, err.Error())
+						Msgf("Can not decode board %v. Error: %s", board, err.Error())
 					return
 				}
 
@@ -374,39 +549,154 @@ func StartProcessQueue(config *Config) error {
 					config: config,
 				}
 
-				chromeWsDebugURL, err := s.getChromeWsDebugURL()
+				// The scrape is aborted if the lock of the board is lost or
+				// the scraper shuts down.
+				ctx, cancel := context.WithCancel(workCtx)
+				defer cancel()
+
+				lock, err := lockBoard(&board, cancel)
+				if err != nil {
+					// A job of a board locked by another scraper is left
+					// alone. It may be the holder itself.
+					if message := lockFailed(&board, err); message != "" {
+						updateJob(&board, job.StatusFailed, message)
+					}
+					return
+				}
+				// Released after the job changed its status so the job is
+				// never scraping without the lock being held.
+				defer lock.release()
+
+				updateJob(&board, job.StatusScraping, "")
+
+				if board.Account != "" {
+					s.account, err = loadAccount(config, board.Account)
+					if err != nil {
+						log.Error().
+							Str("method", "StartProcessQueue").
+							Msgf("Can not load account %s: %s", board.Account, err.Error())
+						updateJob(&board, job.StatusFailed, fmt.Sprintf("Can not load account %s: %s", board.Account, err.Error()))
+						return
+					}
+				}
+
+				// Boards of an account are scraped in a browser context
+				// of their own so the sessions of the accounts are kept
+				// apart.
+				tab, err := pool.acquire(ctx, s.account != nil)
 				if err != nil {
 					log.Error().
 						Str("method", "StartProcessQueue").
-						Msgf("Can not get Chrome debug URL: %s", err.Error())
+						Msgf("Can not get Chrome tab: %s", err.Error())
+					if workCtx.Err() != nil {
+						err = errors.New("Scraper shut down before the board was scraped completely")
+					}
+					updateJob(&board, job.StatusFailed, err.Error())
 					return
 				}
+				defer tab.release()
+
+				// The board deadline covers the login and all scrolls.
+				tctx := tab.ctx
+				if config.BoardTimeout > 0 {
+					var cancelBoard context.CancelFunc
+					tctx, cancelBoard = context.WithTimeout(tctx, config.BoardTimeout)
+					defer cancelBoard()
+				}
 
-				// Browser context
-				bctx, cancelBctx := chromedp.NewRemoteAllocator(context.Background(), chromeWsDebugURL)
-				defer cancelBctx()
+				if config.CaptureOnFailure || config.CaptureSteps {
+					s.recorder = newRecorder(tab.ctx)
+				}
 
-				// Tab context (create new tab and close afterwards)
-				tctx, cancelTctx := chromedp.NewContext(bctx)
-				defer cancelTctx()
+				if err := blockResources(tctx, blocked); err != nil {
+					log.Error().
+						Str("method", "StartProcessQueue").
+						Msgf("Can not block resources: %s", err.Error())
+				}
 
-				s.login(tctx, &board)
-				s.openURL(tctx, &board)
+				if s.account != nil {
+					if err := s.restoreSession(tctx); err != nil {
+						log.Warn().
+							Str("method", "StartProcessQueue").
+							Msgf("Can not restore session of account %s: %s", s.account.name, err.Error())
+					}
+				}
 
-				err = s.scrape(tctx, &board)
+				if err := s.login(tctx, &board); err != nil {
+					log.Error().
+						Str("method", "StartProcessQueue").
+						Msgf("Error during login: %s", err.Error())
+					// Public boards can still be scraped. So the job goes on
+					// but the login form is kept for troubleshooting.
+					if config.CaptureOnFailure {
+						s.captureArtifacts(tab.ctx, board.UUID, "login-failure-")
+					}
+					// Boards are only queued with an account to see what
+					// the account sees.
+					if s.account != nil {
+						updateJob(&board, job.StatusFailed, fmt.Sprintf("Login with account %s failed: %s", s.account.name, err.Error()))
+						return
+					}
+				}
+				s.captureStep(tctx, board.UUID, "login")
+
+				start := time.Now()
+				outcome := "success"
+
+				err = s.openURL(tctx, &board)
+				if err == nil {
+					s.captureStep(tctx, board.UUID, "board")
+					if board.ResolvesBoards() {
+						err = s.resolveBoards(tctx, &board)
+					} else {
+						err = s.scrape(tctx, &board)
+					}
+				}
+				switch {
+				case lock.isLost():
+					err = errors.New("Lost lock of board. Another scraper may work the board now")
+				case err != nil && workCtx.Err() != nil:
+					err = errors.New("Scraper shut down before the board was scraped completely")
+				case err != nil && tctx.Err() == context.DeadlineExceeded:
+					err = fmt.Errorf("Board not scraped completely within %s", config.BoardTimeout)
+				case err != nil && ctx.Err() == nil && tab.ctx.Err() != nil:
+					err = fmt.Errorf("Lost connection to Chrome %s", tab.browser.addr)
+				}
 				if err != nil {
+					outcome = "failure"
 					log.Error().
 						Str("method", "StartProcessQueue").
 						Msgf("Error during scraping: %s", err.Error())
+
+					// The tab is gone if the scrape was aborted. Besides that
+					// a shutdown must not wait for the capture.
+					if config.CaptureOnFailure && ctx.Err() == nil {
+						s.captureArtifacts(tab.ctx, board.UUID, "failure-")
+					}
+				} else {
+					s.captureStep(tctx, board.UUID, "end")
 				}
 
-				// release slot in buffered channel
-				<-semChan
+				metrics.ScrapeDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+
+				if err != nil {
+					updateJob(&board, job.StatusFailed, err.Error())
+				} else {
+					updateJob(&board, job.StatusDownloading, "")
+				}
 			}(v.Data)
+		case redis.Subscription:
+			if v.Count == 0 {
+				log.Info().
+					Str("method", "StartProcessQueue").
+					Msg("Waiting for boards in flight")
+				shutdown.Drain(&inFlight, config.ShutdownTimeout, abortWork)
+				return nil
+			}
 		case error:
 			// TODO: Needs to be handled
+			shutdown.Drain(&inFlight, config.ShutdownTimeout, abortWork)
 			return v
 		}
 	}
-
 }
@@ -1,7 +1,13 @@
 package scraper
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/chromedp/cdproto/network"
+
+	"github.com/githubixx/pinbackup/board"
 )
 
 type testPinCount struct {
@@ -28,3 +34,204 @@ func TestGetOriginalImage(t *testing.T) {
 		}
 	}
 }
+
+func TestParseResourceTypes(t *testing.T) {
+	types, err := parseResourceTypes(DefaultBlockedResources)
+	if err != nil {
+		t.Fatalf("Got error: %s / Expected: no error", err)
+	}
+	expected := []network.ResourceType{network.ResourceTypeImage, network.ResourceTypeMedia, network.ResourceTypeFont}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("Got: %v / Expected: %v", types, expected)
+	}
+
+	if types, err := parseResourceTypes([]string{" Stylesheet", ""}); err != nil || !reflect.DeepEqual(types, []network.ResourceType{network.ResourceTypeStylesheet}) {
+		t.Errorf("Got: %v, error: %v / Expected: [Stylesheet]", types, err)
+	}
+
+	// Blocking scripts or documents would break the board.
+	for _, name := range []string{"script", "document", "xhr", "unknown"} {
+		if _, err := parseResourceTypes([]string{name}); err == nil {
+			t.Errorf("Got: no error / Expected: error for %s", name)
+		}
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	s := scraper{config: &Config{}}
+	if strategies := s.strategies(); !reflect.DeepEqual(strategies, pinStrategies) {
+		t.Errorf("Got: %v / Expected: %v", strategies, pinStrategies)
+	}
+
+	s.config.SelectorPreviewPins = ".hCL.kVc.L4E.MIw"
+	strategies := s.strategies()
+	if len(strategies) != len(pinStrategies)+1 || strategies[0].Name != "configured" || strategies[0].Selector != ".hCL.kVc.L4E.MIw" {
+		t.Errorf("Got: %v / Expected: configured selector first", strategies)
+	}
+}
+
+func TestRenderJs(t *testing.T) {
+	js := renderJsDiscoverPins([]pinStrategy{{"quotes", `[data-test-id="pin"] img`}})
+	if !strings.Contains(js, `})(["[data-test-id=\"pin\"] img"])`) {
+		t.Errorf("Got: %s / Expected: selectors as JSON array", js)
+	}
+
+	js = renderJsScrollIntoView(`img[alt='pin']`)()
+	// = is escaped too which is still valid JavaScript.
+	if !strings.Contains(js, `document.querySelectorAll('img[alt\u003D\'pin\']')`) {
+		t.Errorf("Got: %s / Expected: escaped selector", js)
+	}
+}
+
+func TestPinPreviewMedia(t *testing.T) {
+	const (
+		srcset = "https://i.pinimg.com/236x/93/74/99/93749980da966aef00c4e18d1000f4e1.jpg 1x, https://i.pinimg.com/originals/93/74/99/93749980da966aef00c4e18d1000f4e1.jpg 4x"
+		poster = "https://i.pinimg.com/originals/93/74/99/93749980da966aef00c4e18d1000f4e1.jpg"
+		gif    = "https://i.pinimg.com/originals/49/18/b7/4918b740da399c815f6fdba556a0fb2b.gif"
+		hls    = "https://v1.pinimg.com/videos/mc/hls/e9/48/9b/e9489b231c1c8393622c6eec79c5e6f8.m3u8"
+		mp4    = "https://v1.pinimg.com/videos/mc/720p/e9/48/9b/e9489b231c1c8393622c6eec79c5e6f8.mp4"
+	)
+
+	var mediaTests = []struct {
+		name    string
+		preview pinPreview
+		media   []media
+	}{
+		{"image", pinPreview{Srcset: srcset}, []media{{poster, KindImage}}},
+		{"gif in src", pinPreview{Srcset: srcset, Src: gif}, []media{{gif, KindGIF}}},
+		{"gif in srcset", pinPreview{Srcset: "https://i.pinimg.com/236x/49/18/b7/4918b740da399c815f6fdba556a0fb2b.jpg 1x, " + gif + " 4x"}, []media{{gif, KindGIF}}},
+		{"hls", pinPreview{Srcset: srcset, Videos: []string{hls}}, []media{{hls, KindHLS}}},
+		{"mp4 preferred", pinPreview{Srcset: srcset, Videos: []string{hls, mp4}}, []media{{mp4, KindVideo}}},
+		{"blob video", pinPreview{Srcset: srcset, Videos: []string{"blob:https://www.pinterest.com/8c2f"}}, []media{{poster, KindImage}}},
+		{"no originals", pinPreview{Srcset: "https://i.pinimg.com/236x/93/74/99/93749980da966aef00c4e18d1000f4e1.jpg 1x"}, nil},
+	}
+
+	for _, test := range mediaTests {
+		if got := test.preview.media(); !reflect.DeepEqual(got, test.media) {
+			t.Errorf("%s: Got: %v / Expected: %v", test.name, got, test.media)
+		}
+	}
+
+	idea := pinPreview{Srcset: srcset, Link: "https://www.pinterest.com/pin/123/", Pages: true}
+	if !idea.idea() || idea.key() != idea.Link {
+		t.Errorf("Got: idea %t key %s / Expected: idea pin keyed by link", idea.idea(), idea.key())
+	}
+}
+
+func TestBoardPageMeta(t *testing.T) {
+	b := &board.Board{Host: "www.pinterest.com", User: "pinner", Path: "recipes"}
+	page := boardPage{
+		Title:         "Recipes",
+		Description:   "Food",
+		Cover:         "https://i.pinimg.com/200x150/aa/bb/cc/aabbcc.jpg",
+		Secret:        true,
+		Collaborators: []string{"https://www.pinterest.com/pinner/", "https://www.pinterest.com/bob/", "https://www.pinterest.com/alice/", "https://www.pinterest.com/bob/"},
+		Sections: []string{
+			"https://www.pinterest.com/pinner/recipes/desserts/",
+			"https://www.pinterest.com/pinner/recipes/cakes/",
+			"https://www.pinterest.com/pinner/other/cakes/",
+			"https://www.pinterest.com/pinner/recipes/",
+		},
+	}
+
+	meta := page.meta(b)
+	if meta.Title != "Recipes" || meta.Privacy != "secret" || meta.Cover != page.Cover {
+		t.Errorf("Got: %+v / Expected: title, privacy and cover of the page", meta)
+	}
+	if expected := []string{"alice", "bob"}; !reflect.DeepEqual(meta.Collaborators, expected) {
+		t.Errorf("Got: %v / Expected: %v", meta.Collaborators, expected)
+	}
+	if expected := []string{"recipes/cakes", "recipes/desserts"}; !reflect.DeepEqual(meta.Sections, expected) {
+		t.Errorf("Got: %v / Expected: %v", meta.Sections, expected)
+	}
+
+	page.Cover = "javascript:alert(1)"
+	if meta := page.meta(b); meta.Cover != "" {
+		t.Errorf("Got: %s / Expected: no cover", meta.Cover)
+	}
+}
+
+func TestFoundBoard(t *testing.T) {
+	saved := &board.Board{User: "pinner", Path: "_saved", Source: board.SourceSaved}
+	following := &board.Board{User: "pinner", Path: "following", Source: board.SourceFollowing}
+
+	var foundTests = []struct {
+		source *board.Board
+		link   string
+		board  string
+	}{
+		{saved, "https://www.pinterest.com/pinner/recipes/", "pinner/recipes"},
+		{saved, "https://www.pinterest.com/other/cars/", ""},
+		{saved, "https://www.pinterest.com/pinner/recipes/desserts/", ""},
+		{saved, "https://www.pinterest.com/pinner/_saved/", ""},
+		{saved, "https://www.pinterest.com/pinner/", ""},
+		{saved, "https://www.pinterest.com/ideas/cars/", ""},
+		{following, "https://www.pinterest.com/other/cars/", "other/cars"},
+		{following, "https://www.pinterest.com/pinner/recipes/", ""},
+		{following, "https://www.pinterest.com/other/following/", ""},
+		{following, "https://www.pinterest.com/pinbackup/users/", ""},
+	}
+
+	for _, test := range foundTests {
+		user, path := foundBoard(test.source, test.link)
+		found := ""
+		if user != "" {
+			found = user + "/" + path
+		}
+		if found != test.board {
+			t.Errorf("%s on %s: Got: %q / Expected: %q", test.link, test.source.Path, found, test.board)
+		}
+	}
+}
+
+func TestCookieParams(t *testing.T) {
+	cookies := []*network.Cookie{
+		{Name: "_auth", Value: "1", Domain: ".pinterest.com", Path: "/", Expires: 1700000000.5, Secure: true, HTTPOnly: true},
+		{Name: "csrftoken", Value: "abc", Domain: ".pinterest.com", Path: "/", Expires: -1, Session: true},
+	}
+
+	params := cookieParams(cookies)
+	if len(params) != 2 {
+		t.Fatalf("Got: %d cookies / Expected: %d", len(params), 2)
+	}
+	if p := params[0]; p.Name != "_auth" || !p.Secure || !p.HTTPOnly || p.Expires == nil || p.Expires.Time().Unix() != 1700000000 {
+		t.Errorf("Got: %+v / Expected: persistent cookie _auth", p)
+	}
+	if p := params[1]; p.Expires != nil {
+		t.Errorf("Got: expires %v / Expected: session cookie", p.Expires.Time())
+	}
+}
+
+func TestHARRedactsSecrets(t *testing.T) {
+	r := &recorder{requests: map[network.RequestID]*harRequest{}}
+	r.handle(&network.EventRequestWillBeSent{
+		RequestID: "1",
+		Request: &network.Request{
+			Method:   "POST",
+			URL:      "https://www.pinterest.com/login/",
+			Headers:  network.Headers{"Content-Type": "application/x-www-form-urlencoded", "Cookie": "_auth=session"},
+			PostData: "id=alice%40example.com&password=hunter2",
+		},
+	})
+	r.handle(&network.EventResponseReceived{
+		RequestID: "1",
+		Response: &network.Response{
+			Status:  302,
+			Headers: network.Headers{"Set-Cookie": "_auth=newsession", "Location": "/"},
+		},
+	})
+
+	data, err := r.har()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"hunter2", "alice%40example.com", "_auth=session", "_auth=newsession"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Got: %q in HAR / Expected: redacted", secret)
+		}
+	}
+	if !strings.Contains(string(data), "application/x-www-form-urlencoded") {
+		t.Error("Got: no content type / Expected: headers without secrets are kept")
+	}
+}
@@ -0,0 +1,125 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/rs/zerolog/log"
+)
+
+// discoverInterval is how often the strategies are tried until the first
+// pins appear.
+const discoverInterval = time.Second
+
+// pinStrategy is a way to find the preview pictures of pins. Selector
+// selects img elements whose srcset contains the link to the original
+// picture.
+type pinStrategy struct {
+	Name     string
+	Selector string
+}
+
+// pinStrategies are tried in order until one finds preview pictures. They
+// rely on the structure of the page instead of the obfuscated class names
+// that change whenever Pinterest deploys. The first ones are the most
+// specific so recommendations next to the board aren't mistaken for pins.
+var pinStrategies = []pinStrategy{
+	{"data-test-id pin", `[data-test-id="pin"] img[srcset*="/originals/"]`},
+	{"data-test-id pinWrapper", `[data-test-id="pinWrapper"] img[srcset*="/originals/"]`},
+	{"grid item", `[data-grid-item] img[srcset*="/originals/"]`},
+	{"list item", `[role="listitem"] img[srcset*="/originals/"]`},
+	{"originals srcset", `img[srcset*="/originals/"]`},
+}
+
+// jsDiscoverPins returns the index of the first selector that matches an
+// img element linking to an original picture or -1.
+const jsDiscoverPins = `
+(function(selectors) {
+	for (var i = 0; i < selectors.length; i++) {
+		var images;
+		try {
+			images = document.querySelectorAll(selectors[i]);
+		} catch (e) {
+			continue;
+		}
+		for (var j = 0; j < images.length; j++) {
+			if (images[j].srcset && images[j].srcset.indexOf("/originals/") !== -1) {
+				return i;
+			}
+		}
+	}
+	return -1;
+})(%s)
+`
+
+// strategies returns the strategies to try. A configured selector is tried
+// first.
+func (s *scraper) strategies() []pinStrategy {
+	if s.config.SelectorPreviewPins == "" {
+		return pinStrategies
+	}
+
+	return append([]pinStrategy{{"configured", s.config.SelectorPreviewPins}}, pinStrategies...)
+}
+
+// renderJsDiscoverPins returns the JavaScript code trying the strategies.
+func renderJsDiscoverPins(strategies []pinStrategy) string {
+	selectors := make([]string, 0, len(strategies))
+	for _, strategy := range strategies {
+		selectors = append(selectors, strategy.Selector)
+	}
+
+	// JSON is valid JavaScript so the selectors need no further escaping.
+	encoded, err := json.Marshal(selectors)
+	if err != nil {
+		// Marshaling strings never fails.
+		panic(err)
+	}
+
+	return fmt.Sprintf(jsDiscoverPins, encoded)
+}
+
+// discoverPins waits until one of the strategies finds preview pictures and
+// returns it.
+func (s *scraper) discoverPins(ctx context.Context) (pinStrategy, error) {
+	strategies := s.strategies()
+	js := renderJsDiscoverPins(strategies)
+	found := -1
+
+	err := s.runStep(ctx, "waiting for pins. No strategy found preview pictures. Pinterest may have changed the page or shows a captcha", chromedp.ActionFunc(func(ctx context.Context) error {
+		for {
+			if err := chromedp.Evaluate(js, &found).Do(ctx); err != nil {
+				return err
+			}
+			if found >= 0 {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(discoverInterval):
+			}
+		}
+	}))
+	if err != nil {
+		return pinStrategy{}, err
+	}
+
+	strategy := strategies[found]
+
+	if s.config.SelectorPreviewPins != "" && strategy.Name != "configured" {
+		log.Warn().
+			Str("method", "discoverPins").
+			Msgf("Configured selector %s found no pins. It may be outdated", s.config.SelectorPreviewPins)
+	}
+
+	log.Info().
+		Str("method", "discoverPins").
+		Msgf("Found preview pins with strategy %s: %s", strategy.Name, strategy.Selector)
+
+	return strategy, nil
+}
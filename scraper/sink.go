@@ -0,0 +1,158 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/board"
+	"github.com/githubixx/pinbackup/events"
+	"github.com/githubixx/pinbackup/job"
+	redisClient "github.com/githubixx/pinbackup/redis"
+)
+
+// pinSink receives the pictures found while scraping a board.
+type pinSink interface {
+	// add hands a picture over to the downloader.
+	add(picture Picture) error
+	// discovered reports the number of pins found so far.
+	discovered(count int)
+	// metadata hands over the metadata of the board.
+	metadata(meta *redisClient.BoardMeta) error
+	// found queues a board found on a source page e.g. a board the user
+	// follows.
+	found(user string, path string) error
+}
+
+// redisSink publishes pictures to the download queue and counts them in
+// the job of the board.
+type redisSink struct {
+	conn  redis.Conn
+	queue string
+	board *board.Board
+	// token is the ID of the API token of the job. Boards found on a
+	// source page are queued with it. It's fetched with the first board.
+	token *string
+	// maxActiveJobs is the maximum number of active jobs of the token.
+	maxActiveJobs int
+}
+
+// newRedisSink borrows a Redis connection from the pool. It's returned by
+// close.
+func newRedisSink(queue string, b *board.Board) (*redisSink, error) {
+	conn, err := redisClient.GetConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisSink{conn: conn, queue: queue, board: b}, nil
+}
+
+// openSink returns the sink of the scraper or a new redisSink for board b.
+// The returned function releases the sink.
+func (s *scraper) openSink(b *board.Board) (pinSink, func(), error) {
+	if s.sink != nil {
+		return s.sink, func() {}, nil
+	}
+
+	log.Trace().
+		Str("method", "openSink").
+		Msgf("Borrow Redis connection from pool.")
+
+	redisSink, err := newRedisSink(s.config.DownloadQueue, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	redisSink.maxActiveJobs = s.config.MaxActiveJobs
+
+	return redisSink, redisSink.close, nil
+}
+
+func (r *redisSink) add(picture Picture) error {
+	message, err := json.Marshal(picture)
+	if err != nil {
+		return errors.New("Can not decode picture object")
+	}
+
+	if err := redisClient.Publish(r.conn, r.queue, message); err != nil {
+		return err
+	}
+
+	return job.IncrPinsFound(r.conn, r.board.UUID)
+}
+
+func (r *redisSink) discovered(count int) {
+	events.Publish(r.conn, events.Event{
+		Type:  events.TypePinsDiscovered,
+		UUID:  r.board.UUID,
+		User:  r.board.User,
+		Path:  r.board.Path,
+		Count: count,
+	})
+}
+
+// metadata stores the metadata in Redis and makes the downloader store it
+// next to the pictures. It doesn't count as pin of the job.
+func (r *redisSink) metadata(meta *redisClient.BoardMeta) error {
+	changes, err := redisClient.SetBoardMeta(r.conn, r.board.User, r.board.Path, meta)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		log.Info().
+			Str("method", "metadata").
+			Msgf("Board %s:%s changed %s: %q -> %q added: %v removed: %v", r.board.User, r.board.Path, change.Field, change.Old, change.New, change.Added, change.Removed)
+	}
+
+	message, err := json.Marshal(Picture{
+		Url:          meta.Cover,
+		Kind:         KindBoard,
+		Host:         r.board.Host,
+		User:         r.board.User,
+		Path:         r.board.Path,
+		PathSegments: r.board.PathSegments,
+		UUID:         r.board.UUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return redisClient.Publish(r.conn, r.queue, message)
+}
+
+// found creates a job for a board found on a source page. The board is
+// published to the boards queue and scraped like any other board.
+func (r *redisSink) found(user string, path string) error {
+	if r.token == nil {
+		j, err := job.Get(r.conn, r.board.UUID)
+		if err != nil {
+			return err
+		}
+		r.token = &j.Token
+	}
+
+	found, err := board.PublishFound(r.conn, r.board, *r.token, r.maxActiveJobs, user, path)
+	if board.IsAccountConflict(err) {
+		// The other boards of the page are still queued.
+		log.Warn().
+			Str("method", "found").
+			Msgf("Can not queue board %s:%s found on %s:%s: %s", user, path, r.board.User, r.board.Path, err.Error())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("method", "found").
+		Msgf("Queued board %s:%s found on %s:%s as job %s", found.User, found.Path, r.board.User, r.board.Path, found.UUID)
+
+	return nil
+}
+
+func (r *redisSink) close() {
+	r.conn.Close()
+}
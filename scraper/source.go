@@ -0,0 +1,116 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chromedp/chromedp"
+	"github.com/rs/zerolog/log"
+
+	"github.com/githubixx/pinbackup/board"
+)
+
+// jsScrollLinks scrolls to the end of the page which makes Pinterest load
+// further boards and returns the targets of all links currently in the DOM.
+const jsScrollLinks = `
+(function() {
+	window.scrollTo(0, document.body.scrollHeight);
+	return [].map.call(document.querySelectorAll('a[href]'), a => a.href);
+})()
+`
+
+// foundBoard returns the user and path of the board a link found on the
+// page of source b points to. They are empty if the link doesn't point to
+// a board of interest. The saved page lists the boards of the user and
+// the following page the boards of others the user follows.
+func foundBoard(b *board.Board, link string) (string, string) {
+	segments := linkPath(link)
+	if !board.IsBoardPath(segments) {
+		return "", ""
+	}
+
+	own := segments[0] == b.User
+	if (b.Source == board.SourceSaved && !own) || (b.Source == board.SourceFollowing && own) {
+		return "", ""
+	}
+
+	return segments[0], segments[1]
+}
+
+// resolveBoards scrolls through a source page listing boards e.g. the
+// boards a user follows and queues every board found. The boards are
+// scraped by jobs of their own.
+func (s *scraper) resolveBoards(browserCtx context.Context, b *board.Board) error {
+	var (
+		config = s.config
+		boards = newStringSet()
+		// Number of scrolls in a row that didn't reveal new boards
+		stalledScrolls = 0
+	)
+
+	stallScrolls := config.StallScrolls
+	if stallScrolls < 1 {
+		stallScrolls = 1
+	}
+
+	sink, closeSink, err := s.openSink(b)
+	if err != nil {
+		return err
+	}
+	defer closeSink()
+
+	s.captureStep(browserCtx, b.UUID, "boards")
+
+	for scrolls := 1; ; scrolls++ {
+		if config.MaxScrolls > 0 && scrolls > config.MaxScrolls {
+			return fmt.Errorf("Stopped after %d scrolls with %d boards found. The end of the page wasn't reached", config.MaxScrolls, boards.Size())
+		}
+
+		var links []string
+		err := s.runStep(browserCtx, fmt.Sprintf("scrolling after %d boards", boards.Size()),
+			chromedp.Sleep(scrollDelay),
+			chromedp.Evaluate(jsScrollLinks, &links),
+		)
+		if err != nil {
+			return err
+		}
+
+		newBoards := 0
+		for _, link := range links {
+			user, path := foundBoard(b, link)
+			if user == "" || boards.Has(user+"/"+path) {
+				continue
+			}
+
+			err := sink.found(user, path)
+			if board.IsJobLimit(err) {
+				return fmt.Errorf("Queued %d boards found on %s:%s before the limit of active jobs was reached: %s. Queue the page again when some jobs are done", boards.Size(), b.User, b.Path, err.Error())
+			}
+			if err != nil {
+				return err
+			}
+			boards.Add(user + "/" + path)
+			newBoards++
+		}
+
+		if newBoards > 0 {
+			stalledScrolls = 0
+			continue
+		}
+
+		stalledScrolls++
+		if stalledScrolls >= stallScrolls {
+			break
+		}
+	}
+
+	if boards.Size() == 0 {
+		return fmt.Errorf("Found no boards on %s:%s", b.User, b.Path)
+	}
+
+	log.Info().
+		Str("method", "resolveBoards").
+		Msgf("Queued %d boards found on %s:%s", boards.Size(), b.User, b.Path)
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// unixPrefix marks listen addresses of unix sockets e.g.
+	// unix:/run/pinbackup.sock
+	unixPrefix = "unix:"
+	// socketMode allows the owner and the group to connect to the socket
+	// e.g. a reverse proxy running as a member of the group.
+	socketMode = 0660
+)
+
+// Listen returns a TCP listener for addresses like 0.0.0.0:3333 or :3333
+// and a unix socket listener for addresses like unix:/run/pinbackup.sock.
+// A socket left over by a previous run is removed first.
+func Listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, unixPrefix) {
+		return net.Listen("tcp", address)
+	}
+
+	path := strings.TrimPrefix(address, unixPrefix)
+	if path == "" {
+		return nil, errors.New("Unix socket path is empty")
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrap(err, "Can't remove old socket")
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, socketMode); err != nil {
+		l.Close()
+		return nil, errors.Wrap(err, "Can't set permissions of socket")
+	}
+
+	return l, nil
+}
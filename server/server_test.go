@@ -0,0 +1,140 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "pinbackup.sock")
+
+	// A socket left over by a previous run must not prevent listening.
+	for i := 0; i < 2; i++ {
+		l, err := Listen("unix:" + socket)
+		if err != nil {
+			t.Fatalf("Got error: %s / Expected: no error", err)
+		}
+		if l.Addr().Network() != "unix" {
+			t.Errorf("Got: %s / Expected: unix", l.Addr().Network())
+		}
+		info, err := os.Stat(socket)
+		if err != nil || info.Mode().Perm() != socketMode {
+			t.Errorf("Got mode: %v, error: %v / Expected: %v", info.Mode().Perm(), err, os.FileMode(socketMode))
+		}
+
+		// Closing a unix listener removes the socket. Keep it to simulate
+		// a crash.
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+	}
+
+	file := filepath.Join(dir, "file")
+	ioutil.WriteFile(file, []byte("data"), 0600)
+	if _, err := Listen("unix:" + file); err == nil {
+		t.Errorf("Got: no error / Expected: error as %s is no socket", file)
+	}
+
+	if _, err := Listen("unix:"); err == nil {
+		t.Errorf("Got: no error / Expected: error for empty socket path")
+	}
+
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Got error: %s / Expected: no error", err)
+	}
+	defer l.Close()
+	if l.Addr().Network() != "tcp" {
+		t.Errorf("Got: %s / Expected: tcp", l.Addr().Network())
+	}
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := SelfSignedCertificate([]string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Got error: %s / Expected: no error", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Got error: %s / Expected: no error", err)
+	}
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("Got error: %s / Expected: certificate valid for localhost", err)
+	}
+	if err := leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("Got error: %s / Expected: certificate valid for 127.0.0.1", err)
+	}
+	if err := leaf.VerifyHostname("example.com"); err == nil {
+		t.Errorf("Got: no error / Expected: certificate not valid for example.com")
+	}
+}
+
+// writeCertificate writes a new self-signed certificate for host to
+// certFile and keyFile.
+func writeCertificate(t *testing.T, host string, certFile string, keyFile string) {
+	cert, err := SelfSignedCertificate([]string{host})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	writeCertificate(t, "old.example.com", certFile, keyFile)
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Got error: %s / Expected: no error", err)
+	}
+
+	dnsName := func() string {
+		cert, _ := reloader.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.DNSNames[0]
+	}
+
+	if name := dnsName(); name != "old.example.com" {
+		t.Errorf("Got: %s / Expected: old.example.com", name)
+	}
+
+	writeCertificate(t, "new.example.com", certFile, keyFile)
+	// Make sure the modification time changes on filesystems with coarse
+	// timestamps.
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	if name := dnsName(); name != "new.example.com" {
+		t.Errorf("Got: %s / Expected: new.example.com", name)
+	}
+
+	// A broken key keeps the previous certificate.
+	ioutil.WriteFile(keyFile, []byte("broken"), 0600)
+	evenLater := later.Add(time.Minute)
+	os.Chtimes(keyFile, evenLater, evenLater)
+
+	if name := dnsName(); name != "new.example.com" {
+		t.Errorf("Got: %s / Expected: new.example.com", name)
+	}
+}
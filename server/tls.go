@@ -0,0 +1,198 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// selfSignedValidity is how long a self-signed certificate is valid. It's
+// created again on every start.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// CertReloader serves a certificate and key from files. The files are
+// loaded again if they changed e.g. after a renewal by certbot so the
+// server doesn't need to be restarted.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// NewCertReloader loads the certificate and key from the given files.
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// modTimes returns the modification times of the certificate and the key.
+func (r *CertReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// reload loads the certificate and key if they changed since they were
+// loaded the last time.
+func (r *CertReloader) reload() error {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert != nil && certModTime.Equal(r.certModTime) && keyModTime.Equal(r.keyModTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "Can't load TLS certificate")
+	}
+
+	if r.cert != nil {
+		log.Info().
+			Str("method", "reload").
+			Msgf("Reloaded TLS certificate %s", r.certFile)
+	}
+
+	r.cert = &cert
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+
+	return nil
+}
+
+// GetCertificate returns the current certificate. It's meant for
+// tls.Config.GetCertificate. If the files changed but can't be loaded e.g.
+// because only the certificate was written yet, the previous certificate is
+// returned.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if err := r.reload(); err != nil {
+		log.Error().
+			Str("method", "GetCertificate").
+			Msg(err.Error())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cert, nil
+}
+
+// SelfSignedCertificate creates a certificate for hosts signed by itself.
+// hosts may contain host names and IP addresses.
+func SelfSignedCertificate(hosts []string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"pinbackup"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        template,
+	}, nil
+}
+
+// selfSignedHosts returns the names the server is usually reached by
+// locally.
+func selfSignedHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+
+	return hosts
+}
+
+// TLSConfig returns the TLS configuration of the server. If certFile and
+// keyFile are set they are served and reloaded on change. Otherwise a
+// self-signed certificate is created if selfSigned is set. Returns nil if
+// TLS is disabled.
+func TLSConfig(certFile string, keyFile string, selfSigned bool) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch {
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("TLS needs a certificate and a key file")
+		}
+		reloader, err := NewCertReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+
+	case selfSigned:
+		cert, err := SelfSignedCertificate(selfSignedHosts())
+		if err != nil {
+			return nil, errors.Wrap(err, "Can't create self-signed certificate")
+		}
+		log.Warn().
+			Str("method", "TLSConfig").
+			Msg("Using a self-signed TLS certificate. Clients have to skip verification")
+		config.Certificates = []tls.Certificate{*cert}
+
+	default:
+		return nil, nil
+	}
+
+	return config, nil
+}
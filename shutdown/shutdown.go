@@ -0,0 +1,72 @@
+package shutdown
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// abortTimeout is how long Drain waits for aborted work. Work that doesn't
+// honor the cancellation must not block the shutdown forever.
+var abortTimeout = 5 * time.Second
+
+// Context returns a context that is canceled on SIGINT or SIGTERM. The
+// server, the scraper and the downloader stop accepting new work then, drain
+// the work in flight and close the Redis pool afterwards. A second signal
+// isn't caught anymore and terminates the process immediately.
+func Context() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-c:
+			log.Debug().
+				Str("method", "Context").
+				Msgf("Received %s. Shutting down", s)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(c)
+	}()
+
+	return ctx, cancel
+}
+
+// Drain waits until the work tracked by wg is done. If it takes longer than
+// timeout cancel is called to abort the work and Drain waits up to
+// abortTimeout again. Returns false if the work had to be aborted.
+func Drain(wg *sync.WaitGroup, timeout time.Duration, cancel context.CancelFunc) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+	}
+
+	log.Warn().
+		Str("method", "Drain").
+		Msgf("Work not done after %s. Aborting", timeout)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(abortTimeout):
+		log.Error().
+			Str("method", "Drain").
+			Msgf("Aborted work not done after %s. Giving up", abortTimeout)
+	}
+
+	return false
+}
@@ -0,0 +1,55 @@
+package shutdown
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	saved := abortTimeout
+	abortTimeout = 50 * time.Millisecond
+	defer func() { abortTimeout = saved }()
+
+	var testWork = []struct {
+		duration time.Duration
+		timeout  time.Duration
+		// ignoreCancel is work that keeps running after cancel.
+		ignoreCancel bool
+		result       bool
+	}{
+		{0, time.Second, false, true},
+		{10 * time.Millisecond, time.Second, false, true},
+		{time.Minute, 10 * time.Millisecond, false, false},
+		{time.Minute, 10 * time.Millisecond, true, false},
+	}
+
+	for _, test := range testWork {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func(duration time.Duration, ignoreCancel bool) {
+			defer wg.Done()
+			if ignoreCancel {
+				time.Sleep(duration)
+				return
+			}
+			select {
+			case <-time.After(duration):
+			case <-ctx.Done():
+			}
+		}(test.duration, test.ignoreCancel)
+
+		start := time.Now()
+		result := Drain(&wg, test.timeout, cancel)
+		if elapsed := time.Since(start); elapsed > test.timeout+time.Second {
+			t.Errorf("Got: Drain returned after %s / Expected: at most %s", elapsed, test.timeout+abortTimeout)
+		}
+		if result != test.result {
+			t.Errorf("Got: %v / Expected: %v for work of %s with timeout %s", result, test.result, test.duration, test.timeout)
+		}
+		cancel()
+	}
+}
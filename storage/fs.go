@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FS stores pictures in the local filesystem below Path. The directory
+// structure is Path/user/board/picture.
+type FS struct {
+	Path string
+}
+
+// NewFS returns a filesystem storage storing pictures below path.
+func NewFS(path string) (*FS, error) {
+	if path == "" {
+		return nil, errors.New("Path needed for filesystem storage")
+	}
+
+	return &FS{Path: path}, nil
+}
+
+// dir returns the directory of a user or board.
+func (f *FS) dir(user string, board string) string {
+	return filepath.Join(f.Path, user, filepath.FromSlash(board))
+}
+
+// subDirectories returns the names of all directories in dir.
+func subDirectories(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+
+	return dirs, nil
+}
+
+// Users returns all directories in Path.
+func (f *FS) Users() ([]string, error) {
+	users, err := subDirectories(f.Path)
+	if err == ErrNotExist {
+		return []string{}, nil
+	}
+
+	return users, err
+}
+
+// Boards returns all board directories of a user and their section
+// directories e.g. "board" and "board/section".
+func (f *FS) Boards(user string) ([]string, error) {
+	if err := validate(user, "", ""); err != nil {
+		return nil, err
+	}
+
+	boards, err := subDirectories(f.dir(user, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, board := range boards {
+		result = append(result, board)
+
+		sections, err := subDirectories(f.dir(user, board))
+		if err != nil {
+			return nil, err
+		}
+		for _, section := range sections {
+			result = append(result, board+"/"+section)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// Pictures returns all files of a board directory sorted by name except the
+// metadata of the board.
+func (f *FS) Pictures(user string, board string) ([]Picture, error) {
+	if err := validate(user, board, ""); err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(f.dir(user, board))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pictures := []Picture{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || IsMetaFile(entry.Name()) {
+			continue
+		}
+		pictures = append(pictures, Picture{Name: entry.Name(), Size: entry.Size(), ModTime: entry.ModTime()})
+	}
+
+	return pictures, nil
+}
+
+// Stat returns information about a single file of a board.
+func (f *FS) Stat(user string, board string, name string) (*Picture, error) {
+	if err := validate(user, board, name); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filepath.Join(f.dir(user, board), name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, ErrNotExist
+	}
+
+	return &Picture{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Open opens a file of a board for reading.
+func (f *FS) Open(user string, board string, name string) (io.ReadSeekCloser, *Picture, error) {
+	picture, err := f.Stat(user, board, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(filepath.Join(f.dir(user, board), name))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, picture, nil
+}
+
+// fsWriter writes a file to a hidden temporary file next to it. It's
+// renamed to the name of the file on Close.
+type fsWriter struct {
+	*os.File
+	name string
+	done bool
+}
+
+// Close stores the file under its name.
+func (w *fsWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+
+	err := w.File.Close()
+	if err == nil {
+		err = os.Chmod(w.File.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(w.File.Name(), w.name)
+	}
+	if err != nil {
+		os.Remove(w.File.Name())
+	}
+
+	return err
+}
+
+// Abort removes the temporary file.
+func (w *fsWriter) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+
+	w.File.Close()
+
+	return os.Remove(w.File.Name())
+}
+
+// Create creates the board directory if needed and the file for writing.
+// Hidden files are ignored by Pictures so the temporary file isn't listed.
+func (f *FS) Create(user string, board string, name string) (Writer, error) {
+	if err := validate(user, board, name); err != nil {
+		return nil, err
+	}
+
+	dir := f.dir(user, board)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile(dir, "."+name+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &fsWriter{File: file, name: filepath.Join(dir, name)}, nil
+}
+
+// Delete removes the board directory.
+func (f *FS) Delete(user string, board string) error {
+	if err := validate(user, board, ""); err != nil {
+		return err
+	}
+	if board == "" {
+		return errors.New("Board needed to delete a board")
+	}
+
+	dir := f.dir(user, board)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return ErrNotExist
+	}
+
+	return os.RemoveAll(dir)
+}
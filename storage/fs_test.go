@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	var testPaths = []struct {
+		user  string
+		board string
+		name  string
+		valid bool
+	}{
+		{"user1", "board", "a.jpg", true},
+		{"user1", "board/section1", "a.jpg", true},
+		{"user1", "", "", true},
+		{"", "board", "", false},
+		{"..", "board", "", false},
+		{"user1", "../board", "", false},
+		{"user1", "board/..", "", false},
+		{"user1", "board", "../a.jpg", false},
+		{"user1", "board", `a\b.jpg`, false},
+		{"user1", "board//section1", "", false},
+	}
+
+	for _, tp := range testPaths {
+		err := validate(tp.user, tp.board, tp.name)
+		if (err == nil) != tp.valid {
+			t.Errorf("%s/%s/%s: Got error: %v / Expected valid: %t", tp.user, tp.board, tp.name, err, tp.valid)
+		}
+	}
+}
+
+func TestFS(t *testing.T) {
+	fs, err := NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, board := range []string{"board", "board/section1"} {
+		file, err := fs.Create("user1", board, "a.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte("picture"))
+		file.Close()
+	}
+
+	// The metadata of a board isn't a picture.
+	for _, name := range []string{BoardMetaFile, CoverFile + ".jpg"} {
+		file, err := fs.Create("user1", "board", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+
+	users, err := fs.Users()
+	if err != nil || len(users) != 1 || users[0] != "user1" {
+		t.Errorf("Got users: %v, error: %v / Expected: [user1]", users, err)
+	}
+
+	boards, err := fs.Boards("user1")
+	if err != nil || len(boards) != 2 || boards[0] != "board" || boards[1] != "board/section1" {
+		t.Errorf("Got boards: %v, error: %v / Expected: [board board/section1]", boards, err)
+	}
+
+	pictures, err := fs.Pictures("user1", "board")
+	if err != nil || len(pictures) != 1 || pictures[0].Name != "a.jpg" || pictures[0].Size != 7 {
+		t.Errorf("Got pictures: %v, error: %v / Expected: a.jpg with 7 bytes", pictures, err)
+	}
+
+	file, _, err := fs.Open("user1", "board/section1", "a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(file)
+	file.Close()
+	if string(content) != "picture" {
+		t.Errorf("Got content: %s / Expected: picture", content)
+	}
+
+	if _, err := fs.Stat("user1", "board", "b.jpg"); err != ErrNotExist {
+		t.Errorf("Got error: %v / Expected: %v", err, ErrNotExist)
+	}
+
+	// Pictures are only stored by Close.
+	aborted, err := fs.Create("user1", "board", "b.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aborted.Write([]byte("trunc"))
+	if _, err := fs.Stat("user1", "board", "b.jpg"); err != ErrNotExist {
+		t.Errorf("Got error: %v / Expected: %v before Close", err, ErrNotExist)
+	}
+	if err := aborted.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	aborted.Close()
+	if _, err := fs.Stat("user1", "board", "b.jpg"); err != ErrNotExist {
+		t.Errorf("Got error: %v / Expected: %v after Abort", err, ErrNotExist)
+	}
+	entries, _ := ioutil.ReadDir(fs.dir("user1", "board"))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			t.Errorf("Got: %s / Expected: temporary file removed", entry.Name())
+		}
+	}
+
+	if err := fs.Delete("user1", "board"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Pictures("user1", "board"); err != ErrNotExist {
+		t.Errorf("Got error: %v / Expected: %v", err, ErrNotExist)
+	}
+}
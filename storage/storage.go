@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Storage is implemented by all backends pictures can be stored in. Pictures
+// are organized by user and board. board is the board path which includes
+// the section in case of sections e.g. "board/section".
+type Storage interface {
+	// Users returns all users with at least one board.
+	Users() ([]string, error)
+	// Boards returns the paths of all boards and sections of a user.
+	Boards(user string) ([]string, error)
+	// Pictures returns all pictures of a board.
+	Pictures(user string, board string) ([]Picture, error)
+	// Stat returns information about a single picture.
+	Stat(user string, board string, name string) (*Picture, error)
+	// Open opens a picture for reading.
+	Open(user string, board string, name string) (io.ReadSeekCloser, *Picture, error)
+	// Create creates a picture for writing. Missing boards are created.
+	Create(user string, board string, name string) (Writer, error)
+	// Delete removes a board including all pictures and sections.
+	Delete(user string, board string) error
+}
+
+// Writer writes a picture. The picture is only stored under its name by
+// Close. Abort discards what was written instead e.g. if the download
+// failed. So a picture is never stored truncated.
+type Writer interface {
+	io.WriteCloser
+	Abort() error
+}
+
+// Picture contains information about a stored picture.
+type Picture struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modtime"`
+}
+
+// The metadata of a board is stored next to its pictures in BoardMetaFile
+// and the cover in a file named CoverFile plus the extension of the
+// picture. They aren't returned as pictures.
+const (
+	BoardMetaFile = "board.json"
+	CoverFile     = "cover"
+)
+
+// IsMetaFile returns true if name is the metadata or the cover of a board.
+func IsMetaFile(name string) bool {
+	return name == BoardMetaFile || strings.HasPrefix(name, CoverFile+".")
+}
+
+// ErrNotExist is returned if a user, board or picture doesn't exist.
+var ErrNotExist = errors.New("Not found in storage")
+
+// New returns the storage backend of type storageType. Currently only "fs"
+// is supported which stores pictures below fsPath.
+func New(storageType string, fsPath string) (Storage, error) {
+	switch storageType {
+	case "fs":
+		return NewFS(fsPath)
+	default:
+		return nil, errors.Errorf("Unsupported storage type %s", storageType)
+	}
+}
+
+// validSegment returns an error if s can't be used as a single path segment
+// e.g. because it's empty or tries to escape the storage directory.
+func validSegment(s string) error {
+	if s == "" || s == "." || s == ".." || strings.ContainsAny(s, `/\`) || strings.ContainsRune(s, 0) {
+		return errors.Errorf("Invalid path segment '%s'", s)
+	}
+
+	return nil
+}
+
+// validate checks user, board and optionally name. board may consist of
+// several segments separated by "/" in case of sections.
+func validate(user string, board string, name string) error {
+	if err := validSegment(user); err != nil {
+		return err
+	}
+
+	if board != "" {
+		for _, segment := range strings.Split(board, "/") {
+			if err := validSegment(segment); err != nil {
+				return err
+			}
+		}
+	}
+
+	if name != "" {
+		if err := validSegment(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
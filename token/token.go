@@ -0,0 +1,192 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ScopeRead allows to query boards e.g. existsboard and countboard.
+	ScopeRead = "read"
+	// ScopeEnqueue allows to enqueue boards for scraping.
+	ScopeEnqueue = "enqueue"
+	// ScopeDelete allows to delete backed up boards.
+	ScopeDelete = "delete"
+
+	// tokensKey is the Redis hash storing all tokens. The field is the
+	// SHA-256 hash of the token, the value the JSON encoded Token.
+	tokensKey = "pinbackup:tokens"
+
+	// prefix makes pinbackup tokens easy to recognize e.g. in secret scanners.
+	prefix = "pb_"
+)
+
+// Scopes contains all valid scopes.
+var Scopes = []string{ScopeRead, ScopeEnqueue, ScopeDelete}
+
+// ErrInvalidToken is returned if a token doesn't exist.
+var ErrInvalidToken = errors.New("Invalid API token")
+
+// Token describes an API token. The token itself is never stored, only
+// its SHA-256 hash.
+type Token struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+// HasScope returns true if the token was granted scope.
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hash returns the hex encoded SHA-256 hash of a token.
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes hex encoded.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// validateScopes returns an error if scopes is empty or contains an unknown
+// scope.
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("At least one scope is required")
+	}
+
+	for _, scope := range scopes {
+		valid := false
+		for _, s := range Scopes {
+			if scope == s {
+				valid = true
+			}
+		}
+		if !valid {
+			return errors.Errorf("Unknown scope %s. Valid scopes: %s", scope, strings.Join(Scopes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Create generates a new token with the given name and scopes and stores
+// its hash in Redis. The returned string is the token itself. It's only
+// available at this point and can't be recovered later.
+func Create(conn redis.Conn, name string, scopes []string) (string, *Token, error) {
+	if err := validateScopes(scopes); err != nil {
+		return "", nil, err
+	}
+
+	id, err := randomHex(4)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	plain := prefix + secret
+
+	t := &Token{
+		ID:      id,
+		Name:    name,
+		Scopes:  scopes,
+		Created: time.Now().UTC(),
+	}
+
+	value, err := json.Marshal(t)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, err := conn.Do("HSET", tokensKey, hash(plain), value); err != nil {
+		return "", nil, err
+	}
+
+	return plain, t, nil
+}
+
+// Lookup returns the Token for a plain token or ErrInvalidToken if the
+// token doesn't exist.
+func Lookup(conn redis.Conn, plain string) (*Token, error) {
+	value, err := redis.Bytes(conn.Do("HGET", tokensKey, hash(plain)))
+	if err == redis.ErrNil {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Token{}
+	if err := json.Unmarshal(value, t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// List returns all tokens.
+func List(conn redis.Conn) ([]Token, error) {
+	values, err := redis.StringMap(conn.Do("HGETALL", tokensKey))
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []Token{}
+	for _, value := range values {
+		t := Token{}
+		if err := json.Unmarshal([]byte(value), &t); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, nil
+}
+
+// Revoke deletes the token with the given ID.
+func Revoke(conn redis.Conn, id string) error {
+	values, err := redis.StringMap(conn.Do("HGETALL", tokensKey))
+	if err != nil {
+		return err
+	}
+
+	for field, value := range values {
+		t := Token{}
+		if err := json.Unmarshal([]byte(value), &t); err != nil {
+			return err
+		}
+
+		if t.ID == id {
+			_, err := conn.Do("HDEL", tokensKey, field)
+			return err
+		}
+	}
+
+	return errors.Errorf("Token with ID %s not found", id)
+}
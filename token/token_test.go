@@ -0,0 +1,47 @@
+package token
+
+import (
+	"testing"
+)
+
+func TestHasScope(t *testing.T) {
+	tok := Token{Scopes: []string{ScopeRead}}
+
+	if !tok.HasScope(ScopeRead) {
+		t.Errorf("Token should have scope %s", ScopeRead)
+	}
+
+	if tok.HasScope(ScopeEnqueue) {
+		t.Errorf("Token shouldn't have scope %s", ScopeEnqueue)
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	var testScopes = []struct {
+		scopes []string
+		valid  bool
+	}{
+		{[]string{ScopeRead}, true},
+		{[]string{ScopeRead, ScopeEnqueue}, true},
+		{[]string{}, false},
+		{[]string{"admin"}, false},
+		{[]string{ScopeRead, "admin"}, false},
+	}
+
+	for _, ts := range testScopes {
+		err := validateScopes(ts.scopes)
+		if (err == nil) != ts.valid {
+			t.Errorf("Scopes %v: Got error: %v / Expected valid: %t", ts.scopes, err, ts.valid)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	if hash("pb_secret") == "pb_secret" {
+		t.Error("Token must not be stored in plain text")
+	}
+
+	if hash("pb_secret") != hash("pb_secret") {
+		t.Error("Hash of the same token must be stable")
+	}
+}
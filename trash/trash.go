@@ -0,0 +1,382 @@
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/githubixx/pinbackup/job"
+	redisClient "github.com/githubixx/pinbackup/redis"
+	"github.com/githubixx/pinbackup/storage"
+)
+
+// trashKey is a sorted set containing the IDs of all deleted boards scored
+// by the time they were deleted.
+const trashKey = "pinbackup:trash"
+
+var (
+	// ErrNotFound is returned if a trash entry doesn't exist.
+	ErrNotFound = errors.New("Trash entry not found")
+	// ErrBoardNotFound is returned if the board to delete doesn't exist.
+	ErrBoardNotFound = errors.New("Board not found")
+	// ErrBoardExists is returned if a board can't be restored because it
+	// was backed up again in the meantime.
+	ErrBoardExists = errors.New("Board was backed up again and can't be restored")
+	// ErrBoardActive is returned if the board to delete or one of its
+	// sections has an active job.
+	ErrBoardActive = errors.New("Board has an active job. Delete it when the job is done")
+)
+
+// Entry is a deleted board. Deleting a board also deletes its sections so
+// Paths contains the board path first followed by the section paths.
+// Entries are stored as Redis hash.
+type Entry struct {
+	ID        string   `json:"id" redis:"id"`
+	User      string   `json:"user" redis:"user"`
+	Path      string   `json:"path" redis:"path"`
+	Paths     []string `json:"paths" redis:"-"`
+	Pictures  int      `json:"pictures" redis:"pictures"`
+	KeepFiles bool     `json:"keepfiles" redis:"keepfiles"`
+	Deleted   int64    `json:"deleted" redis:"deleted"`
+}
+
+// key returns the Redis key of a trash entry.
+func key(id string) string {
+	return trashKey + ":" + id
+}
+
+// picturesKey returns the key the picture set of path is moved to.
+func picturesKey(id string, path string) string {
+	return key(id) + ":pictures:" + path
+}
+
+// infoKey returns the key the picture metadata of path is moved to.
+func infoKey(id string, path string) string {
+	return key(id) + ":info:" + path
+}
+
+// metaKey returns the key the board metadata of path is moved to.
+func metaKey(id string, path string) string {
+	return key(id) + ":meta:" + path
+}
+
+// historyKey returns the key the metadata changes of path are moved to.
+func historyKey(id string, path string) string {
+	return key(id) + ":history:" + path
+}
+
+// boardPaths returns board and all indexed sections of board.
+func boardPaths(conn redis.Conn, user string, board string) ([]string, error) {
+	boards, err := redisClient.AllBoards(conn, user)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{board}
+	for _, b := range boards {
+		if strings.HasPrefix(b, board+"/") {
+			paths = append(paths, b)
+		}
+	}
+
+	return paths, nil
+}
+
+// moveKey renames src to dst if src exists.
+func moveKey(conn redis.Conn, src string, dst string) error {
+	_, err := conn.Do("RENAME", src, dst)
+	if err != nil && strings.Contains(err.Error(), "no such key") {
+		return nil
+	}
+
+	return err
+}
+
+// Delete moves a board including its sections into the trash. The board
+// is removed from the index immediately. The pictures and the job history
+// are kept until the entry is purged. If keepFiles is true the stored
+// files are not deleted on purge. Boards with an active job can't be
+// deleted as the job would index the board again.
+func Delete(conn redis.Conn, user string, board string, keepFiles bool) (*Entry, error) {
+	paths, err := boardPaths(conn, user, board)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		active, err := job.GetActive(conn, user, path)
+		if err != nil {
+			return nil, err
+		}
+		if active != nil {
+			log.Info().
+				Str("method", "trash.Delete").
+				Msgf("Can not delete %s:%s while job %s is %s", user, path, active.UUID, active.Status)
+			return nil, ErrBoardActive
+		}
+	}
+
+	entry := &Entry{
+		ID:        strings.ToLower(uuid.NewV4().String()),
+		User:      user,
+		Path:      board,
+		Paths:     paths,
+		KeepFiles: keepFiles,
+		Deleted:   time.Now().Unix(),
+	}
+
+	found := false
+	for _, path := range paths {
+		indexed, err := redisClient.IsBoardIndexed(conn, user, path)
+		if err != nil {
+			return nil, err
+		}
+		count, err := redisClient.CountPictures(conn, user+":"+path)
+		if err != nil {
+			return nil, err
+		}
+		found = found || indexed || count > 0
+		entry.Pictures += count
+	}
+	if !found {
+		return nil, ErrBoardNotFound
+	}
+
+	encodedPaths, _ := json.Marshal(paths)
+	conn.Send("MULTI")
+	conn.Send("HSET", redis.Args{}.Add(key(entry.ID)).AddFlat(entry).Add("paths", encodedPaths)...)
+	conn.Send("ZADD", trashKey, entry.Deleted, entry.ID)
+	if _, err := conn.Do("EXEC"); err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		if err := moveKey(conn, user+":"+path, picturesKey(entry.ID, path)); err != nil {
+			return nil, err
+		}
+		if err := moveKey(conn, redisClient.PictureInfoKey(user, path), infoKey(entry.ID, path)); err != nil {
+			return nil, err
+		}
+		if err := moveKey(conn, redisClient.BoardMetaKey(user, path), metaKey(entry.ID, path)); err != nil {
+			return nil, err
+		}
+		if err := moveKey(conn, redisClient.BoardHistoryKey(user, path), historyKey(entry.ID, path)); err != nil {
+			return nil, err
+		}
+		if err := redisClient.UnindexBoard(conn, user, path); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info().
+		Str("method", "trash.Delete").
+		Msgf("Moved %s:%s into trash %s", user, board, entry.ID)
+
+	return entry, nil
+}
+
+// Get returns the trash entry with the given ID or ErrNotFound.
+func Get(conn redis.Conn, id string) (*Entry, error) {
+	values, err := redis.Values(conn.Do("HGETALL", key(id)))
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+
+	entry := &Entry{}
+	if err := redis.ScanStruct(values, entry); err != nil {
+		return nil, err
+	}
+
+	encodedPaths, err := redis.Bytes(conn.Do("HGET", key(id), "paths"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(encodedPaths, &entry.Paths); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// List returns all trash entries, oldest first.
+func List(conn redis.Conn) ([]*Entry, error) {
+	ids, err := redis.Strings(conn.Do("ZRANGE", trashKey, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*Entry{}
+	for _, id := range ids {
+		entry, err := Get(conn, id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Restore moves a board out of the trash.
+func Restore(conn redis.Conn, id string) (*Entry, error) {
+	entry, err := Get(conn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range entry.Paths {
+		indexed, err := redisClient.IsBoardIndexed(conn, entry.User, path)
+		if err != nil {
+			return nil, err
+		}
+		if indexed {
+			return nil, ErrBoardExists
+		}
+	}
+
+	for _, path := range entry.Paths {
+		if err := moveKey(conn, picturesKey(id, path), entry.User+":"+path); err != nil {
+			return nil, err
+		}
+		if err := moveKey(conn, infoKey(id, path), redisClient.PictureInfoKey(entry.User, path)); err != nil {
+			return nil, err
+		}
+		if err := moveKey(conn, metaKey(id, path), redisClient.BoardMetaKey(entry.User, path)); err != nil {
+			return nil, err
+		}
+		if err := moveKey(conn, historyKey(id, path), redisClient.BoardHistoryKey(entry.User, path)); err != nil {
+			return nil, err
+		}
+		if err := redisClient.IndexBoard(conn, entry.User, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := remove(conn, id); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("method", "trash.Restore").
+		Msgf("Restored %s:%s from trash %s", entry.User, entry.Path, id)
+
+	return entry, nil
+}
+
+// Purge finally deletes a board in the trash including the jobs created
+// before it was deleted and, unless the entry keeps the files, the stored
+// pictures. Files are also kept if the board was backed up again in the
+// meantime as they belong to the new backup then.
+func Purge(conn redis.Conn, s storage.Storage, id string) error {
+	entry, err := Get(conn, id)
+	if err != nil {
+		return err
+	}
+
+	backedUpAgain := false
+	for _, path := range entry.Paths {
+		if _, err := job.DeleteBoard(conn, entry.User, path, entry.Deleted); err != nil {
+			return err
+		}
+
+		indexed, err := redisClient.IsBoardIndexed(conn, entry.User, path)
+		if err != nil {
+			return err
+		}
+		backedUpAgain = backedUpAgain || indexed
+
+		conn.Send("MULTI")
+		conn.Send("DEL", picturesKey(id, path))
+		conn.Send("DEL", infoKey(id, path))
+		conn.Send("DEL", metaKey(id, path), historyKey(id, path))
+		if _, err := conn.Do("EXEC"); err != nil {
+			return err
+		}
+	}
+
+	if !entry.KeepFiles && !backedUpAgain {
+		if err := s.Delete(entry.User, entry.Path); err != nil && err != storage.ErrNotExist {
+			return err
+		}
+	}
+
+	log.Info().
+		Str("method", "trash.Purge").
+		Msgf("Purged %s:%s from trash %s", entry.User, entry.Path, id)
+
+	return remove(conn, id)
+}
+
+// Expire purges all entries deleted longer than period ago. Returns the
+// number of entries purged.
+func Expire(conn redis.Conn, s storage.Storage, period time.Duration) (int, error) {
+	ids, err := redis.Strings(conn.Do("ZRANGEBYSCORE", trashKey, "-inf", time.Now().Add(-period).Unix()))
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := Purge(conn, s, id); err != nil {
+			return i, err
+		}
+	}
+
+	return len(ids), nil
+}
+
+// remove deletes the trash entry itself.
+func remove(conn redis.Conn, id string) error {
+	conn.Send("MULTI")
+	conn.Send("DEL", key(id))
+	conn.Send("ZREM", trashKey, id)
+	_, err := conn.Do("EXEC")
+
+	return err
+}
+
+// StartExpiry purges expired entries every interval until ctx is done.
+func StartExpiry(ctx context.Context, s storage.Storage, period time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		conn, err := redisClient.GetConnection()
+		if err != nil {
+			log.Error().
+				Str("method", "trash.StartExpiry").
+				Msgf("Can not get Redis connection: %s", err.Error())
+			continue
+		}
+
+		purged, err := Expire(conn, s, period)
+		conn.Close()
+		if err != nil {
+			log.Error().
+				Str("method", "trash.StartExpiry").
+				Msgf("Purging expired trash entries failed: %s", err.Error())
+		}
+		if purged > 0 {
+			log.Info().
+				Str("method", "trash.StartExpiry").
+				Msgf("Purged %d expired trash entries", purged)
+		}
+	}
+}
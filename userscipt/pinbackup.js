@@ -1,41 +1,173 @@
 // ==UserScript==
 // @name     pinbackup-scraper
 // @include  https://www.pinterest.*
-// @require  https://code.jquery.com/jquery-3.4.1.js
-// @require  https://gist.github.com/raw/2625891/waitForKeyElements.js
-// @grant    GM_addStyle
-// @grant    GM_xmlhttpRequest
 // @grant    GM_getValue
 // @grant    GM_setValue
+// @grant    GM_registerMenuCommand
 // ==/UserScript==
 
 // Can be used with Tampermonkey extension in Firefox or Chrome e.g.
-// Sends a JSON request with the board URL to the pinbackup REST API
-// to scrape the URL submitted.
-
-waitForKeyElements(".Eqh.wYR.zI7.iyn.Hsu", scrape);
-
-function callServer() {
-    var data = "{\"url\": \"" + window.location.href + "\"}";
-    console.log("JSON request to server: " + data);
-
-    GM_xmlhttpRequest ( {
-    method:     'POST',
-    url:        'http://127.0.0.1:30000/api/v1/board',
-    data:       data,
-    headers: {
-      "Content-Type": "Content-Type: application/json"
-    },
-    onload:     function (responseDetails) {
-                    console.log (
-                        "GM_xmlhttpRequest() response is:\n",
-                        responseDetails.responseText
-                    );
-                }
-    } );
-}
-
-function scrape(jNode) {
-    // Follow button
-    $(".tBJ.dyH.iFc.yTZ.erh.tg7.mWe").click(callServer);
+// Shows a badge in the lower right corner of every board page telling if
+// the board is already backed up. Clicking the badge sends a JSON request
+// with the board URL to the pinbackup REST API to scrape the board.
+//
+// The script uses plain fetch() requests. So the pinbackup server must allow
+// the Pinterest origin e.g.:
+//
+//   pinbackup server --cors-origin https://www.pinterest.com
+//
+// The REST API requires an API token with "read" and "enqueue" scope.
+// Create one with "pinbackup token create --name userscript" and set it
+// together with the server URL via the menu commands of the userscript
+// manager.
+
+var DEFAULT_SERVER_URL = "http://127.0.0.1:8080";
+
+// Path segments that belong to Pinterest pages and not to boards.
+var NON_BOARD_PATHS = ["pin", "search", "ideas", "today", "settings", "business", "login", "_saved", "_created"];
+
+// Pages of a profile that can be backed up besides boards: all pins of the
+// user, the boards of the user and the boards the user follows.
+var SOURCE_PATHS = ["pins", "_saved", "following"];
+
+GM_registerMenuCommand("Set pinbackup server URL", function() {
+    var url = prompt("pinbackup server URL:", serverURL());
+    if (url !== null) {
+        GM_setValue("serverURL", url.trim().replace(/\/+$/, ""));
+        refresh(true);
+    }
+});
+
+GM_registerMenuCommand("Set pinbackup API token", function() {
+    var token = prompt("pinbackup API token:", GM_getValue("apiToken", ""));
+    if (token !== null) {
+        GM_setValue("apiToken", token.trim());
+        refresh(true);
+    }
+});
+
+function serverURL() {
+    return GM_getValue("serverURL", DEFAULT_SERVER_URL);
+}
+
+function callServer(method, path, body) {
+    var options = {
+        method: method,
+        headers: {
+            "Authorization": "Bearer " + GM_getValue("apiToken", "")
+        }
+    };
+
+    if (body !== undefined) {
+        options.headers["Content-Type"] = "application/json";
+        options.body = JSON.stringify(body);
+    }
+
+    return fetch(serverURL() + path, options).then(function(response) {
+        return response.json().then(function(data) {
+            if (!response.ok) {
+                throw new Error(data.error || response.statusText);
+            }
+            return data;
+        });
+    });
+}
+
+// isBoardPage returns true if the current location looks like
+// /user/board/, /user/board/section/ or one of the SOURCE_PATHS e.g.
+// /user/_saved/.
+function isBoardPage() {
+    var segments = window.location.pathname.split("/").filter(function(s) {
+        return s !== "";
+    });
+
+    if (segments.length === 2 && SOURCE_PATHS.indexOf(segments[1]) !== -1) {
+        return NON_BOARD_PATHS.indexOf(segments[0]) === -1;
+    }
+
+    if (segments.length < 2 || segments.length > 3) {
+        return false;
+    }
+
+    return NON_BOARD_PATHS.indexOf(segments[0]) === -1 && NON_BOARD_PATHS.indexOf(segments[1]) === -1;
 }
+
+function boardURL() {
+    return window.location.origin + window.location.pathname;
+}
+
+function badge() {
+    var el = document.getElementById("pinbackup-badge");
+    if (el !== null) {
+        return el;
+    }
+
+    el = document.createElement("div");
+    el.id = "pinbackup-badge";
+    el.style.cssText = "position: fixed; right: 16px; bottom: 16px; z-index: 10000;" +
+        "padding: 8px 14px; border-radius: 16px; font: bold 13px sans-serif;" +
+        "color: #fff; background: #767676; cursor: pointer; box-shadow: 0 2px 6px rgba(0,0,0,.3);";
+    el.addEventListener("click", enqueue);
+    document.body.appendChild(el);
+
+    return el;
+}
+
+function showBadge(text, color, title) {
+    var el = badge();
+    el.textContent = text;
+    el.style.background = color;
+    el.title = title || "";
+    el.style.display = "block";
+}
+
+function enqueue() {
+    showBadge("pinbackup: submitting...", "#767676");
+
+    callServer("POST", "/api/v1/board", {url: boardURL()})
+        .then(function(data) {
+            console.log("pinbackup enqueued board:", data);
+            if (data.existing) {
+                showBadge("pinbackup: already running", "#0074e8", "Job " + data.uuid);
+                return;
+            }
+            showBadge("pinbackup: queued", "#0074e8", "Job " + data.uuid);
+        })
+        .catch(function(err) {
+            showBadge("pinbackup: error", "#e60023", err.message);
+        });
+}
+
+function refresh(force) {
+    if (!isBoardPage()) {
+        var el = document.getElementById("pinbackup-badge");
+        if (el !== null) {
+            el.style.display = "none";
+        }
+        return;
+    }
+
+    var url = boardURL();
+    if (!force && url === refresh.lastURL) {
+        return;
+    }
+    refresh.lastURL = url;
+
+    callServer("GET", "/api/v1/boardstatus?url=" + encodeURIComponent(url))
+        .then(function(status) {
+            if (status.exists) {
+                showBadge("pinbackup: " + status.count + " pins backed up", "#00a86b", "Click to sync again");
+            } else {
+                showBadge("pinbackup: not backed up", "#767676", "Click to back up this board");
+            }
+        })
+        .catch(function(err) {
+            showBadge("pinbackup: unreachable", "#e60023", err.message);
+        });
+}
+
+// Pinterest is a single page application. So the URL changes without the
+// page being reloaded.
+setInterval(function() {
+    refresh(false);
+}, 1000);
@@ -0,0 +1,518 @@
+"use strict";
+
+// Small single page application on top of the pinbackup REST API. The API
+// token is kept in localStorage and sent as Bearer token with every request.
+
+// The job list is refreshed on every event received from the event stream.
+// Polling only makes sure the list is up to date if the stream is down.
+var JOBS_INTERVAL = 10000;
+var EVENTS_RETRY = 5000;
+var EVENTS_DEBOUNCE = 500;
+
+var objectURLs = [];
+
+function token() {
+    return localStorage.getItem("pinbackupToken") || "";
+}
+
+function api(method, path, body) {
+    var options = {
+        method: method,
+        headers: {"Authorization": "Bearer " + token()}
+    };
+
+    if (body !== undefined) {
+        options.headers["Content-Type"] = "application/json";
+        options.body = JSON.stringify(body);
+    }
+
+    return fetch(path, options).then(function(response) {
+        if (response.status === 204) {
+            return null;
+        }
+        if (!response.ok) {
+            return response.json().then(function(data) {
+                throw new Error(data.error || response.statusText);
+            }, function() {
+                throw new Error(response.statusText);
+            });
+        }
+        return response;
+    });
+}
+
+function apiJSON(method, path, body) {
+    return api(method, path, body).then(function(response) {
+        return response === null ? null : response.json();
+    });
+}
+
+// boardPath returns the API path of a board. The board path contains "/"
+// for sections and is therefore encoded as single path segment.
+function boardPath(user, board) {
+    return "/api/v1/board/" + encodeURIComponent(user) + "/" + encodeURIComponent(board);
+}
+
+// pageURL appends the cursor of a page to the path of a paginated list.
+function pageURL(path, cursor) {
+    return cursor ? path + (path.indexOf("?") === -1 ? "?" : "&") + "cursor=" + encodeURIComponent(cursor) : path;
+}
+
+// fetchAll follows the cursors of a paginated list and returns all items.
+function fetchAll(path, cursor, items) {
+    items = items || [];
+    return apiJSON("GET", pageURL(path, cursor)).then(function(page) {
+        items = items.concat(page.items);
+        return page.next ? fetchAll(path, page.next, items) : items;
+    });
+}
+
+function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function(key) {
+        if (key === "onclick") {
+            node.addEventListener("click", attrs[key]);
+        } else {
+            node.setAttribute(key, attrs[key]);
+        }
+    });
+    (children || []).forEach(function(child) {
+        node.appendChild(typeof child === "string" ? document.createTextNode(child) : child);
+    });
+    return node;
+}
+
+function message(id, text, isError) {
+    var node = document.getElementById(id);
+    node.textContent = text;
+    node.className = isError ? "message error" : "message";
+}
+
+function formatTime(unix) {
+    return unix ? new Date(unix * 1000).toLocaleString() : "";
+}
+
+// Jobs
+
+function progressCell(job) {
+    if (job.pinsfound === 0) {
+        return el("td", {}, [job.status === "scraping" ? "collecting pins..." : ""]);
+    }
+    var bar = el("progress", {max: job.pinsfound, value: job.processed});
+    var text = job.processed + "/" + job.pinsfound;
+    if (job.failed > 0) {
+        text += " (" + job.failed + " failed)";
+    }
+    return el("td", {}, [bar, " ", text]);
+}
+
+function renderJobs(jobs) {
+    var body = document.querySelector("#jobs tbody");
+    body.innerHTML = "";
+
+    jobs.forEach(function(job) {
+        var status = el("td", {class: "status-" + job.status, title: job.error || ""}, [job.status]);
+        body.appendChild(el("tr", {}, [
+            el("td", {}, [el("a", {href: job.url, target: "_blank", rel: "noopener"}, [job.user + "/" + job.path])]),
+            status,
+            progressCell(job),
+            el("td", {}, [formatTime(job.created)])
+        ]));
+    });
+}
+
+function refreshJobs() {
+    apiJSON("GET", "/api/v1/jobs")
+        .then(renderJobs)
+        .catch(function() {
+            // Most likely no or an invalid token. The browser section shows
+            // the error already.
+        });
+}
+
+// Events
+
+var refreshTimer = null;
+
+function scheduleRefreshJobs() {
+    if (refreshTimer !== null) {
+        return;
+    }
+    refreshTimer = setTimeout(function() {
+        refreshTimer = null;
+        refreshJobs();
+    }, EVENTS_DEBOUNCE);
+}
+
+// streamEvents reads the Server-Sent Events stream with fetch() instead of
+// EventSource as EventSource can't send the Authorization header.
+function streamEvents() {
+    var buffer = "";
+    var decoder = new TextDecoder();
+
+    api("GET", "/api/v1/events").then(function(response) {
+        var reader = response.body.getReader();
+
+        function read() {
+            return reader.read().then(function(result) {
+                if (result.done) {
+                    throw new Error("event stream closed");
+                }
+
+                buffer += decoder.decode(result.value, {stream: true});
+                var messages = buffer.split("\n\n");
+                buffer = messages.pop();
+
+                messages.forEach(function(message) {
+                    if (message.split("\n").some(function(line) {
+                        return line.indexOf("data:") === 0;
+                    })) {
+                        scheduleRefreshJobs();
+                    }
+                });
+
+                return read();
+            });
+        }
+
+        return read();
+    }).catch(function() {
+        setTimeout(streamEvents, EVENTS_RETRY);
+    });
+}
+
+// Enqueue
+
+function enqueue(event) {
+    event.preventDefault();
+
+    var urls = document.getElementById("urls").value.split("\n").map(function(url) {
+        return url.trim();
+    }).filter(function(url) {
+        return url !== "";
+    });
+
+    var account = document.getElementById("account").value;
+
+    // The bulk endpoint accepts up to 100 URLs per request.
+    var chunks = [];
+    for (var i = 0; i < urls.length; i += 100) {
+        chunks.push(urls.slice(i, i + 100));
+    }
+
+    Promise.all(chunks.map(function(chunk) {
+        return apiJSON("POST", "/api/v1/boards", chunk.map(function(url) {
+            return account ? {url: url, account: account} : {url: url};
+        }));
+    })).then(function(responses) {
+        var queued = 0;
+        var failed = [];
+        responses.forEach(function(response) {
+            queued += response.queued;
+            response.results.forEach(function(result) {
+                if (result.error) {
+                    failed.push(result.url + ": " + result.error);
+                }
+            });
+        });
+
+        if (failed.length > 0) {
+            message("enqueue-result", queued + " board(s) queued, " + failed.length + " failed. " + failed.join(" "), true);
+            return;
+        }
+
+        message("enqueue-result", queued + " board(s) queued.");
+        document.getElementById("urls").value = "";
+    }).then(refreshJobs).catch(function(err) {
+        message("enqueue-result", err.message, true);
+    });
+}
+
+function loadAccounts() {
+    var select = document.getElementById("account");
+    apiJSON("GET", "/api/v1/accounts").then(function(accounts) {
+        while (select.options.length > 1) {
+            select.remove(1);
+        }
+        accounts.forEach(function(account) {
+            select.appendChild(el("option", {value: account.name}, [account.name + " (" + account.email + ")"]));
+        });
+    }).catch(function() {
+        // Accounts are optional. The default account is used then.
+    });
+}
+
+// Browser
+
+function releaseImages() {
+    objectURLs.forEach(URL.revokeObjectURL);
+    objectURLs = [];
+}
+
+function breadcrumb(parts) {
+    var nav = document.getElementById("breadcrumb");
+    nav.innerHTML = "";
+    parts.forEach(function(part, i) {
+        if (i > 0) {
+            nav.appendChild(document.createTextNode(" / "));
+        }
+        nav.appendChild(el("a", {href: "#", onclick: function(e) {
+            e.preventDefault();
+            part.open();
+        }}, [part.label]));
+    });
+}
+
+function showUsers() {
+    releaseImages();
+    breadcrumb([{label: "Users", open: showUsers}]);
+
+    fetchAll("/api/v1/users").then(function(users) {
+        users.sort();
+        message("browse-result", users.length + " user(s)");
+        var list = el("ul", {}, users.map(function(user) {
+            return el("li", {}, [el("a", {href: "#", onclick: function(e) {
+                e.preventDefault();
+                showBoards(user);
+            }}, [user])]);
+        }));
+        var browser = document.getElementById("browser");
+        browser.innerHTML = "";
+        browser.appendChild(list);
+    }).catch(function(err) {
+        message("browse-result", err.message, true);
+    });
+}
+
+function boardAction(user, board, action) {
+    var path = boardPath(user, board);
+
+    switch (action) {
+    case "resync":
+        return apiJSON("POST", path + "/resync").then(function(result) {
+            if (result.existing) {
+                message("browse-result", "Board is already being backed up (job " + result.uuid + ").");
+            } else {
+                message("browse-result", "Board queued again (job " + result.uuid + ").");
+            }
+            refreshJobs();
+        });
+    case "verify":
+        return apiJSON("GET", path + "/verify").then(function(result) {
+            if (result.ok) {
+                message("browse-result", "Board is consistent.");
+            } else {
+                message("browse-result", result.missinginstorage.length + " picture(s) missing in storage, " +
+                    result.missinginredis.length + " picture(s) missing in Redis.", true);
+            }
+        });
+    case "export":
+        message("browse-result", "Preparing export...");
+        return api("GET", path + "/export").then(function(response) {
+            return response.blob();
+        }).then(function(blob) {
+            var url = URL.createObjectURL(blob);
+            var link = el("a", {href: url, download: user + "-" + board.replace(/\//g, "-") + ".zip"});
+            document.body.appendChild(link);
+            link.click();
+            link.remove();
+            URL.revokeObjectURL(url);
+            message("browse-result", "Export finished.");
+        });
+    case "delete":
+        if (!confirm("Delete " + user + "/" + board + " including all pictures and sections?")) {
+            return Promise.resolve();
+        }
+        return apiJSON("DELETE", path).then(function(entry) {
+            message("browse-result", entry ? "Board moved into the trash." : "Board deleted.");
+            showBoards(user);
+        });
+    }
+}
+
+function showBoards(user) {
+    releaseImages();
+    breadcrumb([{label: "Users", open: showUsers}, {label: user, open: function() {
+        showBoards(user);
+    }}]);
+
+    fetchAll("/api/v1/users/" + encodeURIComponent(user) + "/boards").then(function(boards) {
+        boards.sort(function(a, b) {
+            return a.path.localeCompare(b.path);
+        });
+        message("browse-result", boards.length + " board(s)");
+        var rows = boards.map(function(board) {
+            var actions = ["resync", "verify", "export", "delete"].map(function(action) {
+                return el("button", {onclick: function() {
+                    boardAction(user, board.path, action).catch(function(err) {
+                        message("browse-result", err.message, true);
+                    });
+                }}, [action]);
+            });
+            return el("tr", {}, [
+                el("td", {}, [el("a", {href: "#", onclick: function(e) {
+                    e.preventDefault();
+                    showPins(user, board.path);
+                }}, [board.path])]),
+                el("td", {}, [String(board.count)]),
+                el("td", {}, [board.lastsync ? formatTime(board.lastsync) : "never"]),
+                el("td", {}, actions)
+            ]);
+        });
+        var table = el("table", {}, [
+            el("thead", {}, [el("tr", {}, [el("th", {}, ["Board"]), el("th", {}, ["Pins"]), el("th", {}, ["Last sync"]), el("th", {}, ["Actions"])])]),
+            el("tbody", {}, rows)
+        ]);
+        var browser = document.getElementById("browser");
+        browser.innerHTML = "";
+        browser.appendChild(table);
+    }).catch(function(err) {
+        message("browse-result", err.message, true);
+    });
+}
+
+// loadImage fetches a picture with the API token and shows it as soon as
+// the image becomes visible.
+var imageObserver = new IntersectionObserver(function(entries) {
+    entries.forEach(function(entry) {
+        if (!entry.isIntersecting) {
+            return;
+        }
+        var img = entry.target;
+        imageObserver.unobserve(img);
+        api("GET", img.dataset.src).then(function(response) {
+            return response.blob();
+        }).then(function(blob) {
+            var url = URL.createObjectURL(blob);
+            objectURLs.push(url);
+            img.src = url;
+        }).catch(function(err) {
+            img.alt = err.message;
+        });
+    });
+}, {rootMargin: "200px"});
+
+function showPins(user, board) {
+    releaseImages();
+    breadcrumb([{label: "Users", open: showUsers}, {label: user, open: function() {
+        showBoards(user);
+    }}, {label: board, open: function() {
+        showPins(user, board);
+    }}]);
+
+    var grid = el("div", {class: "pins"});
+    var more = el("button", {}, ["Load more"]);
+    var browser = document.getElementById("browser");
+    browser.innerHTML = "";
+    browser.appendChild(grid);
+    browser.appendChild(more);
+
+    var shown = 0;
+    var cursor = "";
+
+    // Pins are loaded page by page as boards can contain thousands of pins.
+    function loadPage() {
+        more.disabled = true;
+        apiJSON("GET", pageURL(boardPath(user, board) + "/pins", cursor)).then(function(page) {
+            page.items.forEach(function(name) {
+                // Video pins are stored as MP4 files.
+                var media = /\.mp4$/i.test(name) ?
+                    el("video", {title: name, controls: "", preload: "metadata"}) :
+                    el("img", {alt: name, title: name});
+                media.dataset.src = boardPath(user, board) + "/pins/" + encodeURIComponent(name) + "/image";
+                imageObserver.observe(media);
+                grid.appendChild(media);
+            });
+            shown += page.items.length;
+            cursor = page.next || "";
+            message("browse-result", shown + " pin(s)" + (cursor ? ", more available" : ""));
+            more.disabled = false;
+            more.style.display = cursor ? "" : "none";
+        }).catch(function(err) {
+            more.disabled = false;
+            message("browse-result", err.message, true);
+        });
+    }
+
+    more.addEventListener("click", loadPage);
+    loadPage();
+}
+
+// Trash
+
+function trashAction(entry, action) {
+    var path = "/api/v1/trash/" + encodeURIComponent(entry.id);
+
+    if (action === "restore") {
+        return apiJSON("POST", path + "/restore").then(function() {
+            message("browse-result", entry.user + "/" + entry.path + " restored.");
+            showTrash();
+        });
+    }
+
+    if (!confirm("Delete " + entry.user + "/" + entry.path + " now? This can't be undone.")) {
+        return Promise.resolve();
+    }
+    return api("DELETE", path).then(function() {
+        message("browse-result", entry.user + "/" + entry.path + " deleted.");
+        showTrash();
+    });
+}
+
+function showTrash() {
+    releaseImages();
+    breadcrumb([{label: "Users", open: showUsers}, {label: "Trash", open: showTrash}]);
+
+    apiJSON("GET", "/api/v1/trash").then(function(entries) {
+        message("browse-result", entries.length + " deleted board(s)");
+        var rows = entries.map(function(entry) {
+            var actions = ["restore", "purge"].map(function(action) {
+                return el("button", {onclick: function() {
+                    trashAction(entry, action).catch(function(err) {
+                        message("browse-result", err.message, true);
+                    });
+                }}, [action]);
+            });
+            return el("tr", {}, [
+                el("td", {}, [entry.user + "/" + entry.path]),
+                el("td", {}, [String(entry.pictures)]),
+                el("td", {}, [entry.keepfiles ? "yes" : "no"]),
+                el("td", {}, [formatTime(entry.deleted)]),
+                el("td", {}, actions)
+            ]);
+        });
+        var table = el("table", {}, [
+            el("thead", {}, [el("tr", {}, ["Board", "Pins", "Keep files", "Deleted", "Actions"].map(function(title) {
+                return el("th", {}, [title]);
+            }))]),
+            el("tbody", {}, rows)
+        ]);
+        var browser = document.getElementById("browser");
+        browser.innerHTML = "";
+        browser.appendChild(table);
+    }).catch(function(err) {
+        message("browse-result", err.message, true);
+    });
+}
+
+// Init
+
+document.getElementById("token").value = token();
+document.getElementById("token-form").addEventListener("submit", function(event) {
+    event.preventDefault();
+    localStorage.setItem("pinbackupToken", document.getElementById("token").value.trim());
+    refreshJobs();
+    showUsers();
+    loadAccounts();
+});
+document.getElementById("enqueue-form").addEventListener("submit", enqueue);
+document.getElementById("trash-link").addEventListener("click", function(event) {
+    event.preventDefault();
+    showTrash();
+});
+
+refreshJobs();
+showUsers();
+loadAccounts();
+streamEvents();
+setInterval(refreshJobs, JOBS_INTERVAL);
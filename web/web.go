@@ -0,0 +1,23 @@
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler returns a HTTP handler serving the web UI. The UI is a single page
+// application using the board REST API.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// The embedded directory is part of the binary. If it's missing
+		// the binary is broken anyways.
+		panic(err)
+	}
+
+	return http.FileServer(http.FS(files))
+}